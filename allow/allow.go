@@ -0,0 +1,209 @@
+// Package allow restricts the files and URLs sandboxed checks like scripts and
+// WebAssembly modules may access.
+//
+// Files are matched by shell patterns after all symlinks are resolved. URLs
+// are allowed by prefixes like https://api.example.com/v1: scheme and host have
+// to be equal and the path has to be the prefix or below it, so neither
+// https://api.example.com.evil.net/ nor https://api.example.com/v10 match.
+// Redirects are checked the same way.
+package allow
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// Files allows to read files matching shell patterns
+	Files interface {
+		ReadFile(path string, limit int64) ([]byte, error)
+	}
+
+	// URLs allows to fetch URLs below prefixes
+	URLs interface {
+		Check(rawURL string) error
+		Client(client *http.Client) *http.Client
+	}
+
+	// NotAllowedError is returned for files and URLs which are not allowed
+	NotAllowedError struct {
+		Kind  string
+		Value string
+	}
+
+	filesImpl struct {
+		patterns []string
+	}
+
+	urlsImpl struct {
+		prefixes []*url.URL
+	}
+)
+
+// maxRedirects is the number of redirects a client follows, like
+// http.DefaultClient
+const maxRedirects = 10
+
+func (e *NotAllowedError) Error() string {
+	return fmt.Sprintf("%s %q not allowed", e.Kind, e.Value)
+}
+
+// NewFiles returns Files allowing the absolute paths matching the patterns
+func NewFiles(patterns []string) (Files, error) {
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			return nil, fmt.Errorf("file pattern %q is not absolute", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %v", pattern, err)
+		}
+	}
+	return &filesImpl{append([]string{}, patterns...)}, nil
+}
+
+// resolve returns the path with all symlinks resolved if it matches a pattern
+func (f *filesImpl) resolve(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", &NotAllowedError{"path", path}
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		// errors are only reported for allowed paths, so checks can't probe
+		// for other files
+		if f.matches(filepath.Clean(path)) {
+			return "", err
+		}
+		return "", &NotAllowedError{"path", path}
+	}
+	if !f.matches(resolved) {
+		return "", &NotAllowedError{"path", path}
+	}
+	return resolved, nil
+}
+
+func (f *filesImpl) matches(path string) bool {
+	for _, pattern := range f.patterns {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFile reads an allowed regular file of at most limit bytes
+func (f *filesImpl) ReadFile(path string, limit int64) ([]byte, error) {
+	resolved, err := f.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	// files in /proc report a size of 0, so the read is limited as well
+	if info.Size() > limit {
+		return nil, fmt.Errorf("%s exceeds the limit of %d bytes", path, limit)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s exceeds the limit of %d bytes", path, limit)
+	}
+	return content, nil
+}
+
+// NewURLs returns URLs allowing the URLs below the prefixes, which are
+// absolute http or https URLs without credentials, query or fragment
+func NewURLs(prefixes []string) (URLs, error) {
+	u := &urlsImpl{}
+	for _, prefix := range prefixes {
+		parsed, err := url.Parse(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL prefix %q: %v", prefix, err)
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid URL prefix %q: expected an http or https URL", prefix)
+		}
+		if parsed.User != nil || parsed.RawQuery != "" || parsed.Fragment != "" || hasDotSegment(parsed.Path) {
+			return nil, fmt.Errorf("invalid URL prefix %q: only scheme, host and path are allowed", prefix)
+		}
+		u.prefixes = append(u.prefixes, parsed)
+	}
+	return u, nil
+}
+
+// Check returns a NotAllowedError if the URL is not below a prefix
+func (u *urlsImpl) Check(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !u.allowed(parsed) {
+		return &NotAllowedError{"url", rawURL}
+	}
+	return nil
+}
+
+func (u *urlsImpl) allowed(target *url.URL) bool {
+	if target.User != nil || target.Opaque != "" || hasDotSegment(target.Path) {
+		return false
+	}
+	for _, prefix := range u.prefixes {
+		if target.Scheme != prefix.Scheme || !strings.EqualFold(target.Host, prefix.Host) {
+			continue
+		}
+		// the prefix ends at a segment, /v1 allows /v1 and /v1/x but not /v10
+		path := strings.TrimSuffix(prefix.Path, "/")
+		if target.Path == path || strings.HasPrefix(target.Path, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Client returns a copy of client, http.DefaultClient if nil, which only
+// follows redirects to allowed URLs
+func (u *urlsImpl) Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	restricted := *client
+	restricted.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !u.allowed(request.URL) {
+			return &NotAllowedError{"redirect to url", request.URL.String()}
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(request, via)
+		}
+		return nil
+	}
+	return &restricted
+}
+
+// hasDotSegment reports whether a path contains . or .. segments, which
+// servers resolve to a path outside of the prefix
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
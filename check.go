@@ -0,0 +1,167 @@
+package icinga
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// CheckFunc runs a single check. It should stop when ctx is done.
+	CheckFunc func(ctx context.Context) (Result, error)
+
+	// ChecksFunc runs checks and adds their results. It should stop when ctx
+	// is done.
+	ChecksFunc func(ctx context.Context, results Results) error
+
+	// syncResults guards Results which are filled by a ChecksFunc, after
+	// close or when ctx is done further results are dropped
+	syncResults struct {
+		sync.Mutex
+		ctx     context.Context
+		results Results
+		closed  bool
+		dropped bool
+	}
+)
+
+const (
+	// CheckResultName is the name of the UNKNOWN Result added by RunChecks
+	// if the checks fail or time out
+	CheckResultName = "check"
+)
+
+// RunCheck runs a CheckFunc with a timeout. Errors, panics and timeouts are
+// returned as UNKNOWN Result with the given name.
+func RunCheck(ctx context.Context, name string, timeout time.Duration, check CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan Result, 1)
+	go func() {
+		defer recoverResult(name, done)
+		result, err := check(ctx)
+		if err != nil {
+			result = NewResultUnknownMessage(name, err.Error())
+		} else if result == nil {
+			result = NewResultUnknownMessage(name, Translate(MessageNoResult))
+		}
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return timeoutResult(ctx, name, timeout)
+	}
+}
+
+// RunChecks runs a ChecksFunc with a timeout and returns results with all
+// results added until it returned or timed out. Errors, panics and timeouts
+// are added as UNKNOWN Result named CheckResultName.
+func RunChecks(ctx context.Context, timeout time.Duration, results Results, checks ChecksFunc) Results {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	guarded := &syncResults{ctx: ctx, results: results}
+	done := make(chan Result, 1)
+	go func() {
+		defer recoverResult(CheckResultName, done)
+		if err := checks(ctx, guarded); err != nil {
+			done <- NewResultUnknownMessage(CheckResultName, err.Error())
+			return
+		}
+		done <- nil
+	}()
+
+	var failure Result
+	select {
+	case failure = <-done:
+	case <-ctx.Done():
+		failure = timeoutResult(ctx, CheckResultName, timeout)
+	}
+
+	guarded.Lock()
+	defer guarded.Unlock()
+	guarded.closed = true
+	if failure == nil && guarded.dropped {
+		// the checks returned after the timeout
+		failure = timeoutResult(ctx, CheckResultName, timeout)
+	}
+	if failure != nil {
+		results.Add(failure)
+	}
+	return results
+}
+
+// Retry returns a CheckFunc which runs check up to attempts times until it
+// returns no error, waiting delay between the attempts
+func Retry(attempts int, delay time.Duration, check CheckFunc) CheckFunc {
+	return func(ctx context.Context) (Result, error) {
+		var result Result
+		var err error
+		for attempt := 0; attempt < attempts; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil, fmt.Errorf("%v, last error: %v", ctx.Err(), err)
+				}
+			}
+			if result, err = check(ctx); err == nil {
+				return result, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// recoverResult sends an UNKNOWN Result for a panic of a check
+func recoverResult(name string, done chan<- Result) {
+	if r := recover(); r != nil {
+		done <- NewResultUnknownMessage(name, Translate(MessagePanicked, r))
+	}
+}
+
+func timeoutResult(ctx context.Context, name string, timeout time.Duration) Result {
+	if ctx.Err() == context.DeadlineExceeded {
+		return NewResultUnknownMessage(name, Translate(MessageTimedOut, timeout))
+	}
+	return NewResultUnknownMessage(name, Translate(MessageAborted, ctx.Err()))
+}
+
+func (r *syncResults) All() []Result {
+	r.Lock()
+	defer r.Unlock()
+	return r.results.All()
+}
+
+func (r *syncResults) Add(result Result) {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed || r.ctx.Err() != nil {
+		r.dropped = true
+		return
+	}
+	r.results.Add(result)
+}
+
+func (r *syncResults) CalculateStatus() Status {
+	r.Lock()
+	defer r.Unlock()
+	return r.results.CalculateStatus()
+}
+
+func (r *syncResults) GenerateMessage() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.results.GenerateMessage()
+}
+
+func (r *syncResults) Exit() {
+	r.Lock()
+	defer r.Unlock()
+	r.results.Exit()
+}
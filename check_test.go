@@ -0,0 +1,88 @@
+package icinga
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		check    CheckFunc
+		status   Status
+		contains string
+	}{
+		{func(ctx context.Context) (Result, error) {
+			return NewResultOk("check"), nil
+		}, ServiceStatusOk, DefaultSuccessMessage},
+		{func(ctx context.Context) (Result, error) {
+			return nil, errors.New("connection refused")
+		}, ServiceStatusUnknown, "connection refused"},
+		{func(ctx context.Context) (Result, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, ServiceStatusUnknown, "timed out after 50ms"},
+		{func(ctx context.Context) (Result, error) {
+			panic("boom")
+		}, ServiceStatusUnknown, "check panicked: boom"},
+	}
+	for _, test := range tests {
+		result := RunCheck(context.Background(), "check", 50*time.Millisecond, test.check)
+		t.Logf("RunCheck() is %v", result)
+		if result.Status() != test.status || !strings.Contains(result.Message(), test.contains) {
+			t.Errorf("RunCheck() should be %v containing %v", test.status, test.contains)
+		}
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	stopped := make(chan bool, 1)
+	results := RunChecks(context.Background(), 50*time.Millisecond, NewResults(), func(ctx context.Context, results Results) error {
+		results.Add(NewResultOk("check 1"))
+		<-ctx.Done()
+		results.Add(NewResultOk("check 2"))
+		stopped <- true
+		return nil
+	})
+	<-stopped
+
+	t.Logf("RunChecks() is %v", results)
+	if len(results.All()) != 2 {
+		t.Fatalf("RunChecks() should keep results added before the timeout")
+	}
+	if results.CalculateStatus() != ServiceStatusUnknown {
+		t.Errorf("RunChecks() should be %v after a timeout", ServiceStatusUnknown)
+	}
+	for _, result := range results.All() {
+		if result.Name() == "check 2" {
+			t.Errorf("RunChecks() should drop results added after the timeout")
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	check := Retry(3, time.Millisecond, func(ctx context.Context) (Result, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("not yet")
+		}
+		return NewResultOk("check"), nil
+	})
+	result := RunCheck(context.Background(), "check", time.Second, check)
+	if result.Status() != ServiceStatusOk || attempts != 3 {
+		t.Errorf("Retry() should succeed on the third attempt but is %v after %d attempts", result, attempts)
+	}
+
+	attempts = 0
+	check = Retry(2, time.Millisecond, func(ctx context.Context) (Result, error) {
+		attempts++
+		return nil, errors.New("failed")
+	})
+	result = RunCheck(context.Background(), "check", time.Second, check)
+	if result.Status() != ServiceStatusUnknown || attempts != 2 {
+		t.Errorf("Retry() should fail after 2 attempts but is %v after %d attempts", result, attempts)
+	}
+}
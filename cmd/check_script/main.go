@@ -0,0 +1,91 @@
+// Command check_script runs a custom check written in Starlark, see package
+// script for the available functions. Files, URLs and commands the script may
+// use have to be allowed explicitly:
+//
+//	check_script --script /etc/icinga2/scripts/queue.star \
+//	  --allow-file /var/spool/queue/* \
+//	  --allow-url http://localhost:8080/ \
+//	  --allow-command '/usr/bin/systemctl is-active [a-z-]+' \
+//	  --arg queue=mail \
+//	  --rules /etc/icinga2/scripts/queue.json
+//
+// The standard plugin options like --timeout and --output are supported, the
+// script can read the thresholds from args["warning"] and args["critical"].
+// The metrics of the script are evaluated with the rules of --rules, see
+// icinga.LoadEvaluator.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/script"
+)
+
+func main() {
+	options, err := icinga.NewPluginOptions("check_script", "", "")
+	if err != nil {
+		icinga.ExitUsage(err)
+	}
+
+	var file, rules string
+	var maxSteps uint64
+	var files, urls, commands, args icinga.StringsValue
+	fs := flag.NewFlagSet("check_script", flag.ContinueOnError)
+	options.Register(fs)
+	fs.StringVar(&file, "script", "", "Starlark script to run")
+	fs.Uint64Var(&maxSteps, "max-steps", script.DefaultMaxSteps, "maximum number of executed Starlark instructions")
+	fs.Var(&files, "allow-file", "file pattern the script may read, can be given multiple times")
+	fs.Var(&urls, "allow-url", "URL prefix the script may fetch, can be given multiple times")
+	fs.Var(&commands, "allow-command", "command the script may run as path and argument patterns, can be given multiple times")
+	fs.Var(&args, "arg", "key=value available in args, can be given multiple times")
+	fs.StringVar(&rules, "rules", "", "JSON file with the rules evaluating the metrics of the script, they are added as perfdata without rules")
+	if err := options.Parse(fs, os.Args[1:]); err != nil {
+		icinga.ExitUsage(err)
+	}
+	if file == "" {
+		icinga.ExitUsage(fmt.Errorf("missing --script"))
+	}
+
+	scriptOptions := script.Options{
+		Timeout:     options.Timeout,
+		MaxSteps:    maxSteps,
+		Files:       files,
+		URLPrefixes: urls,
+		Args: map[string]string{
+			"warning":  options.Thresholds.Warning.String(),
+			"critical": options.Thresholds.Critical.String(),
+		},
+		Print: os.Stderr,
+	}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			icinga.ExitUsage(fmt.Errorf("invalid --arg %q, expected key=value", arg))
+		}
+		scriptOptions.Args[kv[0]] = kv[1]
+	}
+	if rules != "" {
+		if scriptOptions.Evaluator, err = icinga.LoadEvaluator(rules); err != nil {
+			icinga.ExitUsage(err)
+		}
+	}
+	if len(commands) > 0 {
+		rules := []icinga.CommandRule{}
+		for _, command := range commands {
+			fields := strings.Fields(command)
+			if len(fields) == 0 {
+				icinga.ExitUsage(fmt.Errorf("empty --allow-command"))
+			}
+			rules = append(rules, icinga.CommandRule{Path: fields[0], Args: fields[1:]})
+		}
+		if scriptOptions.Executor, err = icinga.NewExecutor(icinga.ExecutorOptions{Rules: rules, Timeout: options.Timeout}); err != nil {
+			icinga.ExitUsage(err)
+		}
+	}
+
+	options.RunContext(script.Checks(file, scriptOptions))
+}
@@ -0,0 +1,66 @@
+// Command check_wasm runs a custom check compiled to WebAssembly, see package
+// wasm for the host functions available to the module. Files and URLs the
+// module may use have to be allowed explicitly:
+//
+//	check_wasm --module /etc/icinga2/modules/queue.wasm \
+//	  --allow-file /var/spool/queue/* \
+//	  --allow-url http://localhost:8080/ \
+//	  --rules /etc/icinga2/modules/queue.json \
+//	  -- --queue mail
+//
+// The standard plugin options like --timeout and --output are supported, the
+// arguments after -- are passed to the module followed by the thresholds as
+// --warning and --critical. The metrics of the module are evaluated with the
+// rules of --rules, see icinga.LoadEvaluator.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/wasm"
+)
+
+func main() {
+	options, err := icinga.NewPluginOptions("check_wasm", "", "")
+	if err != nil {
+		icinga.ExitUsage(err)
+	}
+
+	var file, rules string
+	var pages uint
+	var files, urls icinga.StringsValue
+	fs := flag.NewFlagSet("check_wasm", flag.ContinueOnError)
+	options.Register(fs)
+	fs.StringVar(&file, "module", "", "WebAssembly module to run")
+	fs.UintVar(&pages, "memory-pages", wasm.DefaultMemoryPages, "maximum memory of the module in 64 KiB pages")
+	fs.Var(&files, "allow-file", "file pattern the module may read, can be given multiple times")
+	fs.Var(&urls, "allow-url", "URL prefix the module may fetch, can be given multiple times")
+	fs.StringVar(&rules, "rules", "", "JSON file with the rules evaluating the metrics of the module, they are added as perfdata without rules")
+	if err := options.Parse(fs, os.Args[1:]); err != nil {
+		icinga.ExitUsage(err)
+	}
+	if file == "" {
+		icinga.ExitUsage(fmt.Errorf("missing --module"))
+	}
+
+	args := append(fs.Args(),
+		"--warning", options.Thresholds.Warning.String(),
+		"--critical", options.Thresholds.Critical.String())
+	wasmOptions := wasm.Options{
+		Timeout:     options.Timeout,
+		MemoryPages: uint32(pages),
+		Files:       files,
+		URLPrefixes: urls,
+		Args:        args,
+		Log:         os.Stderr,
+	}
+	if rules != "" {
+		if wasmOptions.Evaluator, err = icinga.LoadEvaluator(rules); err != nil {
+			icinga.ExitUsage(err)
+		}
+	}
+	options.RunContext(wasm.Checks(file, wasmOptions))
+}
@@ -0,0 +1,163 @@
+// Command icinga-collector receives the reports of agents over mutual TLS,
+// keeps the latest report per host!service and forwards it to the Icinga 2
+// API and/or history files. Reports are submitted as JSON to the HTTP API or
+// over gRPC, see package collector:
+//
+//	icinga-collector -cert collector.pem -key collector.key -ca agents-ca.pem \
+//	  -admin icinga-web \
+//	  -icinga-url https://icinga:5665/v1/actions/process-check-result \
+//	  -icinga-ca /var/lib/icinga2/certs/ca.crt \
+//	  -icinga-user collector -icinga-password-file /etc/icinga-collector/password \
+//	  -history-dir /var/lib/icinga-collector
+//
+// The password of the Icinga 2 API user is read from -icinga-password-file or
+// the ICINGA_API_PASSWORD environment variable. Agents only read their own
+// reports, the certificates named by -admin read all of them.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/collector"
+)
+
+func main() {
+	listen := flag.String("listen", ":5680", "address of the HTTP API")
+	grpcListen := flag.String("grpc-listen", "", "address of the gRPC service, disabled if empty")
+	cert := flag.String("cert", "", "server certificate")
+	key := flag.String("key", "", "server key")
+	ca := flag.String("ca", "", "CA of the agent certificates")
+	var admins icinga.StringsValue
+	flag.Var(&admins, "admin", "common name of a client certificate which may read all reports, can be given multiple times")
+	ttl := flag.Duration("ttl", collector.DefaultTTL, "time after which reports are stale")
+	reportRetention := flag.Duration("retention", collector.DefaultRetention, "time after which stale reports are removed")
+	icingaURL := flag.String("icinga-url", "", "process-check-result URL of the Icinga 2 API")
+	icingaCA := flag.String("icinga-ca", "", "CA of the Icinga 2 API certificate, the system CAs are used if empty")
+	icingaUser := flag.String("icinga-user", "", "Icinga 2 API user")
+	icingaPasswordFile := flag.String("icinga-password-file", "", "file with the Icinga 2 API password, defaults to $ICINGA_API_PASSWORD")
+	historyDir := flag.String("history-dir", "", "directory for one history file per source")
+	retention := flag.Duration("history-retention", 24*time.Hour, "retention of the history files")
+	flag.Parse()
+
+	if *cert == "" || *key == "" || *ca == "" {
+		fmt.Fprintln(os.Stderr, "missing -cert, -key or -ca")
+		flag.Usage()
+		os.Exit(2)
+	}
+	config, err := collector.TLSConfig(*cert, *key, *ca)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	icingaClient, err := apiClient(*icingaCA)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	icingaPassword, err := apiPassword(*icingaPasswordFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	c := collector.NewCollector(collector.Options{
+		TTL:       *ttl,
+		Retention: *reportRetention,
+		Sinks: func(source string) ([]icinga.Sink, error) {
+			sinks := []icinga.Sink{}
+			if *icingaURL != "" {
+				sink, err := icinga.NewWebhookSink(icinga.WebhookOptions{
+					URL:      *icingaURL,
+					Template: collector.IcingaTemplate,
+					Headers:  map[string]string{"Accept": "application/json"},
+					Username: *icingaUser,
+					Password: icingaPassword,
+					Plugin:   source,
+					Client:   icingaClient,
+				})
+				if err != nil {
+					return nil, err
+				}
+				sinks = append(sinks, sink)
+			}
+			if *historyDir != "" {
+				// escaped, so every source has its own file
+				name := url.PathEscape(source) + ".jsonl"
+				sinks = append(sinks, icinga.NewFileHistory(filepath.Join(*historyDir, name), *retention))
+			}
+			return sinks, nil
+		},
+	})
+
+	go func() {
+		for range time.Tick(time.Second) {
+			c.Expire()
+		}
+	}()
+
+	if *grpcListen != "" {
+		listener, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := collector.NewGRPCServer(c, config).Serve(listener); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: *listen, Handler: collector.NewHandler(c, collector.HandlerOptions{Admins: admins}), TLSConfig: config}
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// apiClient returns the client for the Icinga 2 API, which verifies the
+// server with caFile if set
+func apiClient(caFile string) (*http.Client, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if caFile == "" {
+		return client, nil
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Icinga CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in Icinga CA %s", caFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	client.Transport = transport
+	return client, nil
+}
+
+// apiPassword reads the password of the Icinga 2 API user from file, or from
+// the environment, so it isn't visible in the process list
+func apiPassword(file string) (string, error) {
+	if file == "" {
+		return os.Getenv("ICINGA_API_PASSWORD"), nil
+	}
+	password, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Icinga password: %v", err)
+	}
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
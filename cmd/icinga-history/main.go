@@ -0,0 +1,125 @@
+// Command icinga-history shows the recorded history of a check, as written
+// by icinga.NewFileHistory.
+//
+// For every result it prints a status timeline (one letter per run), the
+// number of status changes, the current status and a sparkline per perfdata
+// label:
+//
+//	icinga-history -file /var/lib/icinga/check_foo.jsonl [-name check] [-limit 60]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+)
+
+func main() {
+	file := flag.String("file", "", "history file to read")
+	name := flag.String("name", "", "only show the result with this name")
+	limit := flag.Int("limit", 0, "only show the last n runs (0 shows all)")
+	flag.Parse()
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "missing -file")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	runs, err := icinga.NewFileHistory(*file, 0).Runs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *limit > 0 && len(runs) > *limit {
+		runs = runs[len(runs)-*limit:]
+	}
+
+	// collect the timeline per result
+	timelines := make(map[string][]icinga.HistoryEntry)
+	for _, run := range runs {
+		for _, entry := range run.Results {
+			if *name != "" && entry.Name != *name {
+				continue
+			}
+			entry.Time = run.Time
+			timelines[entry.Name] = append(timelines[entry.Name], entry)
+		}
+	}
+
+	names := []string{}
+	for n := range timelines {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		timeline := timelines[n]
+		last := timeline[len(timeline)-1]
+		fmt.Printf("%s: %s\n", n, statusLine(timeline))
+		fmt.Printf("    %d runs, %d transitions, last %s at %s: %s\n",
+			len(timeline), icinga.CountTransitions(timeline), last.Status,
+			last.Time.Format("2006-01-02 15:04:05"), last.Message)
+		for _, line := range sparklines(timeline) {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// statusLine renders a timeline as one letter per run, e.g. "OOWWCO"
+func statusLine(timeline []icinga.HistoryEntry) string {
+	var buffer bytes.Buffer
+	for _, entry := range timeline {
+		buffer.WriteByte(entry.Status.String()[0])
+	}
+	return buffer.String()
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparklines renders the perfdata values of a timeline per label, e.g.
+// "used ▁▂▅█ 10..80%", runs without the label are left blank
+func sparklines(timeline []icinga.HistoryEntry) []string {
+	labels := []string{}
+	values := make(map[string][]*icinga.Perfdata)
+	for i, entry := range timeline {
+		for j := range entry.Perfdata {
+			p := &entry.Perfdata[j]
+			if _, found := values[p.Label]; !found {
+				labels = append(labels, p.Label)
+				values[p.Label] = make([]*icinga.Perfdata, len(timeline))
+			}
+			values[p.Label][i] = p
+		}
+	}
+
+	lines := []string{}
+	for _, label := range labels {
+		min, max, unit := math.Inf(1), math.Inf(-1), ""
+		for _, p := range values[label] {
+			if p != nil {
+				min, max, unit = math.Min(min, p.Value), math.Max(max, p.Value), p.Unit
+			}
+		}
+		var buffer bytes.Buffer
+		for _, p := range values[label] {
+			switch {
+			case p == nil:
+				buffer.WriteRune(' ')
+			case max == min:
+				buffer.WriteRune(sparks[0])
+			default:
+				buffer.WriteRune(sparks[int((p.Value-min)/(max-min)*float64(len(sparks)-1)+0.5)])
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s..%s%s", label, buffer.String(),
+			strconv.FormatFloat(min, 'g', -1, 64), strconv.FormatFloat(max, 'g', -1, 64), unit))
+	}
+	return lines
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+)
+
+type (
+	// spec describes the plugin to generate
+	spec struct {
+		Name        string       `json:"name"`
+		Description string       `json:"description"`
+		Warning     string       `json:"warning"`
+		Critical    string       `json:"critical"`
+		Options     []specOption `json:"options"`
+		Modes       []specMode   `json:"modes"`
+	}
+
+	// specMode is a mode of the plugin with its own default thresholds and
+	// options
+	specMode struct {
+		Name        string       `json:"name"`
+		Description string       `json:"description"`
+		Warning     string       `json:"warning"`
+		Critical    string       `json:"critical"`
+		Options     []specOption `json:"options"`
+	}
+
+	// specOption is an additional string option of the plugin
+	specOption struct {
+		Name    string `json:"name"`
+		Usage   string `json:"usage"`
+		Default string `json:"default"`
+	}
+
+	// file is a generated file, path is relative to the output directory
+	file struct {
+		path    string
+		content []byte
+	}
+)
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// generate renders all files of the plugin skeleton
+func generate(s spec) ([]file, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	check, err := icinga.NewStatusCheck(s.Warning, s.Critical)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Modes) > 0 {
+		// the golden file uses the first mode
+		warning, critical := s.Warning, s.Critical
+		if s.Modes[0].Warning != "" {
+			warning = s.Modes[0].Warning
+		}
+		if s.Modes[0].Critical != "" {
+			critical = s.Modes[0].Critical
+		}
+		if check, err = icinga.NewStatusCheck(warning, critical); err != nil {
+			return nil, fmt.Errorf("invalid thresholds for mode %s: %v", s.Modes[0].Name, err)
+		}
+	}
+
+	// the golden file contains the output of the unchanged skeleton
+	results := icinga.NewResults()
+	results.Add(icinga.NewResult(s.Name, check.Check(0), "value is 0"))
+
+	files := []file{}
+	for _, t := range []struct {
+		path     string
+		template *template.Template
+		gofmt    bool
+	}{
+		{"main.go", mainTemplate, true},
+		{"main_test.go", testTemplate, true},
+		{s.Name + ".conf", commandTemplate, false},
+	} {
+		var buffer bytes.Buffer
+		if err := t.template.Execute(&buffer, s); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %v", t.path, err)
+		}
+		content := buffer.Bytes()
+		if t.gofmt {
+			if content, err = format.Source(content); err != nil {
+				return nil, fmt.Errorf("failed to format %s: %v", t.path, err)
+			}
+		}
+		files = append(files, file{t.path, content})
+	}
+	files = append(files, file{filepath.Join("testdata", "check.golden"), []byte(fmt.Sprint(results))})
+	return files, nil
+}
+
+// validate checks the names of the plugin, its modes and options. Options
+// must not redefine the standard options or other options of the same mode,
+// and their Go names must be unique identifiers.
+func (s spec) validate() error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("invalid plugin name %q", s.Name)
+	}
+	reserved := standardOptions()
+	common := make(map[string]bool)
+	for _, o := range s.Options {
+		if err := checkOption(o, reserved, common); err != nil {
+			return err
+		}
+	}
+	modes := make(map[string]bool)
+	for _, m := range s.Modes {
+		if !validName.MatchString(m.Name) {
+			return fmt.Errorf("invalid mode name %q", m.Name)
+		}
+		if modes[m.Name] {
+			return fmt.Errorf("duplicate mode %q", m.Name)
+		}
+		modes[m.Name] = true
+		own := make(map[string]bool)
+		for name := range common {
+			own[name] = true
+		}
+		for _, o := range m.Options {
+			if err := checkOption(o, reserved, own); err != nil {
+				return fmt.Errorf("mode %s: %v", m.Name, err)
+			}
+		}
+	}
+
+	// the options are fields of the config struct next to options
+	fields := map[string]string{"options": "options"}
+	for _, o := range s.allOptions() {
+		field := goName(o.Name)
+		if other, found := fields[field]; found {
+			return fmt.Errorf("option %q conflicts with %q, both are named %s in Go", o.Name, other, field)
+		}
+		if token.IsKeyword(field) {
+			return fmt.Errorf("option %q is named like the Go keyword %s", o.Name, field)
+		}
+		fields[field] = o.Name
+	}
+	return nil
+}
+
+// checkOption checks the name of an option and adds it to defined
+func checkOption(o specOption, reserved map[string]bool, defined map[string]bool) error {
+	if !validName.MatchString(o.Name) {
+		return fmt.Errorf("invalid option name %q", o.Name)
+	}
+	if reserved[o.Name] {
+		return fmt.Errorf("option %q is a standard option", o.Name)
+	}
+	if defined[o.Name] {
+		return fmt.Errorf("duplicate option %q", o.Name)
+	}
+	defined[o.Name] = true
+	return nil
+}
+
+// standardOptions returns the names of the options registered by the library,
+// including --mode
+func standardOptions() map[string]bool {
+	options, _ := icinga.NewPluginOptions("check", "", "")
+	options.AddMode(icinga.Mode{Name: "mode"})
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	options.Register(fs)
+	names := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		names[f.Name] = true
+	})
+	return names
+}
+
+// write writes all files to dir, existing files are only replaced if force
+// is set
+func write(dir string, files []file, force bool) error {
+	for _, f := range files {
+		path := filepath.Join(dir, f.path)
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%s already exists, use -force to overwrite", path)
+		}
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, f.content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allOptions returns the common options and the options of all modes, options
+// with the same name are returned once
+func (s spec) allOptions() []specOption {
+	options := append([]specOption{}, s.Options...)
+	for _, m := range s.Modes {
+		options = append(options, m.Options...)
+	}
+	seen := make(map[string]bool)
+	unique := []specOption{}
+	for _, o := range options {
+		if !seen[o.Name] {
+			seen[o.Name] = true
+			unique = append(unique, o)
+		}
+	}
+	return unique
+}
+
+// Fields returns the names of all options for the config struct
+func (s spec) Fields() []string {
+	fields := []string{}
+	for _, o := range s.allOptions() {
+		fields = append(fields, o.Name)
+	}
+	return fields
+}
+
+// goName converts an option name like db-host to a Go identifier like dbHost
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// commandName returns the CheckCommand name, e.g. foo for check_foo
+func commandName(name string) string {
+	return strings.Replace(strings.TrimPrefix(name, "check_"), "-", "_", -1)
+}
+
+var funcs = template.FuncMap{
+	"goName":      goName,
+	"commandName": commandName,
+}
+
+var mainTemplate = template.Must(template.New("main.go").Funcs(funcs).Parse(`// Command {{.Name}} {{.Description}}
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+)
+
+type config struct {
+	options *icinga.PluginOptions
+{{- range .Fields}}
+	{{goName .}} string
+{{- end}}
+}
+
+func main() {
+	options, err := icinga.NewPluginOptions({{printf "%q" .Name}}, {{printf "%q" .Warning}}, {{printf "%q" .Critical}})
+	if err != nil {
+		icinga.ExitUsage(err)
+	}
+	c := config{options: options}
+{{- if .Modes}}
+	for _, mode := range modes(&c) {
+		if err := options.AddMode(mode); err != nil {
+			icinga.ExitUsage(err)
+		}
+	}
+{{- end}}
+
+	fs := flag.NewFlagSet({{printf "%q" .Name}}, flag.ContinueOnError)
+	options.Register(fs)
+{{- range .Options}}
+	fs.StringVar(&c.{{goName .Name}}, {{printf "%q" .Name}}, {{printf "%q" .Default}}, {{printf "%q" .Usage}})
+{{- end}}
+	if err := options.Parse(fs, os.Args[1:]); err != nil {
+		icinga.ExitUsage(err)
+	}
+{{if .Modes}}
+	options.RunMode()
+{{- else}}
+	options.RunContext(func(ctx context.Context, results icinga.Results) error {
+		return check(ctx, c, collect, results)
+	})
+{{- end}}
+}
+{{- if .Modes}}
+
+// modes returns the modes of the plugin, their options are stored in c
+func modes(c *config) []icinga.Mode {
+	run := func(ctx context.Context, results icinga.Results) error {
+		return check(ctx, *c, collect, results)
+	}
+	return []icinga.Mode{
+{{- range .Modes}}
+		{
+			Name:        {{printf "%q" .Name}},
+			Description: {{printf "%q" .Description}},
+			Warning:     {{printf "%q" .Warning}},
+			Critical:    {{printf "%q" .Critical}},
+			Flags: func(fs *flag.FlagSet) {
+{{- range .Options}}
+				fs.StringVar(&c.{{goName .Name}}, {{printf "%q" .Name}}, {{printf "%q" .Default}}, {{printf "%q" .Usage}})
+{{- end}}
+			},
+			Check: run,
+		},
+{{- end}}
+	}
+}
+{{- end}}
+
+// collect returns the value to check, it should stop when ctx is done
+func collect(ctx context.Context, c config) (float64, error) {
+{{- if .Modes}}
+	switch c.options.Mode {
+{{- range .Modes}}
+	case {{printf "%q" .Name}}:
+		return 0, nil
+{{- end}}
+	}
+	return 0, fmt.Errorf("mode %q is not implemented", c.options.Mode)
+{{- else}}
+	return 0, nil
+{{- end}}
+}
+
+// check evaluates the collected value against the thresholds
+func check(ctx context.Context, c config, collect func(context.Context, config) (float64, error), results icinga.Results) error {
+	value, err := collect(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	status := c.options.StatusCheck().Check(value)
+	results.Add(icinga.NewResult({{printf "%q" .Name}}, status, fmt.Sprintf("value is %v", value)))
+	return nil
+}
+`))
+
+var testTemplate = template.Must(template.New("main_test.go").Funcs(funcs).Parse(`package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestCheck(t *testing.T) {
+	options, err := icinga.NewPluginOptions({{printf "%q" .Name}}, {{printf "%q" .Warning}}, {{printf "%q" .Critical}})
+	if err != nil {
+		t.Fatalf("failed to create plugin options: %v", err)
+	}
+	c := config{options: options}
+{{- if .Modes}}
+	for _, mode := range modes(&c) {
+		if err := options.AddMode(mode); err != nil {
+			t.Fatalf("failed to add mode: %v", err)
+		}
+	}
+	fs := flag.NewFlagSet({{printf "%q" .Name}}, flag.ContinueOnError)
+	options.Register(fs)
+	if err := options.Parse(fs, []string{"--mode", {{printf "%q" (index .Modes 0).Name}}}); err != nil {
+		t.Fatalf("failed to parse options: %v", err)
+	}
+{{- end}}
+
+	results := icinga.NewResults()
+	if err := check(context.Background(), c, collect, results); err != nil {
+		t.Fatalf("check() failed: %v", err)
+	}
+
+	output := fmt.Sprint(results)
+	golden := filepath.Join("testdata", "check.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(output), 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+	shouldBe, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	t.Logf("output is:\n%v", output)
+	if output != string(shouldBe) {
+		t.Errorf("output should be:\n%s", shouldBe)
+	}
+}
+`))
+
+var commandTemplate = template.Must(template.New("command").Funcs(funcs).Parse(`object CheckCommand "{{commandName .Name}}" {
+  command = [ PluginDir + "/{{.Name}}" ]
+
+  arguments = {
+    "--warning" = "${{commandName .Name}}_warning$"
+    "--critical" = "${{commandName .Name}}_critical$"
+    "--timeout" = "${{commandName .Name}}_timeout$"
+{{- if .Modes}}
+    "--mode" = {
+      value = "${{commandName .Name}}_mode$"
+      required = true
+    }
+{{- end}}
+{{- range .Fields}}
+    "--{{.}}" = "${{commandName $.Name}}_{{commandName .}}$"
+{{- end}}
+  }
+{{if .Modes}}
+  // modes:
+{{- range .Modes}}
+  //   {{.Name}}{{if .Description}}: {{.Description}}{{end}}{{if or .Warning .Critical}} (warning {{printf "%q" .Warning}}, critical {{printf "%q" .Critical}}){{end}}
+{{- end}}
+  vars.{{commandName .Name}}_mode = {{printf "%q" (index .Modes 0).Name}}
+{{- else}}
+  vars.{{commandName .Name}}_warning = {{printf "%q" .Warning}}
+  vars.{{commandName .Name}}_critical = {{printf "%q" .Critical}}
+{{- end}}
+{{- range .Options}}
+{{- if .Default}}
+  vars.{{commandName $.Name}}_{{commandName .Name}} = {{printf "%q" .Default}}
+{{- end}}
+{{- end}}
+}
+`))
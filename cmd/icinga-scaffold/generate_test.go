@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	s := spec{
+		Name:     "check_foo",
+		Warning:  "10",
+		Critical: "20",
+		Options:  []specOption{{Name: "db-host", Usage: "database host", Default: "localhost"}},
+	}
+	files, err := generate(s)
+	if err != nil {
+		t.Fatalf("generate() failed: %v", err)
+	}
+
+	contents := make(map[string]string)
+	for _, f := range files {
+		contents[f.path] = string(f.content)
+	}
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{"main.go", `fs.StringVar(&c.dbHost, "db-host", "localhost", "database host")`},
+		{"main_test.go", `golden := filepath.Join("testdata", "check.golden")`},
+		{"check_foo.conf", `"--db-host" = "$foo_db_host$"`},
+		{"check_foo.conf", `vars.foo_warning = "10"`},
+		{"testdata/check.golden", "OK: check_foo: value is 0\n"},
+	}
+	for _, test := range tests {
+		content, found := contents[test.path]
+		if !found {
+			t.Errorf("generate() should create %v", test.path)
+			continue
+		}
+		if !strings.Contains(content, test.contains) {
+			t.Errorf("%v should contain %v", test.path, test.contains)
+		}
+	}
+}
+
+func TestGenerateModes(t *testing.T) {
+	s := spec{
+		Name:     "check_db",
+		Warning:  "10",
+		Critical: "20",
+		Options:  []specOption{{Name: "host", Usage: "database host", Default: "localhost"}},
+		Modes: []specMode{
+			{Name: "connections", Description: "number of connections", Warning: "100", Critical: "200",
+				Options: []specOption{{Name: "database", Usage: "database name"}}},
+			{Name: "replication", Options: []specOption{{Name: "database", Usage: "database name"}}},
+		},
+	}
+	files, err := generate(s)
+	if err != nil {
+		t.Fatalf("generate() failed: %v", err)
+	}
+
+	contents := make(map[string]string)
+	for _, f := range files {
+		contents[f.path] = string(f.content)
+	}
+	tests := []struct {
+		path     string
+		contains string
+		count    int
+	}{
+		{"main.go", "\tdatabase string\n", 1},
+		{"main.go", `Name:        "replication",`, 1},
+		{"main.go", `fs.StringVar(&c.database, "database", "", "database name")`, 2},
+		{"main.go", "options.RunMode()", 1},
+		{"main_test.go", `options.Parse(fs, []string{"--mode", "connections"})`, 1},
+		{"check_db.conf", `value = "$db_mode$"`, 1},
+		{"check_db.conf", `"--database" = "$db_database$"`, 1},
+		{"check_db.conf", `//   connections: number of connections (warning "100", critical "200")`, 1},
+		{"check_db.conf", `vars.db_warning`, 0},
+		{"testdata/check.golden", "OK: check_db: value is 0\n", 1},
+	}
+	for _, test := range tests {
+		count := strings.Count(contents[test.path], test.contains)
+		if count != test.count {
+			t.Errorf("%v should contain %v %d times but contains it %d times", test.path, test.contains, test.count, count)
+		}
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	tests := []spec{
+		{Name: "Check Foo"},
+		{Name: "check_foo", Options: []specOption{{Name: "1st"}}},
+		{Name: "check_foo", Warning: "20:10"},
+		{Name: "check_foo", Modes: []specMode{{Name: "Mode"}}},
+		{Name: "check_foo", Modes: []specMode{{Name: "a", Options: []specOption{{Name: "_x"}}}}},
+		{Name: "check_foo", Modes: []specMode{{Name: "a", Warning: "x"}}},
+		{Name: "check_foo", Modes: []specMode{{Name: "a"}, {Name: "a"}}},
+		{Name: "check_foo", Options: []specOption{{Name: "warning"}}},
+		{Name: "check_foo", Options: []specOption{{Name: "t"}}},
+		{Name: "check_foo", Options: []specOption{{Name: "config"}}},
+		{Name: "check_foo", Modes: []specMode{{Name: "a", Options: []specOption{{Name: "mode"}}}}},
+		{Name: "check_foo", Options: []specOption{{Name: "host"}, {Name: "host"}}},
+		{Name: "check_foo", Options: []specOption{{Name: "host"}}, Modes: []specMode{{Name: "a", Options: []specOption{{Name: "host"}}}}},
+		{Name: "check_foo", Options: []specOption{{Name: "db-host"}, {Name: "db_host"}}},
+		{Name: "check_foo", Options: []specOption{{Name: "type"}}},
+		{Name: "check_foo", Options: []specOption{{Name: "options"}}},
+	}
+	for _, s := range tests {
+		_, err := generate(s)
+		t.Logf("generate(%v) is %v", s, err)
+		if err == nil {
+			t.Errorf("generate(%v) should fail", s)
+		}
+	}
+}
+
+func TestGenerateBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated plugins")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	specs := []spec{
+		{Name: "check_foo", Warning: "10", Critical: "20", Options: []specOption{{Name: "db-host", Usage: "database host", Default: "localhost"}}},
+		{Name: "check_db", Warning: "10", Critical: "20",
+			Options: []specOption{{Name: "host", Usage: "database host"}},
+			Modes: []specMode{
+				{Name: "connections", Warning: "100", Critical: "200", Options: []specOption{{Name: "database"}}},
+				{Name: "replication", Options: []specOption{{Name: "database"}, {Name: "replica"}}},
+			}},
+	}
+	for _, s := range specs {
+		files, err := generate(s)
+		if err != nil {
+			t.Fatalf("generate() failed: %v", err)
+		}
+		// the plugin is generated within this module, so it builds against
+		// the library of this tree
+		dir, err := ioutil.TempDir(".", "generated")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		if err := write(dir, files, false); err != nil {
+			t.Fatalf("write() failed: %v", err)
+		}
+
+		for _, args := range [][]string{{"vet", "./" + filepath.Base(dir)}, {"test", "./" + filepath.Base(dir)}} {
+			output, err := exec.Command("go", args...).CombinedOutput()
+			t.Logf("go %v of %s: %s", args, s.Name, output)
+			if err != nil {
+				t.Errorf("go %v of the generated %s failed: %v", args[0], s.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Command icinga-scaffold creates the skeleton of a new check plugin using the
+// plugin options of this library. It writes main.go with the check function,
+// main_test.go with a golden file test and an Icinga 2 CheckCommand
+// definition.
+//
+// The plugin is described by a JSON spec file or by answering a few
+// questions:
+//
+//	icinga-scaffold -spec check_foo.json -dir ./check_foo
+//	icinga-scaffold -dir ./check_foo
+//
+// A spec file looks like this:
+//
+//	{
+//	  "name": "check_foo",
+//	  "description": "checks the foo service",
+//	  "warning": "10",
+//	  "critical": "20",
+//	  "options": [{"name": "host", "usage": "foo host", "default": "localhost"}],
+//	  "modes": [
+//	    {"name": "connections", "description": "number of connections", "warning": "100", "critical": "200"},
+//	    {"name": "replication", "options": [{"name": "replica", "usage": "replica name"}]}
+//	  ]
+//	}
+//
+// Modes are optional, each mode has its own default thresholds and options
+// and is selected with --mode.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func main() {
+	specFile := flag.String("spec", "", "JSON spec file, asks for the plugin details if empty")
+	dir := flag.String("dir", "", "output directory, defaults to the plugin name")
+	force := flag.Bool("force", false, "overwrite existing files")
+	flag.Parse()
+
+	var s spec
+	if *specFile != "" {
+		data, err := ioutil.ReadFile(*specFile)
+		if err != nil {
+			fail(err)
+		}
+		if err := json.Unmarshal(data, &s); err != nil {
+			fail(fmt.Errorf("failed to parse spec %s: %v", *specFile, err))
+		}
+	} else {
+		s = ask(os.Stdin, os.Stdout)
+	}
+
+	if *dir == "" {
+		*dir = s.Name
+	}
+	files, err := generate(s)
+	if err != nil {
+		fail(err)
+	}
+	if err := write(*dir, files, *force); err != nil {
+		fail(err)
+	}
+	for _, file := range files {
+		fmt.Printf("created %s/%s\n", *dir, file.path)
+	}
+}
+
+// ask reads the plugin details from r
+func ask(r io.Reader, w io.Writer) spec {
+	reader := bufio.NewReader(r)
+	question := func(text string, def string) string {
+		fmt.Fprintf(w, "%s [%s]: ", text, def)
+		answer, _ := reader.ReadString('\n')
+		if answer = strings.TrimSpace(answer); answer != "" {
+			return answer
+		}
+		return def
+	}
+
+	s := spec{}
+	s.Name = question("plugin name", "check_example")
+	s.Description = question("description", "checks "+strings.TrimPrefix(s.Name, "check_"))
+	s.Warning = question("default warning threshold", "10")
+	s.Critical = question("default critical threshold", "20")
+	for {
+		name := question("additional option (empty to finish)", "")
+		if name == "" {
+			break
+		}
+		s.Options = append(s.Options, specOption{
+			Name:    name,
+			Usage:   question("  usage", name),
+			Default: question("  default", ""),
+		})
+	}
+	for {
+		name := question("mode (empty to finish)", "")
+		if name == "" {
+			return s
+		}
+		s.Modes = append(s.Modes, specMode{
+			Name:        name,
+			Description: question("  description", name),
+			Warning:     question("  default warning threshold", s.Warning),
+			Critical:    question("  default critical threshold", s.Critical),
+		})
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,337 @@
+// Package collector receives the reports of agents on many hosts, keeps the
+// latest report per host and service and forwards them, e.g. to Icinga.
+// Agents authenticate with client certificates, their name is the common
+// name of the certificate. Reports are submitted over HTTP/JSON, see
+// NewHandler, or the ResultService of package transport, see NewGRPCServer.
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport"
+)
+
+type (
+	// Options options to create a Collector
+	Options struct {
+		// TTL is the time after which the latest report of a source is
+		// stale, defaults to DefaultTTL
+		TTL time.Duration
+		// Authorize decides whether an agent may submit a report, defaults to
+		// AuthorizeHost
+		Authorize func(agent string, report *transport.Report) error
+		// Retention is the time after which a stale source is removed,
+		// defaults to DefaultRetention and is at least TTL
+		Retention time.Duration
+		// Sinks returns the sinks a source is forwarded to, they are created
+		// once per source. Reports aren't forwarded if nil.
+		Sinks func(source string) ([]icinga.Sink, error)
+		// QueueSize is the number of results queued per source while its
+		// sinks are busy, defaults to DefaultQueueSize. The oldest results are
+		// dropped from a full queue.
+		QueueSize int
+		// Logger receives forwarding errors, defaults to slog.Default()
+		Logger *slog.Logger
+	}
+
+	// Collector keeps the latest report per source, sources are named like
+	// host!service
+	Collector interface {
+		// Add adds a report submitted by an agent and forwards it
+		Add(agent string, report *transport.Report) error
+		// Entries returns the latest entries sorted by source, stale reports
+		// are UNKNOWN
+		Entries() []Entry
+		// Entry returns the latest entry of a source
+		Entry(source string) (Entry, bool)
+		// Cluster aggregates the reports of a service on all hosts
+		Cluster(service string, options icinga.ResultsOptions) *transport.Report
+		// Expire forwards the sources which became stale since the last call
+		// and removes the sources older than the retention
+		Expire()
+	}
+
+	// Entry is the latest report of a source
+	Entry struct {
+		Source   string            `json:"source"`
+		Agent    string            `json:"agent"`
+		Received time.Time         `json:"received"`
+		Stale    bool              `json:"stale"`
+		Report   *transport.Report `json:"report"`
+	}
+
+	collectorImpl struct {
+		sync.Mutex
+		options    Options
+		entries    map[string]*entry
+		forwarders map[string]chan icinga.Results
+		now        func() time.Time
+		// pending counts the queued results
+		pending sync.WaitGroup
+	}
+
+	entry struct {
+		Entry
+		// expired is set once the stale report was forwarded
+		expired bool
+	}
+)
+
+const (
+	// DefaultTTL is the time after which reports are stale by default
+	DefaultTTL = 5 * time.Minute
+	// DefaultRetention is the time after which stale sources are removed by
+	// default
+	DefaultRetention = 24 * time.Hour
+	// DefaultQueueSize is the number of results queued per source by default
+	DefaultQueueSize = 10
+)
+
+// IcingaTemplate is a WebhookOptions template which submits the results of a
+// source with their perfdata to the process-check-result action of the
+// Icinga 2 API, the source must be used as plugin name
+const IcingaTemplate = `{"type":"Service","service":{{json .Plugin}},"exit_status":{{.Status.Ordinal}},"plugin_output":{{json .Message}},"performance_data":{{json .Perfdata}}}`
+
+// NewCollector creates a Collector
+func NewCollector(options Options) Collector {
+	if options.TTL <= 0 {
+		options.TTL = DefaultTTL
+	}
+	if options.Retention <= 0 {
+		options.Retention = DefaultRetention
+	}
+	if options.Retention < options.TTL {
+		options.Retention = options.TTL
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.Authorize == nil {
+		options.Authorize = AuthorizeHost
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	return &collectorImpl{
+		options:    options,
+		entries:    make(map[string]*entry),
+		forwarders: make(map[string]chan icinga.Results),
+		now:        time.Now,
+	}
+}
+
+// AuthorizeHost allows agents to submit reports of their own host, the host
+// of a source is the part before the first !. Nested reports are checked as
+// well.
+func AuthorizeHost(agent string, report *transport.Report) error {
+	host, _, _ := splitSource(report.Source)
+	if host != agent {
+		return fmt.Errorf("agent %s may not submit reports for %s", agent, report.Source)
+	}
+	for _, child := range report.Children {
+		if err := AuthorizeHost(agent, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add authorizes, stores and forwards a report
+func (c *collectorImpl) Add(agent string, report *transport.Report) error {
+	if _, _, err := splitSource(report.Source); err != nil {
+		return err
+	}
+	if err := c.options.Authorize(agent, report); err != nil {
+		return err
+	}
+	results, err := report.ToResults()
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.entries[report.Source] = &entry{Entry: Entry{
+		Source:   report.Source,
+		Agent:    agent,
+		Received: c.now(),
+		Report:   report,
+	}}
+	c.forward(report.Source, results)
+	return nil
+}
+
+// Entries returns all entries, stale reports are UNKNOWN
+func (c *collectorImpl) Entries() []Entry {
+	c.Lock()
+	defer c.Unlock()
+	entries := []Entry{}
+	for _, e := range c.entries {
+		entries = append(entries, c.current(e))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Source < entries[j].Source
+	})
+	return entries
+}
+
+// Entry returns the entry of a source, a stale report is UNKNOWN
+func (c *collectorImpl) Entry(source string) (Entry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, found := c.entries[source]
+	if !found {
+		return Entry{}, false
+	}
+	return c.current(e), true
+}
+
+// Cluster returns a report with one Result per host of the service, the
+// reports of the hosts are its children
+func (c *collectorImpl) Cluster(service string, options icinga.ResultsOptions) *transport.Report {
+	results := icinga.NewResultsWithOptions(options)
+	children := []*transport.Report{}
+	for _, e := range c.Entries() {
+		host, s, _ := splitSource(e.Source)
+		if s != service {
+			continue
+		}
+		results.Add(icinga.NewResult(host, e.Report.Status, e.Report.Message))
+		children = append(children, e.Report)
+	}
+	if len(children) == 0 {
+		results.Add(icinga.NewResultUnknownMessage(service, "no reports for service "+service))
+	}
+	return &transport.Report{
+		Source:   "cluster!" + service,
+		Time:     c.now(),
+		Status:   results.CalculateStatus(),
+		Message:  results.GenerateMessage(),
+		Results:  results.All(),
+		Children: children,
+	}
+}
+
+// Expire forwards the UNKNOWN report of sources which became stale and
+// removes the sources whose report is older than the retention
+func (c *collectorImpl) Expire() {
+	c.Lock()
+	defer c.Unlock()
+	for source, e := range c.entries {
+		current := c.current(e)
+		if current.Stale && !e.expired {
+			e.expired = true
+			// the result names were checked by Add
+			results, _ := current.Report.ToResults()
+			c.forward(source, results)
+		}
+		if c.now().Sub(e.Received) > c.options.Retention {
+			delete(c.entries, source)
+			// the worker writes the queued results and stops
+			if queue, found := c.forwarders[source]; found {
+				close(queue)
+				delete(c.forwarders, source)
+			}
+		}
+	}
+}
+
+// current returns the entry with an UNKNOWN report if it is stale
+func (c *collectorImpl) current(e *entry) Entry {
+	if c.now().Sub(e.Received) <= c.options.TTL {
+		return e.Entry
+	}
+	current := e.Entry
+	current.Stale = true
+	current.Report = staleReport(e.Report, e.Received)
+	return current
+}
+
+// staleReport marks the report, its children and all their results UNKNOWN,
+// details and perfdata are kept
+func staleReport(report *transport.Report, received time.Time) *transport.Report {
+	since := "stale since " + received.Format(time.RFC3339)
+	stale := *report
+	stale.Status = icinga.ServiceStatusUnknown
+	stale.Message = fmt.Sprintf("%s: %s", since, report.Message)
+	stale.Results = nil
+	for _, result := range report.Results {
+		message := fmt.Sprintf("%s: %s", since, result.Message())
+		var details []string
+		if detailed, ok := result.(icinga.DetailedResult); ok {
+			details = detailed.Details()
+		}
+		stale.Results = append(stale.Results, icinga.NewResultWithDetailsAndPerfdata(result.Name(), icinga.ServiceStatusUnknown, message, details, icinga.ResultPerfdata(result)))
+	}
+	if len(stale.Results) == 0 {
+		stale.Results = append(stale.Results, icinga.NewResultUnknownMessage(report.Source, since))
+	}
+	stale.Children = nil
+	for _, child := range report.Children {
+		stale.Children = append(stale.Children, staleReport(child, received))
+	}
+	return &stale
+}
+
+// forward queues the results for the sinks of the source, the collector must
+// be locked. Every source has a worker, so slow sinks only delay their own
+// source.
+func (c *collectorImpl) forward(source string, results icinga.Results) {
+	if c.options.Sinks == nil {
+		return
+	}
+	queue, found := c.forwarders[source]
+	if !found {
+		sinks, err := c.options.Sinks(source)
+		if err != nil {
+			c.options.Logger.Error("failed to create sinks", "source", source, "error", err)
+			return
+		}
+		queue = make(chan icinga.Results, c.options.QueueSize)
+		c.forwarders[source] = queue
+		go c.write(source, sinks, queue)
+	}
+
+	c.pending.Add(1)
+	for {
+		select {
+		case queue <- results:
+			return
+		default:
+		}
+		// the latest results are more important than the oldest queued ones
+		select {
+		case <-queue:
+			c.pending.Done()
+			c.options.Logger.Warn("dropped results, sinks are too slow", "source", source)
+		default:
+		}
+	}
+}
+
+// write writes the queued results to the sinks until the queue is closed
+func (c *collectorImpl) write(source string, sinks []icinga.Sink, queue chan icinga.Results) {
+	for results := range queue {
+		for _, sink := range sinks {
+			if err := sink.Write(results); err != nil {
+				c.options.Logger.Error("failed to forward results", "source", source, "error", err)
+			}
+		}
+		c.pending.Done()
+	}
+}
+
+// splitSource splits a source like host!service
+func splitSource(source string) (string, string, error) {
+	parts := strings.SplitN(source, "!", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return source, "", fmt.Errorf("invalid source %q, expected host!service", source)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,252 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport"
+)
+
+// recordingSink records the written results
+type recordingSink struct {
+	sync.Mutex
+	written []string
+}
+
+func (s *recordingSink) Write(results icinga.Results) error {
+	s.Lock()
+	defer s.Unlock()
+	s.written = append(s.written, fmt.Sprintf("%v", results))
+	return nil
+}
+
+func newTestCollector(options Options) (*collectorImpl, *time.Time) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	c := NewCollector(options).(*collectorImpl)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func report(source string, status icinga.Status, message string) *transport.Report {
+	results := icinga.NewResults()
+	results.Add(icinga.NewResult("check", status, message))
+	return transport.NewReport(source, results, nil)
+}
+
+func TestCollector(t *testing.T) {
+	sinks := make(map[string]*recordingSink)
+	c, now := newTestCollector(Options{
+		TTL: time.Minute,
+		Sinks: func(source string) ([]icinga.Sink, error) {
+			sinks[source] = &recordingSink{}
+			return []icinga.Sink{sinks[source]}, nil
+		},
+	})
+
+	tests := []struct {
+		agent    string
+		report   *transport.Report
+		errorMsg string
+	}{
+		{"db1", report("db1!disk", icinga.ServiceStatusOk, "10% used"), ""},
+		{"db2", report("db2!disk", icinga.ServiceStatusCritical, "98% used"), ""},
+		{"db1", report("db1!load", icinga.ServiceStatusWarning, "load 5"), ""},
+		{"db1", report("db2!load", icinga.ServiceStatusOk, "load 1"), "agent db1 may not submit reports for db2!load"},
+		{"db1", report("db1", icinga.ServiceStatusOk, ""), `invalid source "db1", expected host!service`},
+		{"db1", &transport.Report{Source: "db1!cluster", Children: []*transport.Report{{Source: "db3!disk"}}}, "agent db1 may not submit reports for db3!disk"},
+		{"db1", &transport.Report{Source: "db1!mail", Results: []icinga.Result{icinga.NewResultOk("queue"), icinga.NewResultOk("queue")}}, "report db1!mail contains result queue more than once"},
+	}
+	for _, test := range tests {
+		err := c.Add(test.agent, test.report)
+		t.Logf("Add(%s, %s) is %v", test.agent, test.report.Source, err)
+		if test.errorMsg == "" && err != nil {
+			t.Errorf("Add() should succeed")
+		}
+		if test.errorMsg != "" && (err == nil || err.Error() != test.errorMsg) {
+			t.Errorf("Add() should fail with: %v", test.errorMsg)
+		}
+	}
+
+	entries := c.Entries()
+	if len(entries) != 3 || entries[0].Source != "db1!disk" || entries[0].Agent != "db1" || entries[0].Stale {
+		t.Fatalf("Entries() should return the added reports but is %+v", entries)
+	}
+	c.pending.Wait()
+	if len(sinks) != 3 || sinks["db2!disk"].written[0] != "CRITICAL: critical: [check]\nCRITICAL: check: 98% used\n" {
+		t.Errorf("Add() should forward the results but is %v", sinks["db2!disk"].written)
+	}
+
+	cluster := c.Cluster("disk", icinga.ResultsOptions{})
+	t.Logf("Cluster() is %+v", cluster)
+	if cluster.Status != icinga.ServiceStatusCritical || len(cluster.Results) != 2 || len(cluster.Children) != 2 {
+		t.Errorf("Cluster() should contain db1 and db2")
+	}
+	if cluster := c.Cluster("mail", icinga.ResultsOptions{}); cluster.Status != icinga.ServiceStatusUnknown {
+		t.Errorf("Cluster() without reports should be UNKNOWN")
+	}
+
+	// db1!load is renewed, all others become stale and are forwarded once
+	*now = now.Add(50 * time.Second)
+	c.Add("db1", report("db1!load", icinga.ServiceStatusOk, "load 1"))
+	*now = now.Add(20 * time.Second)
+	c.Expire()
+	c.Expire()
+	c.pending.Wait()
+
+	entry, _ := c.Entry("db2!disk")
+	t.Logf("Entry() is %+v", entry.Report)
+	if !entry.Stale || entry.Report.Status != icinga.ServiceStatusUnknown ||
+		entry.Report.Results[0].Message() != "stale since 2026-10-17T12:00:00Z: 98% used" {
+		t.Errorf("Entry() should be stale")
+	}
+	if entry, _ := c.Entry("db1!load"); entry.Stale {
+		t.Errorf("Entry() of a renewed report shouldn't be stale")
+	}
+	if written := sinks["db2!disk"].written; len(written) != 2 || !strings.HasPrefix(written[1], "UNKNOWN") {
+		t.Errorf("Expire() should forward the stale report once but is %v", written)
+	}
+	if written := sinks["db1!load"].written; len(written) != 2 {
+		t.Errorf("Expire() shouldn't forward renewed reports but is %v", written)
+	}
+	if _, found := c.Entry("db9!disk"); found {
+		t.Errorf("Entry() should return false for unknown sources")
+	}
+}
+
+// blockingSink blocks until it is released
+type blockingSink struct {
+	recordingSink
+	release chan struct{}
+}
+
+func (s *blockingSink) Write(results icinga.Results) error {
+	<-s.release
+	return s.recordingSink.Write(results)
+}
+
+func TestCollectorForward(t *testing.T) {
+	slow := &blockingSink{release: make(chan struct{})}
+	fast := &recordingSink{}
+	c, now := newTestCollector(Options{
+		TTL:       time.Minute,
+		Retention: time.Hour,
+		QueueSize: 2,
+		Sinks: func(source string) ([]icinga.Sink, error) {
+			if source == "db1!disk" {
+				return []icinga.Sink{slow}, nil
+			}
+			return []icinga.Sink{fast}, nil
+		},
+	})
+
+	// the slow sink blocks at the first report, of the following four only
+	// the latest two are queued
+	for i := 0; i < 5; i++ {
+		c.Add("db1", report("db1!disk", icinga.ServiceStatusOk, fmt.Sprintf("run %d", i)))
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Add("db2", report("db2!disk", icinga.ServiceStatusOk, "10% used"))
+	for start := time.Now(); len(written(fast)) == 0 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if len(written(fast)) != 1 {
+		t.Errorf("a slow sink shouldn't block other sources")
+	}
+	close(slow.release)
+	c.pending.Wait()
+	t.Logf("slow sink received %v", written(&slow.recordingSink))
+	if w := strings.Join(written(&slow.recordingSink), ""); strings.Count(w, "OK: check: run") != 3 ||
+		!strings.Contains(w, "run 0") || !strings.Contains(w, "run 3") || !strings.Contains(w, "run 4") {
+		t.Errorf("the oldest queued results should be dropped")
+	}
+
+	// sources are removed after the retention, their stale report is
+	// forwarded before
+	*now = now.Add(30 * time.Minute)
+	c.Add("db2", report("db2!disk", icinga.ServiceStatusOk, "12% used"))
+	*now = now.Add(31 * time.Minute)
+	c.Expire()
+	c.pending.Wait()
+	if _, found := c.Entry("db1!disk"); found {
+		t.Errorf("Expire() should remove sources older than the retention")
+	}
+	if entry, found := c.Entry("db2!disk"); !found || !entry.Stale {
+		t.Errorf("Expire() should keep stale sources within the retention")
+	}
+	if w := written(&slow.recordingSink); len(w) != 4 || !strings.HasPrefix(w[3], "UNKNOWN") {
+		t.Errorf("Expire() should forward the stale report before removing the source but is %v", w)
+	}
+	if len(c.forwarders) != 1 {
+		t.Errorf("Expire() should stop the workers of removed sources")
+	}
+}
+
+func written(s *recordingSink) []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string{}, s.written...)
+}
+
+func TestStaleReport(t *testing.T) {
+	child := &transport.Report{
+		Source: "db1!disk-var",
+		Status: icinga.ServiceStatusOk,
+		Results: []icinga.Result{
+			icinga.NewResultWithDetailsAndPerfdata("/var", icinga.ServiceStatusOk, "10% used", []string{"sda2"}, []icinga.Perfdata{{Label: "/var", Value: 10, Unit: "%"}}),
+		},
+		Children: []*transport.Report{{Source: "db1!disk-var-log", Status: icinga.ServiceStatusOk}},
+	}
+	parent := &transport.Report{Source: "db1!disk", Status: icinga.ServiceStatusOk, Children: []*transport.Report{child}}
+
+	stale := staleReport(parent, time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	t.Logf("staleReport() is %+v", stale)
+	if len(stale.Children) != 1 || len(stale.Children[0].Children) != 1 {
+		t.Fatalf("staleReport() should keep the children")
+	}
+	for _, r := range []*transport.Report{stale, stale.Children[0], stale.Children[0].Children[0]} {
+		if r.Status != icinga.ServiceStatusUnknown || r.Results[0].Status() != icinga.ServiceStatusUnknown {
+			t.Errorf("staleReport() should mark %s and its results UNKNOWN", r.Source)
+		}
+	}
+	result := stale.Children[0].Results[0]
+	if result.Message() != "stale since 2026-10-17T12:00:00Z: 10% used" ||
+		fmt.Sprint(result.(icinga.DetailedResult).Details()) != "[sda2]" ||
+		fmt.Sprint(icinga.ResultPerfdata(result)) != "[/var=10%]" {
+		t.Errorf("staleReport() should keep the details and perfdata but is %v", result)
+	}
+	if child.Status != icinga.ServiceStatusOk || child.Results[0].Status() != icinga.ServiceStatusOk {
+		t.Errorf("staleReport() shouldn't modify the original report")
+	}
+}
+
+func TestIcingaTemplate(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	sink, err := icinga.NewWebhookSink(icinga.WebhookOptions{URL: server.URL, Template: IcingaTemplate, Plugin: "db1!disk"})
+	if err != nil {
+		t.Fatalf("NewWebhookSink() failed: %v", err)
+	}
+	results, _ := report("db1!disk", icinga.ServiceStatusCritical, "98% used").ToResults()
+	results.Add(icinga.NewResultWithPerfdata("/var", icinga.ServiceStatusOk, "10% used", []icinga.Perfdata{{Label: "/var", Value: 10, Unit: "%", Warning: "80", Critical: "90"}}))
+	if err := sink.Write(results); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	body := <-bodies
+	t.Logf("body is %s", body)
+	shouldBe := `{"type":"Service","service":"db1!disk","exit_status":2,"plugin_output":"CRITICAL: critical: [check] ok: [/var]","performance_data":["/var=10%;80;90"]}`
+	if body != shouldBe {
+		t.Errorf("body should be %s", shouldBe)
+	}
+}
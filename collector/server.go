@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MaxReportSize limits the size of reports submitted over HTTP
+const MaxReportSize = 4 << 20
+
+// TLSConfig creates a server config which requires client certificates
+// signed by the CA in caFile
+func TLSConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %v", err)
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in CA %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// AgentName returns the common name of the verified client certificate
+func AgentName(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", fmt.Errorf("no verified client certificate")
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return "", fmt.Errorf("client certificate without common name")
+	}
+	return name, nil
+}
+
+// HandlerOptions options of the HTTP API
+type HandlerOptions struct {
+	// Admins are the agent names, the common names of client certificates,
+	// which may read the reports of all hosts. Other agents may only read the
+	// reports of their own host.
+	Admins []string
+}
+
+// NewHandler returns the HTTP API of the collector, the server must verify
+// client certificates:
+//
+//	POST /v1/reports            submits a JSON report
+//	GET  /v1/reports            returns all entries readable by the agent
+//	GET  /v1/reports/<source>   returns the entry of a source
+//	GET  /v1/cluster/<service>  returns the aggregated report of a service,
+//	                            only for admins
+func NewHandler(c Collector, options HandlerOptions) http.Handler {
+	admins := make(map[string]bool)
+	for _, admin := range options.Admins {
+		admins[admin] = true
+	}
+	// readable returns whether the agent may read the reports of the source
+	readable := func(agent string, source string) bool {
+		host, _, _ := splitSource(source)
+		return admins[agent] || host == agent
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/reports", func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			entries := []Entry{}
+			for _, entry := range c.Entries() {
+				if readable(agent, entry.Source) {
+					entries = append(entries, entry)
+				}
+			}
+			writeJSON(w, entries)
+		case http.MethodPost:
+			submitHTTP(c, agent, w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/v1/reports/", func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		source := strings.TrimPrefix(r.URL.Path, "/v1/reports/")
+		if !readable(agent, source) {
+			http.Error(w, fmt.Sprintf("agent %s may not read reports of %s", agent, source), http.StatusForbidden)
+			return
+		}
+		entry, found := c.Entry(source)
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, entry)
+	})
+	mux.HandleFunc("/v1/cluster/", func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !admins[agent] {
+			http.Error(w, fmt.Sprintf("agent %s may not read clusters", agent), http.StatusForbidden)
+			return
+		}
+		writeJSON(w, c.Cluster(strings.TrimPrefix(r.URL.Path, "/v1/cluster/"), icinga.ResultsOptions{}))
+	})
+	return mux
+}
+
+// authenticate returns the agent name of the request or writes an error
+func authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	agent, err := AgentName(r.TLS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	return agent, true
+}
+
+func submitHTTP(c Collector, agent string, w http.ResponseWriter, r *http.Request) {
+	report := &transport.Report{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxReportSize)).Decode(report); err != nil {
+		http.Error(w, fmt.Sprintf("invalid report: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := c.Add(agent, report); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// NewGRPCServer creates a gRPC server with the ResultService of the
+// collector, agents are authenticated with config like TLSConfig
+func NewGRPCServer(c Collector, config *tls.Config) *grpc.Server {
+	return transport.NewServer(transport.ResultServerFunc(func(ctx context.Context, report *transport.Report) error {
+		p, found := peer.FromContext(ctx)
+		if !found {
+			return status.Error(codes.Unauthenticated, "unknown peer")
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "no TLS connection")
+		}
+		agent, err := AgentName(&info.State)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err := c.Add(agent, report); err != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil
+	}), grpc.Creds(credentials.NewTLS(config)))
+}
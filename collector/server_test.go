@@ -0,0 +1,251 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// testPKI is a CA with certificates for the server and agents
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "icinga-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	p := &testPKI{dir: dir}
+	p.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &p.caKey.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	p.ca, _ = x509.ParseCertificate(der)
+	p.write(t, "ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) write(t *testing.T, name string, blockType string, der []byte) string {
+	path := filepath.Join(p.dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// issue creates a certificate and key file for name
+func (p *testPKI) issue(t *testing.T, name string, usage x509.ExtKeyUsage) tls.Certificate {
+	p.serial++
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial + 1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	cert, err := tls.LoadX509KeyPair(p.write(t, name+".pem", "CERTIFICATE", der), p.write(t, name+".key", "EC PRIVATE KEY", keyDER))
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	return cert
+}
+
+func (p *testPKI) clientConfig(t *testing.T, agent string) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(p.ca)
+	config := &tls.Config{RootCAs: pool, ServerName: "collector"}
+	if agent != "" {
+		config.Certificates = []tls.Certificate{p.issue(t, agent, x509.ExtKeyUsageClientAuth)}
+	}
+	return config
+}
+
+func (p *testPKI) serverConfig(t *testing.T) *tls.Config {
+	p.issue(t, "collector", x509.ExtKeyUsageServerAuth)
+	config, err := TLSConfig(filepath.Join(p.dir, "collector.pem"), filepath.Join(p.dir, "collector.key"), filepath.Join(p.dir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("TLSConfig() failed: %v", err)
+	}
+	return config
+}
+
+func TestHandler(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	c := NewCollector(Options{})
+	server := httptest.NewUnstartedServer(NewHandler(c, HandlerOptions{Admins: []string{"icinga"}}))
+	server.TLS = pki.serverConfig(t)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	post := func(agent string, body string) int {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: pki.clientConfig(t, agent)}}
+		response, err := client.Post(server.URL+"/v1/reports", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Logf("POST failed: %v", err)
+			return 0
+		}
+		defer response.Body.Close()
+		message, _ := ioutil.ReadAll(response.Body)
+		t.Logf("POST as %q is %d %s", agent, response.StatusCode, bytes.TrimSpace(message))
+		return response.StatusCode
+	}
+
+	data, _ := json.Marshal(report("db1!disk", icinga.ServiceStatusWarning, "85% used"))
+	tests := []struct {
+		agent  string
+		body   string
+		status int
+	}{
+		{"db1", string(data), http.StatusNoContent},
+		{"db2", string(data), http.StatusForbidden},
+		{"db1", `{"source":"db1!disk","status":"BROKEN"}`, http.StatusBadRequest},
+		// the handshake fails without client certificate
+		{"", string(data), 0},
+	}
+	for _, test := range tests {
+		if status := post(test.agent, test.body); status != test.status {
+			t.Errorf("POST as %q should return %d", test.agent, test.status)
+		}
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: pki.clientConfig(t, "icinga")}}
+	for path, expected := range map[string]string{
+		"/v1/reports":          `"source":"db1!disk","agent":"db1"`,
+		"/v1/reports/db1!disk": `"results":[{"name":"check","status":"WARNING","message":"85% used"}]`,
+		"/v1/cluster/disk":     `{"source":"cluster!disk"`,
+	} {
+		response, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		t.Logf("GET %s is %s", path, body)
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("GET %s should contain %s", path, expected)
+		}
+	}
+	if response, err := client.Get(server.URL + "/v1/reports/db9!disk"); err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of an unknown source should return 404")
+	}
+
+	// agents only read the reports of their own host
+	agents := map[string]*http.Client{}
+	for _, agent := range []string{"db1", "db2"} {
+		agents[agent] = &http.Client{Transport: &http.Transport{TLSClientConfig: pki.clientConfig(t, agent)}}
+	}
+	access := []struct {
+		agent  string
+		path   string
+		status int
+		body   string
+	}{
+		{"db1", "/v1/reports/db1!disk", http.StatusOK, `"source":"db1!disk"`},
+		{"db2", "/v1/reports/db1!disk", http.StatusForbidden, "agent db2 may not read reports of db1!disk"},
+		{"db1", "/v1/reports", http.StatusOK, `"source":"db1!disk"`},
+		{"db2", "/v1/reports", http.StatusOK, "[]"},
+		{"db1", "/v1/cluster/disk", http.StatusForbidden, "agent db1 may not read clusters"},
+	}
+	for _, test := range access {
+		response, err := agents[test.agent].Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", test.path, err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		t.Logf("GET %s as %s is %d %s", test.path, test.agent, response.StatusCode, bytes.TrimSpace(body))
+		if response.StatusCode != test.status || !strings.Contains(string(body), test.body) {
+			t.Errorf("GET %s as %s should return %d %s", test.path, test.agent, test.status, test.body)
+		}
+	}
+}
+
+func TestGRPCServer(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	c := NewCollector(Options{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := NewGRPCServer(c, pki.serverConfig(t))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	submit := func(agent string, report *transport.Report) (uint64, error) {
+		conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(pki.clientConfig(t, agent))))
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		stream, err := transport.NewResultClient(conn).Submit(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		stream.Send(report)
+		return stream.Close()
+	}
+
+	accepted, err := submit("db1", report("db1!disk", icinga.ServiceStatusOk, "10% used"))
+	t.Logf("Submit() as db1 is %d, %v", accepted, err)
+	if err != nil || accepted != 1 {
+		t.Errorf("Submit() should accept the report")
+	}
+	if entry, found := c.Entry("db1!disk"); !found || entry.Agent != "db1" {
+		t.Errorf("Submit() should add the report of db1")
+	}
+
+	_, err = submit("db2", report("db1!disk", icinga.ServiceStatusOk, "10% used"))
+	t.Logf("Submit() as db2 is %v", err)
+	if err == nil || !strings.Contains(err.Error(), "PermissionDenied") {
+		t.Errorf("Submit() should reject reports of other hosts")
+	}
+}
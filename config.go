@@ -0,0 +1,309 @@
+package icinga
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Config is a plugin configuration file with profiles
+	Config interface {
+		Profiles() []string
+		Apply(fs *flag.FlagSet, profiles []string) error
+	}
+
+	configImpl struct {
+		path     string
+		base     []option
+		profiles map[string][]option
+		order    []string
+		hosts    map[string][]option
+	}
+)
+
+// LoadConfig reads a TOML or, for files ending with .yaml or .yml, a YAML
+// configuration file. Keys on the top level set the defaults, every table like
+// [prod] is a profile and every table [host.<name>] holds the options of a
+// host. Values are strings, numbers or booleans:
+//
+//	warning = "10"
+//	critical = "20"
+//
+//	[prod]
+//	critical = "15"
+//
+//	[host.db1]
+//	warning = "5"
+//
+// or in YAML:
+//
+//	warning: 10
+//	prod:
+//	  critical: 15
+//	host:
+//	  db1:
+//	    warning: 5
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	c := &configImpl{path: path, profiles: make(map[string][]option), hosts: make(map[string][]option)}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = c.parseYAML(data)
+	default:
+		err = c.parseTOML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ConfigHost returns the host whose [host.<name>] table of a config file is
+// applied, the $HOSTNAME$ macro if set or the name of this host
+func ConfigHost() string {
+	if host, found := lookupMacro("HOSTNAME", os.LookupEnv); found && host != "" {
+		return host
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// parseTOML validates the document by decoding it, the parser provides the
+// order and line numbers of the keys
+func (c *configImpl) parseTOML(data []byte) error {
+	var document map[string]interface{}
+	if err := toml.Unmarshal(data, &document); err != nil {
+		if decodeErr, ok := err.(*toml.DecodeError); ok {
+			line, _ := decodeErr.Position()
+			return fmt.Errorf("%s:%d: %v", c.path, line, decodeErr)
+		}
+		return fmt.Errorf("%s: %v", c.path, err)
+	}
+
+	parser := unstable.Parser{}
+	parser.Reset(data)
+	table := []string{}
+	for parser.NextExpression() {
+		expression := parser.Expression()
+		key, line := tomlKey(&parser, expression.Key())
+		switch expression.Kind {
+		case unstable.Table:
+			table = key
+			if err := c.table(table, line); err != nil {
+				return err
+			}
+		case unstable.ArrayTable:
+			return fmt.Errorf("%s:%d: arrays of tables are not supported", c.path, line)
+		case unstable.KeyValue:
+			if len(key) != 1 {
+				return fmt.Errorf("%s:%d: dotted keys are not supported", c.path, line)
+			}
+			value, err := tomlValue(document, append(table[:len(table):len(table)], key[0]))
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", c.path, line, err)
+			}
+			if err := c.add(table, option{key[0], value, c.path, line}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := parser.Error(); err != nil {
+		return fmt.Errorf("%s: %v", c.path, err)
+	}
+	return nil
+}
+
+// tomlKey returns the parts of a dotted key and its line
+func tomlKey(parser *unstable.Parser, it unstable.Iterator) ([]string, int) {
+	key := []string{}
+	line := 0
+	for it.Next() {
+		if line == 0 {
+			line = parser.Shape(it.Node().Raw).Start.Line
+		}
+		key = append(key, string(it.Node().Data))
+	}
+	return key, line
+}
+
+// tomlValue returns the decoded value of the key as string
+func tomlValue(document map[string]interface{}, key []string) (string, error) {
+	var value interface{} = document
+	for _, name := range key {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("invalid key %s", strings.Join(key, "."))
+		}
+		value = table[name]
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return formatValue(v), nil
+	}
+	return "", fmt.Errorf("only strings, numbers and booleans are supported")
+}
+
+func (c *configImpl) parseYAML(data []byte) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("%s: %v", c.path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	return c.addYAML([]string{}, document.Content[0])
+}
+
+func (c *configImpl) addYAML(table []string, mapping *yaml.Node) error {
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: expected a mapping", c.path, mapping.Line)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if err := c.add(table, option{key.Value, value.Value, c.path, key.Line}); err != nil {
+				return err
+			}
+		case yaml.MappingNode:
+			nested := append(table[:len(table):len(table)], key.Value)
+			if err := c.table(nested, key.Line); err != nil {
+				return err
+			}
+			if err := c.addYAML(nested, value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s:%d: only strings, numbers and booleans are supported", c.path, value.Line)
+		}
+	}
+	return nil
+}
+
+// table registers a profile or host table
+func (c *configImpl) table(table []string, line int) error {
+	switch {
+	case len(table) == 1 && table[0] == "host":
+	case len(table) == 1:
+		if _, found := c.profiles[table[0]]; found {
+			return fmt.Errorf("%s:%d: duplicate profile [%s]", c.path, line, table[0])
+		}
+		c.profiles[table[0]] = []option{}
+		c.order = append(c.order, table[0])
+	case len(table) == 2 && table[0] == "host":
+		if _, found := c.hosts[table[1]]; found {
+			return fmt.Errorf("%s:%d: duplicate host [host.%s]", c.path, line, table[1])
+		}
+		c.hosts[table[1]] = []option{}
+	default:
+		return fmt.Errorf("%s:%d: invalid table [%s], tables are profiles or [host.<name>]", c.path, line, strings.Join(table, "."))
+	}
+	return nil
+}
+
+// add adds an option to the defaults, a profile or a host
+func (c *configImpl) add(table []string, o option) error {
+	var err error
+	switch {
+	case len(table) == 0:
+		c.base, err = appendOption(c.base, o)
+	case len(table) == 1 && table[0] != "host":
+		c.profiles[table[0]], err = appendOption(c.profiles[table[0]], o)
+	case len(table) == 2 && table[0] == "host":
+		c.hosts[table[1]], err = appendOption(c.hosts[table[1]], o)
+	default:
+		err = fmt.Errorf("%s: option %s must be in a profile or [host.<name>]", o.source(), o.name)
+	}
+	return err
+}
+
+func appendOption(options []option, o option) ([]option, error) {
+	for _, existing := range options {
+		if existing.name == o.name {
+			return nil, fmt.Errorf("%s: duplicate option %s", o.source(), o.name)
+		}
+	}
+	return append(options, o), nil
+}
+
+// Profiles returns the names of all profiles in the order of the file
+func (c *configImpl) Profiles() []string {
+	return append([]string{}, c.order...)
+}
+
+// Apply sets all flags of fs which were not given on the command line. The
+// defaults are overlaid by the given profiles in order and the table of the
+// host returned by ConfigHost, later ones win.
+func (c *configImpl) Apply(fs *flag.FlagSet, profiles []string) error {
+	_, err := c.apply(fs, profiles, ConfigHost(), visited(fs))
+	return err
+}
+
+func (c *configImpl) apply(fs *flag.FlagSet, profiles []string, host string, skip map[string]bool) ([]option, error) {
+	layers := [][]option{c.base}
+	for _, profile := range profiles {
+		overlay, found := c.profiles[profile]
+		if !found {
+			return nil, fmt.Errorf("%s: profile [%s] not found, valid profiles are %v", c.path, profile, c.order)
+		}
+		layers = append(layers, overlay)
+	}
+	if overlay, found := c.host(host); found {
+		layers = append(layers, overlay)
+	}
+
+	// aliases like w and warning are the same option, only the last value of
+	// every option is effective
+	effective := []option{}
+	index := make(map[string]int)
+	for _, layer := range layers {
+		names := make(map[string]option)
+		for _, o := range layer {
+			name := canonicalName(fs, o.name)
+			if previous, found := names[name]; found {
+				return nil, fmt.Errorf("%s: option %s is already set as %s", o.source(), o.name, previous.name)
+			}
+			names[name] = o
+			o.name = name
+			if i, found := index[name]; found {
+				effective[i] = o
+				continue
+			}
+			index[name] = len(effective)
+			effective = append(effective, o)
+		}
+	}
+	return applyOptions(fs, effective, skip)
+}
+
+// host returns the options of the host, a fully qualified name also matches
+// its short name
+func (c *configImpl) host(name string) ([]option, bool) {
+	if options, found := c.hosts[name]; found {
+		return options, true
+	}
+	if dot := strings.Index(name, "."); dot > 0 {
+		options, found := c.hosts[name[:dot]]
+		return options, found
+	}
+	return nil, false
+}
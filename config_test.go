@@ -0,0 +1,161 @@
+package icinga
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %v: %v", path, err)
+	}
+	return path
+}
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-config")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	toml := writeTestFile(t, dir, "check_foo.toml", `# defaults
+server = "db1"
+port = 5432
+tls = true
+w = "10"
+
+[prod]
+port = 6_432 # pgbouncer
+server = 'db-prod'
+
+[host.db2]
+server = "db2 \"primary\""
+warning = "5"
+`)
+	yaml := writeTestFile(t, dir, "check_foo.yaml", `# defaults
+server: db1
+port: 5432
+tls: true
+w: "10"
+
+prod:
+  port: 6432 # pgbouncer
+  server: 'db-prod'
+
+host:
+  db2:
+    server: db2 "primary"
+    warning: "5"
+`)
+
+	tests := []struct {
+		args     []string
+		profiles []string
+		host     string
+		server   string
+		port     int
+		warning  string
+	}{
+		{nil, nil, "", "db1", 5432, "10"},
+		{nil, []string{"prod"}, "db1", "db-prod", 6432, "10"},
+		{nil, []string{"prod"}, "db2", `db2 "primary"`, 6432, "5"},
+		{nil, nil, "db2.example.com", `db2 "primary"`, 5432, "5"},
+		{[]string{"-port", "1", "-warning", "1"}, []string{"prod"}, "db2", `db2 "primary"`, 1, "1"},
+	}
+	for _, path := range []string{toml, yaml} {
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("LoadConfig(%v) failed: %v", path, err)
+		}
+		if profiles := config.Profiles(); len(profiles) != 1 || profiles[0] != "prod" {
+			t.Errorf("Profiles() of %v should be [prod] but is %v", path, profiles)
+		}
+
+		for _, test := range tests {
+			fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+			server := fs.String("server", "", "server")
+			port := fs.Int("port", 0, "port")
+			tls := fs.Bool("tls", false, "tls")
+			warning, _ := NewRangeValue("")
+			fs.Var(warning, "w", "warning threshold")
+			fs.Var(warning, "warning", "warning threshold")
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatalf("failed to parse flags: %v", err)
+			}
+			if _, err := config.(*configImpl).apply(fs, test.profiles, test.host, visited(fs)); err != nil {
+				t.Fatalf("apply(%v, %v) of %v failed: %v", test.profiles, test.host, path, err)
+			}
+			t.Logf("apply(%v, %v, %v) of %v is server=%v port=%v tls=%v warning=%v", test.args, test.profiles, test.host, path, *server, *port, *tls, warning)
+			if *server != test.server || *port != test.port || !*tls || warning.String() != test.warning {
+				t.Errorf("apply(%v, %v, %v) of %v should be server=%v port=%v tls=true warning=%v", test.args, test.profiles, test.host, path, test.server, test.port, test.warning)
+			}
+		}
+
+		fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+		if err := config.Apply(fs, []string{"staging"}); err == nil {
+			t.Errorf("Apply() of %v should fail for unknown profiles", path)
+		}
+	}
+}
+
+func TestConfigHost(t *testing.T) {
+	defer os.Unsetenv("ICINGA_HOSTNAME")
+	os.Setenv("ICINGA_HOSTNAME", "db1")
+	if host := ConfigHost(); host != "db1" {
+		t.Errorf("ConfigHost() should be the $HOSTNAME$ macro db1 but is %v", host)
+	}
+	os.Unsetenv("ICINGA_HOSTNAME")
+	if hostname, _ := os.Hostname(); ConfigHost() != hostname {
+		t.Errorf("ConfigHost() should be %v", hostname)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-config")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		content  string
+		errorMsg string
+	}{
+		{"config.toml", "warning = \"10\"\n\n[prod\n", ":3: "},
+		{"config.toml", "warning\n", ":1: "},
+		{"config.toml", "warning = \"10\n", ":1: "},
+		{"config.toml", "warning = [1, 2]\n", ":1: only strings, numbers and booleans are supported"},
+		{"config.toml", "[prod]\n[prod]\n", ":2: "},
+		{"config.toml", "[[prod]]\n", ":1: arrays of tables are not supported"},
+		{"config.toml", "[a.b]\n", ":1: invalid table [a.b], tables are profiles or [host.<name>]"},
+		{"config.toml", "[host]\nwarning = \"10\"\n", ":2: option warning must be in a profile or [host.<name>]"},
+		{"config.toml", "warning = \"20:10\"\n", ":1: invalid value for warning: invalid range \"20:10\": Invalid range definition. min <= max violated"},
+		{"config.toml", "# comment\nunknown = 1\n", ":2: unknown option \"unknown\""},
+		{"config.toml", "w = \"10\"\nwarning = \"20\"\n", ":2: option warning is already set as w"},
+		{"config.yaml", "warning: 10\nprod: [1, 2]\n", ":2: only strings, numbers and booleans are supported"},
+		{"config.yaml", "prod:\n  warning: 1\n  warning: 2\n", ":3: duplicate option warning"},
+		{"config.yaml", "warning: \"10\n", ": yaml: line "},
+	}
+	for i, test := range tests {
+		path := writeTestFile(t, dir, test.name, test.content)
+		config, err := LoadConfig(path)
+		if err == nil {
+			warning, _ := NewRangeValue("")
+			fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+			fs.Var(warning, "w", "warning threshold")
+			fs.Var(warning, "warning", "warning threshold")
+			_, err = config.(*configImpl).apply(fs, nil, "", nil)
+		}
+		t.Logf("test %d: %v", i, err)
+		if err == nil || !strings.HasPrefix(err.Error(), path+test.errorMsg) {
+			t.Errorf("test %d should fail with %v", i, path+test.errorMsg)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package icinga
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+)
+
+// ApplyEnv sets all flags of fs which were not given on the command line
+// from environment variables. For the flag extra-opts of the plugin check_foo
+// CHECK_FOO_EXTRA_OPTS is used. The standard plugin options like warning can
+// also be set for all plugins, e.g. with ICINGA_WARNING, other options not,
+// so Icinga macros like ICINGA_HOSTNAME don't set a hostname option. Only
+// long names are bound. Aliases like w, options which widen a sandbox and the
+// debugging options show-config, repeat and interval, which change the exit
+// code and output, are never set from the environment. Faults may be
+// injected with ICINGA_INJECT_FAULT, PluginOptions only accept them for
+// plugins listed in FaultInjectionAllowFile.
+func ApplyEnv(fs *flag.FlagSet, plugin string) error {
+	_, err := applyEnv(fs, plugin, os.LookupEnv, visited(fs))
+	return err
+}
+
+// envShared are the options which may be set with the ICINGA_ prefix
+var envShared = map[string]bool{
+	"warning":           true,
+	"critical":          true,
+	"timeout":           true,
+	"stream-timeout":    true,
+	"verbose":           true,
+	"extra-opts":        true,
+	"output":            true,
+	"config":            true,
+	"profile":           true,
+	"config-host":       true,
+	"locale":            true,
+	"translate-summary": true,
+	"log-sink":          true,
+	"inject-fault":      true,
+}
+
+// envIgnored are the options which are never set from the environment
+var envIgnored = map[string]bool{
+	"allow-file":    true,
+	"allow-url":     true,
+	"allow-command": true,
+	"module":        true,
+	"script":        true,
+	"show-config":   true,
+	"repeat":        true,
+	"interval":      true,
+}
+
+func applyEnv(fs *flag.FlagSet, plugin string, lookup func(string) (string, bool), skip map[string]bool) ([]option, error) {
+	options := []option{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) < 2 || envIgnored[f.Name] || canonicalName(fs, f.Name) != f.Name {
+			return
+		}
+		prefixes := []string{}
+		if plugin != "" {
+			prefixes = append(prefixes, envName(plugin)+"_")
+		}
+		if envShared[f.Name] {
+			prefixes = append(prefixes, "ICINGA_")
+		}
+		for _, prefix := range prefixes {
+			name := prefix + envName(f.Name)
+			if value, found := lookup(name); found {
+				options = append(options, option{f.Name, value, "environment variable " + name, 0})
+				return
+			}
+		}
+	})
+	return applyOptions(fs, options, skip)
+}
+
+// envName converts a name to an environment variable name, e.g. extra-opts to
+// EXTRA_OPTS
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// ExpandMacros replaces Icinga style macros like $HOSTNAME$ or $SERVICEDESC$
+// with the environment variable ICINGA_HOSTNAME or, if not set, the Nagios
+// environment macro NAGIOS_HOSTNAME. $$ is replaced with $, unknown macros
+// are kept.
+func ExpandMacros(text string) string {
+	return expandMacros(text, os.LookupEnv)
+}
+
+func expandMacros(text string, lookup func(string) (string, bool)) string {
+	var buffer bytes.Buffer
+	for {
+		start := strings.Index(text, "$")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+1:], "$")
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		buffer.WriteString(text[:start])
+
+		macro := text[start+1 : end]
+		switch {
+		case macro == "":
+			buffer.WriteString("$")
+		case strings.ContainsAny(macro, " \t\n"):
+			// not a macro, keep the first $ and continue after it
+			buffer.WriteString("$")
+			text = text[start+1:]
+			continue
+		default:
+			if value, found := lookupMacro(macro, lookup); found {
+				buffer.WriteString(value)
+			} else {
+				buffer.WriteString(text[start : end+1])
+			}
+		}
+		text = text[end+1:]
+	}
+	buffer.WriteString(text)
+	return buffer.String()
+}
+
+func lookupMacro(macro string, lookup func(string) (string, bool)) (string, bool) {
+	for _, prefix := range []string{"ICINGA_", "NAGIOS_"} {
+		if value, found := lookup(prefix + envName(macro)); found {
+			return value, true
+		}
+	}
+	return "", false
+}
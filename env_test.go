@@ -0,0 +1,118 @@
+package icinga
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"CHECK_FOO_HOST":        "db1",
+		"ICINGA_HOST":           "db2",
+		"ICINGA_HOSTNAME":       "macro",
+		"CHECK_FOO_PORT":        "5432",
+		"CHECK_FOO_EXTRA":       "x",
+		"ICINGA_WARNING":        "10",
+		"CHECK_BAR_WARNING":     "20",
+		"CHECK_FOO_W":           "30",
+		"CHECK_FOO_ALLOW_FILE":  "/etc/shadow",
+		"ICINGA_INJECT_FAULT":   "panic",
+		"CHECK_FOO_SHOW_CONFIG": "true",
+		"CHECK_FOO_REPEAT":      "5",
+		"CHECK_FOO_INTERVAL":    "1m",
+	}
+	lookup := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+
+	tests := []struct {
+		plugin  string
+		args    []string
+		host    string
+		port    int
+		warning string
+	}{
+		{"check_foo", nil, "db1", 5432, "10"},
+		{"check-foo", []string{"-host", "db3"}, "db3", 5432, "10"},
+		{"check_bar", nil, "", 0, "20"},
+		{"", []string{"-port", "1"}, "", 1, "10"},
+	}
+	for _, test := range tests {
+		fs := flag.NewFlagSet(test.plugin, flag.ContinueOnError)
+		host := fs.String("host", "", "host")
+		fs.String("hostname", "", "hostname")
+		port := fs.Int("port", 0, "port")
+		fs.String("extra", "", "extra")
+		allowFile := fs.String("allow-file", "", "allowed files")
+		fault := fs.String("inject-fault", "", "fault")
+		showConfig := fs.Bool("show-config", false, "show config")
+		repeat := fs.Int("repeat", 0, "repeat")
+		interval := fs.Duration("interval", time.Second, "interval")
+		warning := fs.String("warning", "", "warning")
+		fs.Var(fs.Lookup("warning").Value, "w", "warning")
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatalf("failed to parse flags: %v", err)
+		}
+
+		_, err := applyEnv(fs, test.plugin, lookup, visited(fs))
+		t.Logf("applyEnv(%v, %v) is %v: host=%v port=%v warning=%v", test.plugin, test.args, err, *host, *port, *warning)
+		if err != nil {
+			t.Errorf("applyEnv(%v) should not fail: %v", test.plugin, err)
+		}
+		if *host != test.host || *port != test.port || *warning != test.warning {
+			t.Errorf("applyEnv(%v) should set host=%v port=%v warning=%v", test.plugin, test.host, test.port, test.warning)
+		}
+		if fs.Lookup("hostname").Value.String() != "" || *allowFile != "" {
+			t.Errorf("applyEnv(%v) should not set hostname or allow-file", test.plugin)
+		}
+		// faults are checked against the allow-list by PluginOptions
+		if *fault != "panic" {
+			t.Errorf("applyEnv(%v) should set inject-fault", test.plugin)
+		}
+		if *showConfig || *repeat != 0 || *interval != time.Second {
+			t.Errorf("applyEnv(%v) should not set show-config, repeat or interval", test.plugin)
+		}
+	}
+
+	fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+	fs.Int("host", 0, "host")
+	_, err := applyEnv(fs, "check_foo", lookup, visited(fs))
+	t.Logf("applyEnv with invalid value is %v", err)
+	if err == nil || err.Error() != `environment variable CHECK_FOO_HOST: invalid value for host: parse error` {
+		t.Errorf("applyEnv with invalid value should fail with the variable name")
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	env := map[string]string{
+		"ICINGA_HOSTNAME":    "db1",
+		"NAGIOS_HOSTNAME":    "nagios",
+		"NAGIOS_SERVICEDESC": "disk",
+	}
+	lookup := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"", ""},
+		{"no macros", "no macros"},
+		{"$HOSTNAME$/$SERVICEDESC$", "db1/disk"},
+		{"$UNKNOWN$ $HOSTNAME$", "$UNKNOWN$ db1"},
+		{"costs 5$$", "costs 5$"},
+		{"5$ and $HOSTNAME$", "5$ and db1"},
+		{"$HOSTNAME", "$HOSTNAME"},
+	}
+	for _, test := range tests {
+		result := expandMacros(test.text, lookup)
+		t.Logf("expandMacros(%q) is %q", test.text, result)
+		if result != test.expected {
+			t.Errorf("expandMacros(%q) should be %q", test.text, test.expected)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package icinga
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// CommandRule allows to run a binary with arguments matching the
+	// patterns. Path must be absolute, every argument must fully match the
+	// regular expression at the same position.
+	CommandRule struct {
+		Path string
+		Args []string
+	}
+
+	// ResourceLimits are applied to every command, zero values are ignored.
+	// The limits are set with setrlimit(2) by the re-executed plugin binary
+	// before it execs the command, its main has to call
+	// RunResourceLimitsHelper. They are only supported on linux and not in
+	// setuid or capability-bearing processes.
+	ResourceLimits struct {
+		// CPUTime is the maximum CPU time in seconds
+		CPUTime uint64
+		// Memory is the maximum size of the address space in bytes, or the
+		// memory.max of the cgroup if Cgroup is set
+		Memory uint64
+		// Files is the maximum number of open files
+		Files uint64
+		// Processes is the pids.max of the cgroup, it requires Cgroup
+		Processes uint64
+		// Cgroup is a cgroup v2 directory delegated to the plugin user with
+		// the memory and pids controllers enabled. Every command runs in its
+		// own cgroup below it, which is removed with all remaining processes
+		// when the command exits.
+		Cgroup string
+	}
+
+	// ExecutorOptions options to generate a new Executor
+	ExecutorOptions struct {
+		Rules []CommandRule
+		// Env is the complete environment of the commands, defaults to
+		// DefaultCommandEnv
+		Env []string
+		// Timeout defaults to DefaultTimeout, the deadline of the context
+		// passed to Run applies as well
+		Timeout time.Duration
+		// MaxOutput limits stdout and stderr each, defaults to 1 MiB
+		MaxOutput int
+		Limits    ResourceLimits
+	}
+
+	// Executor runs allow-listed external commands
+	Executor interface {
+		Run(ctx context.Context, path string, args ...string) ([]byte, error)
+	}
+
+	// CommandError describes why a command failed
+	CommandError struct {
+		Path     string
+		Args     []string
+		Reason   string
+		ExitCode int
+		Stderr   string
+	}
+
+	// CommandRequest are the params of CommandOperation
+	CommandRequest struct {
+		Path string   `json:"path"`
+		Args []string `json:"args"`
+	}
+
+	// CommandResponse is the result of CommandOperation
+	CommandResponse struct {
+		Output []byte `json:"output"`
+	}
+
+	executorImpl struct {
+		options ExecutorOptions
+		rules   map[string][][]*regexp.Regexp
+	}
+
+	// limitedBuffer keeps up to max bytes and calls exceeded once more
+	// bytes are written
+	limitedBuffer struct {
+		sync.Mutex
+		buffer   bytes.Buffer
+		max      int
+		exceeded func()
+		overflow bool
+	}
+)
+
+const (
+	// CommandNotAllowed the command doesn't match any rule
+	CommandNotAllowed = "not allowed"
+	// CommandTimeout the command was killed after the timeout
+	CommandTimeout = "timeout"
+	// CommandOutputLimit the command was killed after exceeding MaxOutput
+	CommandOutputLimit = "output limit exceeded"
+	// CommandFailed the command couldn't be started or exited non-zero
+	CommandFailed = "failed"
+)
+
+// DefaultCommandEnv is the environment of commands if none is configured
+var DefaultCommandEnv = []string{
+	"PATH=/usr/sbin:/usr/bin:/sbin:/bin",
+	"LC_ALL=C",
+}
+
+// NewExecutor creates an Executor for the given rules
+func NewExecutor(options ExecutorOptions) (Executor, error) {
+	if options.Env == nil {
+		options.Env = DefaultCommandEnv
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.MaxOutput <= 0 {
+		options.MaxOutput = 1024 * 1024
+	}
+
+	rules := make(map[string][][]*regexp.Regexp)
+	for _, rule := range options.Rules {
+		if !filepath.IsAbs(rule.Path) {
+			return nil, fmt.Errorf("command path %q must be absolute", rule.Path)
+		}
+		patterns := []*regexp.Regexp{}
+		for _, arg := range rule.Args {
+			pattern, err := regexp.Compile("^(?:" + arg + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid argument pattern %q for %s: %v", arg, rule.Path, err)
+			}
+			patterns = append(patterns, pattern)
+		}
+		path := filepath.Clean(rule.Path)
+		rules[path] = append(rules[path], patterns)
+	}
+	return &executorImpl{options, rules}, nil
+}
+
+// Run runs an allowed command and returns its stdout. All failures are
+// returned as *CommandError.
+func (e *executorImpl) Run(ctx context.Context, path string, args ...string) ([]byte, error) {
+	cmd, err := e.command(path, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.options.Timeout)
+	defer cancel()
+
+	var limitExceeded bool
+	var once sync.Once
+	kill := func() {
+		once.Do(func() {
+			limitExceeded = true
+			cancel()
+		})
+	}
+	stdout := &limitedBuffer{max: e.options.MaxOutput, exceeded: kill}
+	stderr := &limitedBuffer{max: e.options.MaxOutput, exceeded: kill}
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, &CommandError{Path: path, Args: args, Reason: CommandFailed, ExitCode: -1, Stderr: err.Error()}
+	}
+	defer releaseCommand(cmd, e.options.Limits)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	killed := false
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killCommand(cmd)
+		killed = true
+		err = <-done
+	}
+
+	commandErr := &CommandError{Path: path, Args: args, ExitCode: -1, Stderr: stderr.String()}
+	switch {
+	case limitExceeded:
+		commandErr.Reason = CommandOutputLimit
+	case killed:
+		commandErr.Reason = CommandTimeout
+	case err != nil:
+		commandErr.Reason = CommandFailed
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			commandErr.ExitCode = exitErr.ExitCode()
+		}
+	default:
+		return stdout.Bytes(), nil
+	}
+	return stdout.Bytes(), commandErr
+}
+
+// command returns the allowed command with the environment and resource
+// limits of the executor, errors are returned as *CommandError
+func (e *executorImpl) command(path string, args []string) (*exec.Cmd, error) {
+	if !e.allowed(path, args) {
+		return nil, &CommandError{Path: path, Args: args, Reason: CommandNotAllowed, ExitCode: -1}
+	}
+	cmd := exec.Command(filepath.Clean(path), args...)
+	cmd.Env = e.options.Env
+	cmd.Dir = "/"
+	prepareCommand(cmd)
+	if err := limitCommand(cmd, e.options.Limits); err != nil {
+		return nil, &CommandError{Path: path, Args: args, Reason: CommandFailed, ExitCode: -1, Stderr: err.Error()}
+	}
+	return cmd, nil
+}
+
+func (e *executorImpl) allowed(path string, args []string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	for _, patterns := range e.rules[filepath.Clean(path)] {
+		if len(patterns) != len(args) {
+			continue
+		}
+		matched := true
+		for i, pattern := range patterns {
+			matched = matched && pattern.MatchString(args[i])
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *CommandError) Error() string {
+	command := strings.TrimSpace(e.Path + " " + strings.Join(e.Args, " "))
+	message := fmt.Sprintf("command %s %s", command, e.Reason)
+	if e.ExitCode > 0 {
+		message = fmt.Sprintf("%s with exit code %d", message, e.ExitCode)
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		message = fmt.Sprintf("%s: %s", message, stderr)
+	}
+	return message
+}
+
+// Result returns an UNKNOWN Result describing the failure
+func (e *CommandError) Result(name string) Result {
+	return NewResultUnknownMessage(name, e.Error())
+}
+
+// CommandResult returns an UNKNOWN Result for an error returned by an
+// Executor
+func CommandResult(name string, err error) Result {
+	if commandErr, ok := err.(*CommandError); ok {
+		return commandErr.Result(name)
+	}
+	return NewResultUnknownMessage(name, err.Error())
+}
+
+// CommandOperation returns a privileged helper operation which runs commands
+// through the given Executor
+func CommandOperation(executor Executor) PrivilegedOperation {
+	return func(params json.RawMessage) (interface{}, error) {
+		var request CommandRequest
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid params: %v", err)
+		}
+		output, err := executor.Run(context.Background(), request.Path, request.Args...)
+		if err != nil {
+			return nil, err
+		}
+		return CommandResponse{output}, nil
+	}
+}
+
+// PrivilegedCommand runs a command through the "command" operation of a helper
+func PrivilegedCommand(client PrivilegedClient, path string, args ...string) ([]byte, error) {
+	var response CommandResponse
+	if err := client.Call("command", CommandRequest{path, args}, &response); err != nil {
+		return nil, err
+	}
+	return response.Output, nil
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	if remaining := b.max - b.buffer.Len(); len(p) > remaining {
+		b.buffer.Write(p[:remaining])
+		if !b.overflow {
+			b.overflow = true
+			b.exceeded()
+		}
+		return len(p), nil
+	}
+	return b.buffer.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return string(b.Bytes())
+}
@@ -0,0 +1,217 @@
+package icinga
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// resourceLimitsHelper is argv[0] of the re-executed binary which sets the
+// resource limits and execs the command
+const resourceLimitsHelper = "icinga-resource-limits"
+
+// atSecure is the auxiliary vector entry set for setuid and capability-bearing
+// processes
+const atSecure = 23
+
+// cgroup2Magic is the file system type of cgroup v2, see statfs(2)
+const cgroup2Magic = 0x63677270
+
+// helperEnabled is set by RunResourceLimitsHelper, without it the re-executed
+// binary would run the plugin instead of the command
+var helperEnabled bool
+
+// RunResourceLimitsHelper has to be called first in main by plugins which run
+// commands with ResourceLimits. If the binary was re-executed by an Executor,
+// it sets the limits and execs the command instead of returning. Executors
+// refuse resource limits unless it was called.
+func RunResourceLimitsHelper() {
+	helperEnabled = true
+	if len(os.Args) > 0 && os.Args[0] == resourceLimitsHelper {
+		os.Exit(runResourceLimitsHelper(os.Args[1:]))
+	}
+}
+
+// prepareCommand starts the command in its own process group, so that child
+// processes are killed as well
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killCommand kills the process group of the command
+func killCommand(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// limitCommand runs the command through this binary re-executed as
+// resourceLimitsHelper, which sets the limits with setrlimit(2), moves itself
+// into the cgroup of the command and then execs the command, so the limits
+// apply before the command runs
+func limitCommand(cmd *exec.Cmd, limits ResourceLimits) error {
+	if limits == (ResourceLimits{}) {
+		return nil
+	}
+	if !helperEnabled {
+		return errors.New("resource limits require icinga.RunResourceLimitsHelper in main")
+	}
+	if secureExec() {
+		return errors.New("resource limits are not supported in setuid or capability-bearing processes")
+	}
+	if limits.Processes > 0 && limits.Cgroup == "" {
+		return errors.New("the process limit requires a cgroup")
+	}
+	if limits.Cgroup != "" {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(limits.Cgroup, &fs); err != nil {
+			return fmt.Errorf("failed to check cgroup: %v", err)
+		}
+		if fs.Type != cgroup2Magic {
+			return fmt.Errorf("%s is not a cgroup v2 directory", limits.Cgroup)
+		}
+	}
+	cmd.Args = append([]string{
+		resourceLimitsHelper,
+		strconv.FormatUint(limits.CPUTime, 10),
+		strconv.FormatUint(limits.Memory, 10),
+		strconv.FormatUint(limits.Files, 10),
+		strconv.FormatUint(limits.Processes, 10),
+		limits.Cgroup,
+	}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
+
+// releaseCommand kills the processes left in the cgroup of the command and
+// removes the cgroup
+func releaseCommand(cmd *exec.Cmd, limits ResourceLimits) {
+	if limits.Cgroup == "" || cmd.Process == nil {
+		return
+	}
+	dir := commandCgroup(limits.Cgroup, cmd.Process.Pid)
+	ioutil.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644)
+	// the cgroup can only be removed once the killed processes are gone
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// commandCgroup returns the cgroup of the command with the process id pid
+func commandCgroup(parent string, pid int) string {
+	return filepath.Join(parent, "icinga-"+strconv.Itoa(pid))
+}
+
+// joinCgroup creates the cgroup of the current process below the delegated
+// parent, sets memory.max and pids.max and moves the process into it
+func joinCgroup(parent string, limits ResourceLimits) error {
+	dir := commandCgroup(parent, os.Getpid())
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cgroup: %v", err)
+	}
+	for _, limit := range []struct {
+		file  string
+		value uint64
+	}{
+		{"memory.max", limits.Memory},
+		{"pids.max", limits.Processes},
+		{"cgroup.procs", uint64(os.Getpid())},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, limit.file), []byte(strconv.FormatUint(limit.value, 10)), 0644); err != nil {
+			return fmt.Errorf("failed to set cgroup %s: %v", limit.file, err)
+		}
+	}
+	return nil
+}
+
+// runResourceLimitsHelper sets the limits and execs the command given as
+// "cpu memory files processes cgroup path args...", it only returns on
+// failure
+func runResourceLimitsHelper(args []string) int {
+	// the helper would allow to run any command with the privileges of a
+	// setuid binary
+	if secureExec() {
+		fmt.Fprintf(os.Stderr, "%s must not run setuid or with capabilities\n", resourceLimitsHelper)
+		return 126
+	}
+	if len(args) < 6 {
+		fmt.Fprintf(os.Stderr, "usage: %s cpu memory files processes cgroup path [args...]\n", resourceLimitsHelper)
+		return 126
+	}
+	var values [4]uint64
+	for i := range values {
+		value, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid resource limit %q: %v\n", args[i], err)
+			return 126
+		}
+		values[i] = value
+	}
+	limits := ResourceLimits{CPUTime: values[0], Memory: values[1], Files: values[2], Processes: values[3], Cgroup: args[4]}
+	if limits.Cgroup != "" {
+		if err := joinCgroup(limits.Cgroup, limits); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 126
+		}
+		// the memory of the cgroup is limited instead of the address space
+		limits.Memory = 0
+	}
+	if err := setResourceLimits(limits); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 126
+	}
+	err := syscall.Exec(args[5], args[5:], os.Environ())
+	fmt.Fprintf(os.Stderr, "failed to execute %s: %v\n", args[5], err)
+	return 127
+}
+
+// setResourceLimits sets the limits of the current process
+func setResourceLimits(limits ResourceLimits) error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, limits.CPUTime},
+		{syscall.RLIMIT_AS, limits.Memory},
+		{syscall.RLIMIT_NOFILE, limits.Files},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, &rlimit); err != nil {
+			return fmt.Errorf("failed to set resource limit: %v", err)
+		}
+	}
+	return nil
+}
+
+// secureExec returns true if the process was started setuid, setgid or with
+// file capabilities, or if that can't be determined
+func secureExec() bool {
+	if os.Getuid() != os.Geteuid() || os.Getgid() != os.Getegid() {
+		return true
+	}
+	auxv, err := ioutil.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return true
+	}
+	size := int(unsafe.Sizeof(uintptr(0)))
+	for i := 0; i+2*size <= len(auxv); i += 2 * size {
+		if *(*uintptr)(unsafe.Pointer(&auxv[i])) == atSecure {
+			return *(*uintptr)(unsafe.Pointer(&auxv[i+size])) != 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+// +build !linux
+
+package icinga
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// RunResourceLimitsHelper is a no-op on this platform, resource limits are
+// only supported on linux
+func RunResourceLimitsHelper() {
+}
+
+// prepareCommand is a no-op on this platform
+func prepareCommand(cmd *exec.Cmd) {
+}
+
+// killCommand kills the command
+func killCommand(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// limitCommand is only supported on linux
+func limitCommand(cmd *exec.Cmd, limits ResourceLimits) error {
+	if limits != (ResourceLimits{}) {
+		return errors.New("resource limits are not supported on this platform")
+	}
+	return nil
+}
+
+// releaseCommand is a no-op on this platform
+func releaseCommand(cmd *exec.Cmd, limits ResourceLimits) {
+}
@@ -0,0 +1,148 @@
+package icinga
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// the resource limits of TestExecutor re-execute the test binary
+	RunResourceLimitsHelper()
+	os.Exit(m.Run())
+}
+
+func TestExecutor(t *testing.T) {
+	e, err := NewExecutor(ExecutorOptions{
+		Rules: []CommandRule{
+			{Path: "/bin/echo", Args: []string{"hello", "[a-z]+"}},
+			{Path: "/usr/bin/env"},
+			{Path: "/bin/sh", Args: []string{"-c", "exit 3|sleep 5|ulimit -n|yes"}},
+		},
+		Timeout:   500 * time.Millisecond,
+		MaxOutput: 1024,
+		Limits:    ResourceLimits{Files: 42},
+	})
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		args     []string
+		output   string
+		reason   string
+		exitCode int
+	}{
+		{"/bin/echo", []string{"hello", "world"}, "hello world\n", "", 0},
+		{"/bin/echo", []string{"hello", "World"}, "", CommandNotAllowed, -1},
+		{"/bin/echo", []string{"hello"}, "", CommandNotAllowed, -1},
+		{"/bin/../bin/echo", []string{"hello", "world"}, "hello world\n", "", 0},
+		{"echo", []string{"hello", "world"}, "", CommandNotAllowed, -1},
+		{"/bin/cat", []string{"/etc/shadow"}, "", CommandNotAllowed, -1},
+		{"/usr/bin/env", nil, strings.Join(DefaultCommandEnv, "\n") + "\n", "", 0},
+		{"/bin/sh", []string{"-c", "exit 3"}, "", CommandFailed, 3},
+		{"/bin/sh", []string{"-c", "sleep 5"}, "", CommandTimeout, -1},
+		{"/bin/sh", []string{"-c", "yes"}, strings.Repeat("y\n", 512), CommandOutputLimit, -1},
+	}
+	if runtime.GOOS == "linux" {
+		tests = append(tests, struct {
+			path     string
+			args     []string
+			output   string
+			reason   string
+			exitCode int
+		}{"/bin/sh", []string{"-c", "ulimit -n"}, "42\n", "", 0})
+	}
+
+	for _, test := range tests {
+		output, err := e.Run(context.Background(), test.path, test.args...)
+		t.Logf("Run(%v, %v) is %q, %v", test.path, test.args, output, err)
+		if string(output) != test.output && test.reason != CommandOutputLimit {
+			t.Errorf("Run(%v, %v) output should be %q", test.path, test.args, test.output)
+		}
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("Run(%v, %v) should not fail", test.path, test.args)
+			}
+			continue
+		}
+
+		commandErr, ok := err.(*CommandError)
+		if !ok {
+			t.Errorf("Run(%v, %v) should fail with a CommandError", test.path, test.args)
+			continue
+		}
+		if commandErr.Reason != test.reason || commandErr.ExitCode != test.exitCode {
+			t.Errorf("Run(%v, %v) should fail with %v and exit code %d", test.path, test.args, test.reason, test.exitCode)
+		}
+		if len(output) > 1024 {
+			t.Errorf("Run(%v, %v) output should be limited", test.path, test.args)
+		}
+		if result := CommandResult("command", err); result.Status() != ServiceStatusUnknown {
+			t.Errorf("CommandResult() should be %v", ServiceStatusUnknown)
+		}
+	}
+}
+
+func TestExecutorResourceLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only supported on linux")
+	}
+	rules := []CommandRule{{Path: "/bin/cat", Args: []string{"/proc/self/cgroup"}}}
+	tests := []struct {
+		limits   ResourceLimits
+		errorMsg string
+	}{
+		{ResourceLimits{Processes: 10}, "the process limit requires a cgroup"},
+		{ResourceLimits{Cgroup: os.TempDir()}, "is not a cgroup v2 directory"},
+		{ResourceLimits{Cgroup: "/nonexistent"}, "failed to check cgroup"},
+	}
+	for _, test := range tests {
+		e, _ := NewExecutor(ExecutorOptions{Rules: rules, Limits: test.limits})
+		_, err := e.Run(context.Background(), "/bin/cat", "/proc/self/cgroup")
+		t.Logf("Run() with %+v is %v", test.limits, err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Run() with %+v should fail with: %v", test.limits, test.errorMsg)
+		}
+	}
+
+	helperEnabled = false
+	e, _ := NewExecutor(ExecutorOptions{Rules: rules, Limits: ResourceLimits{Files: 42}})
+	_, err := e.Run(context.Background(), "/bin/cat", "/proc/self/cgroup")
+	helperEnabled = true
+	if err == nil || !strings.Contains(err.Error(), "RunResourceLimitsHelper") {
+		t.Errorf("Run() should refuse resource limits without RunResourceLimitsHelper but is %v", err)
+	}
+
+	// the tests need to manage a cgroup v2 hierarchy, memory and pids are
+	// only limited if the controllers are available
+	root := "/sys/fs/cgroup"
+	if _, err := os.Stat(filepath.Join(root, "cgroup.subtree_control")); err != nil {
+		root = "/sys/fs/cgroup/unified"
+	}
+	cgroup, err := ioutil.TempDir(root, "icinga-test")
+	if err != nil {
+		t.Skipf("cgroup v2 is not delegated: %v", err)
+	}
+	defer os.Remove(cgroup)
+	limits := ResourceLimits{Cgroup: cgroup}
+	if ioutil.WriteFile(filepath.Join(cgroup, "cgroup.subtree_control"), []byte("+memory +pids"), 0644) == nil {
+		limits.Memory = 64 << 20
+		limits.Processes = 10
+	}
+	e, _ = NewExecutor(ExecutorOptions{Rules: rules, Limits: limits})
+	output, err := e.Run(context.Background(), "/bin/cat", "/proc/self/cgroup")
+	t.Logf("Run() with %+v is %q, %v", limits, output, err)
+	if err != nil || !strings.Contains(string(output), filepath.Base(cgroup)+"/icinga-") {
+		t.Errorf("Run() should run the command in a cgroup below %s", cgroup)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(cgroup, "icinga-*")); len(entries) > 0 {
+		t.Errorf("Run() should remove the cgroup of the command but found %v", entries)
+	}
+}
@@ -0,0 +1,191 @@
+package icinga
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+type (
+	// option is a single name/value pair read from a file or environment
+	// variable, line is 0 for environment variables
+	option struct {
+		name  string
+		value string
+		file  string
+		line  int
+	}
+)
+
+// source returns where the option was read from
+func (o option) source() string {
+	if o.line == 0 {
+		return o.file
+	}
+	return fmt.Sprintf("%s:%d", o.file, o.line)
+}
+
+// ExtraOptsPaths are searched if --extra-opts doesn't name a file
+var ExtraOptsPaths = []string{
+	"/etc/nagios/plugins.ini",
+	"/usr/local/nagios/etc/plugins.ini",
+	"/usr/local/etc/nagios/plugins.ini",
+	"/etc/opt/nagios/plugins.ini",
+	"/etc/nagios-plugins.ini",
+	"/usr/local/etc/nagios-plugins.ini",
+	"/etc/opt/nagios-plugins.ini",
+	"/etc/icinga2/plugins.ini",
+}
+
+// ApplyExtraOpts reads options from an ini file and sets all flags of fs which
+// were not given on the command line. value has the form [section][@file] like
+// the --extra-opts option of the Nagios plugins, the section defaults to the
+// plugin name.
+func ApplyExtraOpts(fs *flag.FlagSet, value string, plugin string) error {
+	_, err := applyExtraOpts(fs, value, plugin, visited(fs))
+	return err
+}
+
+func applyExtraOpts(fs *flag.FlagSet, value string, plugin string, skip map[string]bool) ([]option, error) {
+	section, path := plugin, ""
+	if at := strings.Index(value, "@"); at > -1 {
+		path = value[at+1:]
+		value = value[:at]
+	}
+	if value != "" {
+		section = value
+	}
+	if path == "" {
+		for _, candidate := range ExtraOptsPaths {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("no extra-opts file found in %v", ExtraOptsPaths)
+		}
+	}
+
+	options, err := readIniSection(path, section)
+	if err != nil {
+		return nil, err
+	}
+	return applyOptions(fs, options, skip)
+}
+
+// readIniSection returns the options of a section of an ini file
+func readIniSection(path string, section string) ([]option, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extra-opts: %v", err)
+	}
+	defer f.Close()
+
+	options := []option{}
+	current := ""
+	found := false
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || text[0] == '#' || text[0] == ';':
+			continue
+		case text[0] == '[':
+			if text[len(text)-1] != ']' {
+				return nil, fmt.Errorf("%s:%d: invalid section %q", path, line, text)
+			}
+			current = strings.TrimSpace(text[1 : len(text)-1])
+			found = found || current == section
+			continue
+		}
+		if current != section {
+			continue
+		}
+		name, value := text, ""
+		if eq := strings.Index(text, "="); eq > -1 {
+			name = strings.TrimSpace(text[:eq])
+			value = strings.TrimSpace(text[eq+1:])
+		}
+		options = append(options, option{name, value, path, line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read extra-opts: %v", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: section [%s] not found", path, section)
+	}
+	return options, nil
+}
+
+// applyOptions sets the flags of all options which are not in skip and
+// returns the applied options
+func applyOptions(fs *flag.FlagSet, options []option, skip map[string]bool) ([]option, error) {
+	applied := []option{}
+	for _, o := range options {
+		if skip[o.name] {
+			continue
+		}
+		f := fs.Lookup(o.name)
+		if f == nil {
+			return nil, fmt.Errorf("%s: unknown option %q", o.source(), o.name)
+		}
+		value := o.value
+		if value == "" {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				value = "true"
+			}
+		}
+		if err := fs.Set(o.name, value); err != nil {
+			return nil, fmt.Errorf("%s: invalid value for %s: %v", o.source(), o.name, err)
+		}
+		applied = append(applied, o)
+	}
+	return applied, nil
+}
+
+// visited returns the names of all flags which have been set, including
+// aliases sharing the same value like -w and -warning
+func visited(fs *flag.FlagSet) map[string]bool {
+	names := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		names[f.Name] = true
+	})
+	return withAliases(fs, names)
+}
+
+// withAliases returns the given names of flags together with their aliases
+// sharing the same value
+func withAliases(fs *flag.FlagSet, names map[string]bool) map[string]bool {
+	all := make(map[string]bool)
+	values := make(map[interface{}]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		if names[f.Name] {
+			all[f.Name] = true
+			if reflect.ValueOf(f.Value).Kind() == reflect.Ptr {
+				values[f.Value] = true
+			}
+		}
+	})
+	fs.VisitAll(func(f *flag.Flag) {
+		if reflect.ValueOf(f.Value).Kind() == reflect.Ptr && values[f.Value] {
+			all[f.Name] = true
+		}
+	})
+	return all
+}
+
+// canonicalName returns the longest name of the flag and its aliases sharing
+// the same value, e.g. warning for w
+func canonicalName(fs *flag.FlagSet, name string) string {
+	canonical := name
+	for alias := range withAliases(fs, map[string]bool{name: true}) {
+		if len(alias) > len(canonical) || (len(alias) == len(canonical) && alias < canonical) {
+			canonical = alias
+		}
+	}
+	return canonical
+}
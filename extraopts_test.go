@@ -0,0 +1,71 @@
+package icinga
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyExtraOpts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-extraopts")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ini := filepath.Join(dir, "plugins.ini")
+	err = ioutil.WriteFile(ini, []byte(`; comment
+[check_foo]
+host = db1
+# comment
+port = 5432
+verbose
+
+[check_bar]
+host = db2
+unknown = 1
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write ini: %v", err)
+	}
+
+	tests := []struct {
+		value    string
+		args     []string
+		host     string
+		port     int
+		verbose  bool
+		errorMsg string
+	}{
+		{"@" + ini, nil, "db1", 5432, true, ""},
+		{"@" + ini, []string{"-host", "db3"}, "db3", 5432, true, ""},
+		{"check_bar@" + ini, nil, "", 0, false, ini + `:10: unknown option "unknown"`},
+		{"missing@" + ini, nil, "", 0, false, ini + ": section [missing] not found"},
+	}
+	for _, test := range tests {
+		fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+		host := fs.String("host", "", "host")
+		port := fs.Int("port", 0, "port")
+		verbose := fs.Bool("verbose", false, "verbose")
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatalf("failed to parse flags: %v", err)
+		}
+
+		err := ApplyExtraOpts(fs, test.value, "check_foo")
+		t.Logf("ApplyExtraOpts(%v) is %v", test.value, err)
+		if test.errorMsg != "" {
+			if err == nil || err.Error() != test.errorMsg {
+				t.Errorf("ApplyExtraOpts(%v) should fail with: %v", test.value, test.errorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ApplyExtraOpts(%v) failed: %v", test.value, err)
+		}
+		if *host != test.host || *port != test.port || *verbose != test.verbose {
+			t.Errorf("ApplyExtraOpts(%v) should set host=%v port=%v verbose=%v", test.value, test.host, test.port, test.verbose)
+		}
+	}
+}
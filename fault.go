@@ -0,0 +1,218 @@
+package icinga
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Fault is a fault injected into a check to test notifications and
+	// event handlers, see ParseFault
+	Fault struct {
+		Kind string
+		// Result is the name of the result forced to Status, * matches all
+		Result  string
+		Status  Status
+		Latency time.Duration
+	}
+
+	// FaultsValue is a flag.Value which collects faults, it can be given
+	// multiple times
+	FaultsValue struct {
+		Faults []Fault
+	}
+
+	// faultResults forces the status of injected results
+	faultResults struct {
+		Results
+		sync.Mutex
+		faults  []Fault
+		matched map[int]bool
+	}
+)
+
+const (
+	// FaultStatus forces the status of a result
+	FaultStatus = "status"
+	// FaultLatency delays the check
+	FaultLatency = "latency"
+	// FaultTimeout blocks the check until the plugin timeout
+	FaultTimeout = "timeout"
+	// FaultPanic panics in the check
+	FaultPanic = "panic"
+
+	// FaultResultName is the name of the OK Result listing the injected
+	// faults
+	FaultResultName = "fault-injection"
+	// faultMarker prefixes the message of results with forced status
+	faultMarker = "[injected] "
+)
+
+// FaultInjectionAllowFile lists the plugins which accept injected faults, one
+// name per line or * for all. Fault injection is refused if it doesn't exist,
+// also for faults given with ICINGA_INJECT_FAULT or CHECK_FOO_INJECT_FAULT.
+var FaultInjectionAllowFile = "/etc/icinga2/fault-injection.allow"
+
+// ParseFault parses a fault like status:disk /=critical, status:*=warning,
+// latency=5s, timeout or panic
+func ParseFault(spec string) (Fault, error) {
+	switch {
+	case spec == FaultTimeout || spec == FaultPanic:
+		return Fault{Kind: spec}, nil
+	case strings.HasPrefix(spec, FaultLatency+"="):
+		latency, err := time.ParseDuration(strings.TrimPrefix(spec, FaultLatency+"="))
+		if err != nil || latency < 0 {
+			return Fault{}, fmt.Errorf("invalid fault %q: invalid latency", spec)
+		}
+		return Fault{Kind: FaultLatency, Latency: latency}, nil
+	case strings.HasPrefix(spec, FaultStatus+":"):
+		target := strings.TrimPrefix(spec, FaultStatus+":")
+		eq := strings.LastIndex(target, "=")
+		if eq < 1 {
+			return Fault{}, fmt.Errorf("invalid fault %q: expected status:result=status", spec)
+		}
+		var status StatusValue
+		if err := status.Set(target[eq+1:]); err != nil {
+			return Fault{}, fmt.Errorf("invalid fault %q: %v", spec, err)
+		}
+		return Fault{Kind: FaultStatus, Result: target[:eq], Status: status.Status}, nil
+	}
+	return Fault{}, fmt.Errorf("invalid fault %q, must be status:result=status, latency=duration, timeout or panic", spec)
+}
+
+func (f Fault) String() string {
+	switch f.Kind {
+	case FaultStatus:
+		return fmt.Sprintf("%s:%s=%s", f.Kind, f.Result, f.Status)
+	case FaultLatency:
+		return fmt.Sprintf("%s=%v", f.Kind, f.Latency)
+	}
+	return f.Kind
+}
+
+// FaultInjectionAllowed returns whether the plugin is listed in
+// FaultInjectionAllowFile
+func FaultInjectionAllowed(plugin string) (bool, error) {
+	f, err := os.Open(FaultInjectionAllowFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read fault injection allow-list: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "*" || name == plugin {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// InjectFaults returns a ChecksFunc which runs checks with the given faults.
+// An OK Result named FaultResultName lists the faults, results with forced
+// status are marked with [injected]. A status fault which matches no result
+// fails the checks.
+func InjectFaults(faults []Fault, checks ChecksFunc) ChecksFunc {
+	if len(faults) == 0 {
+		return checks
+	}
+	return func(ctx context.Context, results Results) error {
+		names := []string{}
+		for _, fault := range faults {
+			names = append(names, fault.String())
+		}
+		results.Add(NewResult(FaultResultName, ServiceStatusOk, "injected faults: "+strings.Join(names, ", ")))
+
+		for _, fault := range faults {
+			switch fault.Kind {
+			case FaultLatency:
+				select {
+				case <-time.After(fault.Latency):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			case FaultTimeout:
+				<-ctx.Done()
+				return ctx.Err()
+			case FaultPanic:
+				panic("injected panic")
+			}
+		}
+		injected := &faultResults{Results: results, faults: faults, matched: make(map[int]bool)}
+		if err := checks(ctx, injected); err != nil {
+			return err
+		}
+		return injected.unmatched()
+	}
+}
+
+// Add adds the result with the forced status of the first matching fault, its
+// details and perfdata are kept
+func (r *faultResults) Add(result Result) {
+	r.Lock()
+	defer r.Unlock()
+	forced := false
+	for i, fault := range r.faults {
+		if fault.Kind != FaultStatus || (fault.Result != "*" && fault.Result != result.Name()) {
+			continue
+		}
+		// later matching faults are shadowed but not unmatched
+		r.matched[i] = true
+		if !forced {
+			var details []string
+			if detailed, ok := result.(DetailedResult); ok {
+				details = detailed.Details()
+			}
+			result = NewResultWithDetailsAndPerfdata(result.Name(), fault.Status, faultMarker+result.Message(), details, ResultPerfdata(result))
+			forced = true
+		}
+	}
+	r.Results.Add(result)
+}
+
+// unmatched returns an error for status faults which matched no result
+func (r *faultResults) unmatched() error {
+	r.Lock()
+	defer r.Unlock()
+	for i, fault := range r.faults {
+		if fault.Kind == FaultStatus && !r.matched[i] {
+			return fmt.Errorf("injected fault %s matched no result", fault)
+		}
+	}
+	return nil
+}
+
+// Set parses and adds a fault
+func (v *FaultsValue) Set(value string) error {
+	fault, err := ParseFault(value)
+	if err != nil {
+		return err
+	}
+	v.Faults = append(v.Faults, fault)
+	return nil
+}
+
+func (v *FaultsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	names := []string{}
+	for _, fault := range v.Faults {
+		names = append(names, fault.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// Type returns the pflag type name
+func (v *FaultsValue) Type() string {
+	return "faults"
+}
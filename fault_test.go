@@ -0,0 +1,175 @@
+package icinga
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFault(t *testing.T) {
+	tests := []struct {
+		spec     string
+		fault    Fault
+		errorMsg string
+	}{
+		{"status:disk /=critical", Fault{Kind: FaultStatus, Result: "disk /", Status: ServiceStatusCritical}, ""},
+		{"status:a=b=OK", Fault{Kind: FaultStatus, Result: "a=b", Status: ServiceStatusOk}, ""},
+		{"latency=1m", Fault{Kind: FaultLatency, Latency: time.Minute}, ""},
+		{"timeout", Fault{Kind: FaultTimeout}, ""},
+		{"panic", Fault{Kind: FaultPanic}, ""},
+		{"status:disk=broken", Fault{}, `invalid fault "status:disk=broken": invalid status "broken", must be one of OK, WARNING, CRITICAL or UNKNOWN`},
+		{"status:=ok", Fault{}, `invalid fault "status:=ok": expected status:result=status`},
+		{"latency=soon", Fault{}, `invalid fault "latency=soon": invalid latency`},
+		{"crash", Fault{}, `invalid fault "crash", must be status:result=status, latency=duration, timeout or panic`},
+	}
+	for _, test := range tests {
+		fault, err := ParseFault(test.spec)
+		t.Logf("ParseFault(%q) is %v, %v", test.spec, fault, err)
+		if test.errorMsg != "" {
+			if err == nil || err.Error() != test.errorMsg {
+				t.Errorf("ParseFault(%q) should fail with: %v", test.spec, test.errorMsg)
+			}
+			continue
+		}
+		if err != nil || fault != test.fault {
+			t.Errorf("ParseFault(%q) should be %v", test.spec, test.fault)
+		}
+	}
+}
+
+func TestInjectFaults(t *testing.T) {
+	checks := func(ctx context.Context, results Results) error {
+		results.Add(NewResultWithDetailsAndPerfdata("disk /", ServiceStatusOk, "everything ok", []string{"ext4"}, []Perfdata{{Label: "used", Value: 10, Unit: "%"}}))
+		results.Add(NewResultOk("disk /var"))
+		return nil
+	}
+
+	tests := []struct {
+		faults   []string
+		status   Status
+		messages map[string]string
+	}{
+		{nil, ServiceStatusOk, map[string]string{"disk /": "everything ok"}},
+		{[]string{"status:disk /=critical"}, ServiceStatusCritical, map[string]string{
+			"disk /":        "[injected] everything ok",
+			"disk /var":     "everything ok",
+			FaultResultName: "injected faults: status:disk /=CRITICAL",
+		}},
+		{[]string{"status:*=warning", "latency=10ms"}, ServiceStatusWarning, map[string]string{
+			"disk /var": "[injected] everything ok",
+		}},
+		{[]string{"timeout"}, ServiceStatusUnknown, map[string]string{
+			CheckResultName: "check timed out after 50ms",
+			FaultResultName: "injected faults: timeout",
+		}},
+		{[]string{"panic"}, ServiceStatusUnknown, map[string]string{CheckResultName: "check panicked: injected panic"}},
+		{[]string{"status:disk /tmp=critical"}, ServiceStatusUnknown, map[string]string{
+			CheckResultName: "injected fault status:disk /tmp=CRITICAL matched no result",
+		}},
+		{[]string{"status:*=warning", "status:disk /=critical"}, ServiceStatusWarning, map[string]string{
+			"disk /": "[injected] everything ok",
+		}},
+	}
+	for _, test := range tests {
+		faults := FaultsValue{}
+		for _, spec := range test.faults {
+			if err := faults.Set(spec); err != nil {
+				t.Fatalf("failed to parse fault: %v", err)
+			}
+		}
+		results := RunChecks(context.Background(), 50*time.Millisecond, NewResults(), InjectFaults(faults.Faults, checks))
+		t.Logf("InjectFaults(%v) is %v", &faults, results)
+		if results.CalculateStatus() != test.status {
+			t.Errorf("InjectFaults(%v) should be %v", &faults, test.status)
+		}
+		for _, result := range results.All() {
+			if message, found := test.messages[result.Name()]; found && result.Message() != message {
+				t.Errorf("InjectFaults(%v) should have %v: %v", &faults, result.Name(), message)
+			}
+			// forced results keep their details and perfdata
+			if result.Name() == "disk /" && (perfdataString(ResultPerfdata(result)) != "used=10%" || len(ResultDetails(result)) != 1) {
+				t.Errorf("InjectFaults(%v) should keep the details and perfdata of %v", &faults, result.Name())
+			}
+		}
+	}
+}
+
+func TestPluginOptionsInjectFaults(t *testing.T) {
+	o, err := NewPluginOptions("check_foo", "10", "20")
+	if err != nil {
+		t.Fatalf("failed to create plugin options: %v", err)
+	}
+	if err := o.Faults.Set("status:disk /=critical"); err != nil {
+		t.Fatalf("failed to parse fault: %v", err)
+	}
+
+	// faults are injected into checks run with Run as well
+	check := o.injectFaults(func() Results {
+		results := NewResults()
+		results.Add(NewResultOk("disk /"))
+		return results
+	})
+	results := check()
+	t.Logf("injectFaults() is %v", results)
+	if results.CalculateStatus() != ServiceStatusCritical {
+		t.Errorf("injectFaults() should be %v", ServiceStatusCritical)
+	}
+}
+
+func TestFaultInjectionAllowed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-fault")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { FaultInjectionAllowFile = path }(FaultInjectionAllowFile)
+
+	parse := func(args ...string) error {
+		o, err := NewPluginOptions("check_foo", "", "")
+		if err != nil {
+			t.Fatalf("failed to create plugin options: %v", err)
+		}
+		fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+		o.Register(fs)
+		if err := o.Parse(fs, args); err != nil {
+			return err
+		}
+		if len(o.Faults.Faults) != 1 {
+			t.Errorf("Parse(%v) should inject a fault", args)
+		}
+		return nil
+	}
+
+	FaultInjectionAllowFile = filepath.Join(dir, "missing")
+	err = parse("--inject-fault", "panic")
+	t.Logf("Parse() without allow-list is %v", err)
+	if err == nil || !strings.HasPrefix(err.Error(), "fault injection is not allowed for check_foo") {
+		t.Errorf("Parse() should refuse faults without allow-list")
+	}
+	// faults from the environment are checked the same way
+	os.Setenv("ICINGA_INJECT_FAULT", "panic")
+	defer os.Unsetenv("ICINGA_INJECT_FAULT")
+	if err := parse(); err == nil {
+		t.Errorf("Parse() should refuse faults from the environment without allow-list")
+	}
+
+	FaultInjectionAllowFile = filepath.Join(dir, "allow")
+	for _, content := range []string{"check_bar\n", "check_bar\ncheck_foo\n", "*\n"} {
+		if err := ioutil.WriteFile(FaultInjectionAllowFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write allow-list: %v", err)
+		}
+		err := parse("--inject-fault", "panic")
+		t.Logf("Parse() with allow-list %q is %v", content, err)
+		if (err == nil) != (content != "check_bar\n") {
+			t.Errorf("Parse() with allow-list %q should only succeed if check_foo is allowed", content)
+		}
+	}
+	if err := parse(); err != nil {
+		t.Errorf("Parse() should accept faults from the environment of allowed plugins: %v", err)
+	}
+}
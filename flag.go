@@ -0,0 +1,168 @@
+package icinga
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The flag values in this file implement flag.Value and pflag.Value (which
+// additionally requires Type() string). They can be registered on a
+// flag.FlagSet directly or on a pflag.FlagSet or cobra command, e.g. via
+// pflag.FlagSet.AddGoFlagSet.
+
+type (
+	// RangeValue is a flag value which parses a threshold into a Range
+	RangeValue struct {
+		Range Range
+		text  string
+	}
+
+	// StatusValue is a flag value which parses a Status
+	StatusValue struct {
+		Status Status
+	}
+
+	// StatusCheckValue combines warning and critical thresholds of a
+	// StatusCheck which are registered as two flags
+	StatusCheckValue struct {
+		Warning  *RangeValue
+		Critical *RangeValue
+	}
+
+	// StringsValue collects the values of a flag given multiple times
+	StringsValue []string
+
+	// verbosityValue counts how often a flag is given, e.g. -v -v -v
+	verbosityValue struct {
+		count *int
+	}
+)
+
+// NewRangeValue creates a RangeValue with a default threshold
+func NewRangeValue(value string) (*RangeValue, error) {
+	v := &RangeValue{}
+	if err := v.Set(value); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Set parses a threshold
+func (v *RangeValue) Set(value string) error {
+	r, err := NewRange(value)
+	if err != nil {
+		return fmt.Errorf("invalid range %q: %v", value, err)
+	}
+	v.Range = r
+	v.text = value
+	return nil
+}
+
+func (v *RangeValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.text
+}
+
+// Type returns the pflag type name
+func (v *RangeValue) Type() string {
+	return "range"
+}
+
+// Set parses a status name, case insensitive
+func (v *StatusValue) Set(value string) error {
+	status, found := statusMap[strings.ToUpper(value)]
+	if !found {
+		return fmt.Errorf("invalid status %q, must be one of OK, WARNING, CRITICAL or UNKNOWN", value)
+	}
+	v.Status = status
+	return nil
+}
+
+func (v *StatusValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.Status.String()
+}
+
+// Type returns the pflag type name
+func (v *StatusValue) Type() string {
+	return "status"
+}
+
+// NewStatusCheckValue creates a StatusCheckValue with default thresholds
+func NewStatusCheckValue(warning string, critical string) (*StatusCheckValue, error) {
+	warningValue, err := NewRangeValue(warning)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse warning threshold string %v: %v", warning, err)
+	}
+	criticalValue, err := NewRangeValue(critical)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse critical threshold string %v: %v", critical, err)
+	}
+	return &StatusCheckValue{warningValue, criticalValue}, nil
+}
+
+// Register registers the thresholds as flags with the given names
+func (v *StatusCheckValue) Register(fs *flag.FlagSet, warning string, critical string) {
+	fs.Var(v.Warning, warning, "warning threshold")
+	fs.Var(v.Critical, critical, "critical threshold")
+}
+
+// StatusCheck returns a StatusCheck for the current thresholds
+func (v *StatusCheckValue) StatusCheck() StatusCheck {
+	return &statusCheckImpl{v.Warning.Range, v.Critical.Range, ""}
+}
+
+// Set appends a value
+func (v *StringsValue) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+func (v *StringsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+// Type returns the pflag type name
+func (v *StringsValue) Type() string {
+	return "strings"
+}
+
+// Set increments the count, a numeric value sets it
+func (v *verbosityValue) Set(value string) error {
+	if value == "true" {
+		*v.count++
+		return nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid verbosity %q", value)
+	}
+	*v.count = count
+	return nil
+}
+
+func (v *verbosityValue) String() string {
+	if v == nil || v.count == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.count)
+}
+
+// IsBoolFlag allows to use the flag without value
+func (v *verbosityValue) IsBoolFlag() bool {
+	return true
+}
+
+// Type returns the pflag type name
+func (v *verbosityValue) Type() string {
+	return "count"
+}
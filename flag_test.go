@@ -0,0 +1,88 @@
+package icinga
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestStatusCheckValue(t *testing.T) {
+	v, err := NewStatusCheckValue("10", "20")
+	if err != nil {
+		t.Fatalf("failed to create StatusCheckValue: %v", err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	v.Register(fs, "w", "c")
+	if err := fs.Parse([]string{"-w", "5:", "-c", "2:"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	tests := []struct {
+		value    float64
+		shouldBe Status
+	}{
+		{1.0, ServiceStatusCritical},
+		{2.0, ServiceStatusWarning},
+		{5.0, ServiceStatusOk},
+	}
+	for _, test := range tests {
+		level := v.StatusCheck().Check(test.value)
+		t.Logf("Check(%v) level: %v", test.value, level)
+		if level != test.shouldBe {
+			t.Errorf("Check(%v) should be: %v", test.value, test.shouldBe)
+		}
+	}
+
+	if err := fs.Set("w", "20:10"); err == nil {
+		t.Errorf("Set() should fail for invalid range")
+	}
+}
+
+func TestStatusValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		shouldBe Status
+		valid    bool
+	}{
+		{"OK", ServiceStatusOk, true},
+		{"warning", ServiceStatusWarning, true},
+		{"Critical", ServiceStatusCritical, true},
+		{"unknown", ServiceStatusUnknown, true},
+		{"fine", ServiceStatusOk, false},
+	}
+	for _, test := range tests {
+		var v StatusValue
+		err := v.Set(test.value)
+		t.Logf("Set(%v) is %v, %v", test.value, v.Status, err)
+		if (err == nil) != test.valid {
+			t.Errorf("Set(%v) should be valid: %v", test.value, test.valid)
+		}
+		if err == nil && v.Status != test.shouldBe {
+			t.Errorf("Set(%v) should be %v", test.value, test.shouldBe)
+		}
+	}
+}
+
+func TestVerbosityValue(t *testing.T) {
+	verbosity := 0
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&verbosityValue{&verbosity}, "v", "verbose")
+	if err := fs.Parse([]string{"-v", "-v", "-v"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if verbosity != 3 {
+		t.Errorf("verbosity should be 3 but is %d", verbosity)
+	}
+}
+
+func TestStringsValue(t *testing.T) {
+	var v StringsValue
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&v, "allow", "allowed values")
+	if err := fs.Parse([]string{"--allow", "a", "--allow", "b,c"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	t.Logf("StringsValue is %v", v)
+	if len(v) != 2 || v.String() != "a,b,c" {
+		t.Errorf("StringsValue should collect all values")
+	}
+}
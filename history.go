@@ -0,0 +1,295 @@
+package icinga
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// Sink receives the Results of a check run, e.g. to persist or forward them
+	Sink interface {
+		Write(Results) error
+	}
+
+	// History is a Sink which keeps past check runs and allows to query them
+	History interface {
+		Sink
+		Runs() ([]HistoryRun, error)
+		Timeline(name string) ([]HistoryEntry, error)
+		Flapping(name string) (int, error)
+	}
+
+	// HistoryRun is a single recorded check run
+	HistoryRun struct {
+		Time    time.Time      `json:"time"`
+		Status  Status         `json:"status"`
+		Message string         `json:"message"`
+		Results []HistoryEntry `json:"results"`
+	}
+
+	// HistoryEntry is a single recorded Result of a check run
+	HistoryEntry struct {
+		Time     time.Time  `json:"-"`
+		Name     string     `json:"name"`
+		Status   Status     `json:"status"`
+		Message  string     `json:"message"`
+		Details  []string   `json:"details,omitempty"`
+		Perfdata []Perfdata `json:"perfdata,omitempty"`
+	}
+
+	fileHistory struct {
+		path      string
+		retention time.Duration
+		now       func() time.Time
+	}
+)
+
+// NewFileHistory creates a History which appends every run as a JSON line to
+// the given file. Runs older than retention are not returned and dropped from
+// the file once they exceed it by a tenth, a retention of 0 keeps all runs.
+func NewFileHistory(path string, retention time.Duration) History {
+	return &fileHistory{path, retention, time.Now}
+}
+
+// Write records a check run
+func (h *fileHistory) Write(results Results) error {
+	run := HistoryRun{
+		Time:    h.now(),
+		Status:  results.CalculateStatus(),
+		Message: results.GenerateMessage(),
+		Results: historyEntries(results),
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode history run: %v", err)
+	}
+
+	lock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	defer unlockFile(lock)
+
+	// runs are appended, the file is only rewritten when the oldest run
+	// exceeds the retention by a tenth, so expired runs are dropped in batches
+	if h.retention > 0 {
+		oldest, ok, err := h.oldest()
+		if err != nil {
+			return err
+		}
+		if !ok || run.Time.Sub(oldest) > h.retention+h.retention/10 {
+			runs, err := h.read()
+			if err != nil {
+				return err
+			}
+			return h.rewrite(append(h.retain(runs, run.Time), run))
+		}
+	}
+	return h.append(line)
+}
+
+// Runs returns all recorded runs within the retention, oldest first
+func (h *fileHistory) Runs() ([]HistoryRun, error) {
+	lock, err := h.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	defer unlockFile(lock)
+
+	runs, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+	return h.retain(runs, h.now()), nil
+}
+
+// lock takes the lock of the history file, it is released with unlockFile
+func (h *fileHistory) lock() (*os.File, error) {
+	lock, err := os.OpenFile(h.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history lock: %v", err)
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("failed to lock history: %v", err)
+	}
+	return lock, nil
+}
+
+// Timeline returns all recorded results with the given name, oldest first
+func (h *fileHistory) Timeline(name string) ([]HistoryEntry, error) {
+	runs, err := h.Runs()
+	if err != nil {
+		return nil, err
+	}
+	timeline := []HistoryEntry{}
+	for _, run := range runs {
+		for _, entry := range run.Results {
+			if entry.Name == name {
+				entry.Time = run.Time
+				timeline = append(timeline, entry)
+			}
+		}
+	}
+	return timeline, nil
+}
+
+// Flapping returns the number of status changes of the result with the given
+// name within the retained history
+func (h *fileHistory) Flapping(name string) (int, error) {
+	timeline, err := h.Timeline(name)
+	if err != nil {
+		return 0, err
+	}
+	return CountTransitions(timeline), nil
+}
+
+// historyEntries returns the entries of all results, ordered by name
+func historyEntries(results Results) []HistoryEntry {
+	entries := []HistoryEntry{}
+	for _, result := range sortedByName(results) {
+		entries = append(entries, HistoryEntry{
+			Name:     result.Name(),
+			Status:   result.Status(),
+			Message:  result.Message(),
+			Details:  ResultDetails(result),
+			Perfdata: ResultPerfdata(result),
+		})
+	}
+	return entries
+}
+
+// CountTransitions returns the number of status changes in a timeline
+func CountTransitions(timeline []HistoryEntry) int {
+	transitions := 0
+	for i := 1; i < len(timeline); i++ {
+		if timeline[i].Status != timeline[i-1].Status {
+			transitions++
+		}
+	}
+	return transitions
+}
+
+// read returns all runs of the history file. Lines which can't be decoded,
+// e.g. after an interrupted write, are skipped.
+func (h *fileHistory) read() ([]HistoryRun, error) {
+	data, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+
+	runs := []HistoryRun{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		var run HistoryRun
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// oldest returns the time of the first run, ok is false if the first line
+// can't be decoded. A missing or empty file has no oldest run.
+func (h *fileHistory) oldest() (oldest time.Time, ok bool, err error) {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return time.Time{}, true, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read history: %v", err)
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if len(line) == 0 && err == io.EOF {
+		return time.Time{}, true, nil
+	}
+	var run HistoryRun
+	if err := json.Unmarshal(line, &run); err != nil {
+		return time.Time{}, false, nil
+	}
+	return run.Time, true, nil
+}
+
+func (h *fileHistory) retain(runs []HistoryRun, now time.Time) []HistoryRun {
+	if h.retention <= 0 {
+		return runs
+	}
+	retained := []HistoryRun{}
+	for _, run := range runs {
+		if now.Sub(run.Time) <= h.retention {
+			retained = append(retained, run)
+		}
+	}
+	return retained
+}
+
+// append appends a line. A partial last line of an interrupted write is
+// terminated first, so it is skipped by read instead of corrupting the line.
+func (h *fileHistory) append(line []byte) error {
+	f, err := os.OpenFile(h.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %v", err)
+	}
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	return f.Close()
+}
+
+func (h *fileHistory) rewrite(runs []HistoryRun) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, run := range runs {
+		if err := encoder.Encode(run); err != nil {
+			return fmt.Errorf("failed to encode history run: %v", err)
+		}
+	}
+
+	if err := writeFileAtomic(h.path, buffer.Bytes()); err != nil {
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file with data via a temporary file, so
+// readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
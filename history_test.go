@@ -0,0 +1,133 @@
+package icinga
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-history")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &fileHistory{filepath.Join(dir, "history.jsonl"), 3 * time.Minute, func() time.Time { return now }}
+
+	statuses := []Status{
+		ServiceStatusOk,
+		ServiceStatusWarning,
+		ServiceStatusWarning,
+		ServiceStatusCritical,
+		ServiceStatusOk,
+	}
+	for _, status := range statuses {
+		results := NewResults()
+		results.Add(NewResult("check 1", status, "some message"))
+		results.Add(NewResultOk("check 2"))
+		if err := h.Write(results); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	runs, err := h.Runs()
+	if err != nil {
+		t.Fatalf("Runs() failed: %v", err)
+	}
+	t.Logf("Runs() returned %d runs", len(runs))
+	if len(runs) != 3 {
+		t.Errorf("Runs() should return 3 runs within retention")
+	}
+
+	tests := []struct {
+		name        string
+		shouldBe    []Status
+		transitions int
+	}{
+		{"check 1", []Status{ServiceStatusWarning, ServiceStatusCritical, ServiceStatusOk}, 2},
+		{"check 2", []Status{ServiceStatusOk, ServiceStatusOk, ServiceStatusOk}, 0},
+		{"check 3", []Status{}, 0},
+	}
+	for _, test := range tests {
+		timeline, err := h.Timeline(test.name)
+		if err != nil {
+			t.Fatalf("Timeline(%v) failed: %v", test.name, err)
+		}
+		if len(timeline) != len(test.shouldBe) {
+			t.Fatalf("Timeline(%v) should have %d entries but has %d", test.name, len(test.shouldBe), len(timeline))
+		}
+		for i, entry := range timeline {
+			if entry.Status != test.shouldBe[i] {
+				t.Errorf("Timeline(%v)[%d] should be %v but is %v", test.name, i, test.shouldBe[i], entry.Status)
+			}
+		}
+		transitions, err := h.Flapping(test.name)
+		if err != nil {
+			t.Fatalf("Flapping(%v) failed: %v", test.name, err)
+		}
+		if transitions != test.transitions {
+			t.Errorf("Flapping(%v) should be %d but is %d", test.name, test.transitions, transitions)
+		}
+	}
+}
+
+func TestFileHistoryAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-history")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &fileHistory{path, 10 * time.Minute, func() time.Time { return now }}
+	write := func(value float64) {
+		results := NewResults()
+		results.Add(NewResultWithPerfdata("disk", ServiceStatusOk, "ok", []Perfdata{{Label: "used", Value: value, Unit: "%"}}))
+		if err := h.Write(results); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+		now = now.Add(time.Minute)
+	}
+	lines := func() int {
+		data, _ := ioutil.ReadFile(path)
+		return strings.Count(string(data), "\n")
+	}
+
+	write(10)
+	// an interrupted write leaves a partial line behind
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"time":"2018-01-01T00:01:00Z","sta`)
+	f.Close()
+	for i := 1; i <= 10; i++ {
+		write(float64(10 + i))
+	}
+
+	runs, err := h.Runs()
+	if err != nil {
+		t.Fatalf("Runs() failed: %v", err)
+	}
+	t.Logf("Runs() returned %d runs, the file has %d lines", len(runs), lines())
+	if len(runs) != 10 || lines() != 12 {
+		t.Fatalf("Write() should append all runs after the partial line")
+	}
+	if p := runs[9].Results[0].Perfdata; len(p) != 1 || p[0].Value != 20 {
+		t.Errorf("Write() should record the perfdata but is %v", p)
+	}
+
+	// the oldest run exceeds the retention but not by a tenth
+	write(21)
+	if runs, _ := h.Runs(); len(runs) != 10 || lines() != 13 {
+		t.Errorf("Write() shouldn't rewrite the file before the retention is exceeded by a tenth")
+	}
+	write(22)
+	if runs, _ := h.Runs(); len(runs) != 10 || lines() != 11 {
+		t.Errorf("Write() should drop expired runs and the partial line but the file has %d lines", lines())
+	}
+}
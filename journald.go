@@ -0,0 +1,73 @@
+package icinga
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type (
+	// JournaldOptions options to generate a new journald Sink
+	JournaldOptions struct {
+		// Socket defaults to /run/systemd/journal/socket
+		Socket string
+		// Plugin is used as SYSLOG_IDENTIFIER and ICINGA_PLUGIN field
+		Plugin string
+	}
+
+	journaldSink struct {
+		options JournaldOptions
+	}
+)
+
+// NewJournaldSink creates a Sink which writes every Result as a native
+// journald entry. Entries must fit into a single datagram.
+func NewJournaldSink(options JournaldOptions) Sink {
+	if options.Socket == "" {
+		options.Socket = "/run/systemd/journal/socket"
+	}
+	return &journaldSink{options}
+}
+
+// Write sends one journal entry per Result
+func (s *journaldSink) Write(results Results) error {
+	conn, err := net.Dial("unixgram", s.options.Socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to journald: %v", err)
+	}
+	defer conn.Close()
+
+	for _, result := range sortedByName(results) {
+		var buffer bytes.Buffer
+		journaldField(&buffer, "MESSAGE", fmt.Sprintf("%s: %s: %s", result.Status(), result.Name(), result.Message()))
+		journaldField(&buffer, "PRIORITY", strconv.Itoa(syslogSeverity(result.Status())))
+		if s.options.Plugin != "" {
+			journaldField(&buffer, "SYSLOG_IDENTIFIER", s.options.Plugin)
+			journaldField(&buffer, "ICINGA_PLUGIN", s.options.Plugin)
+		}
+		journaldField(&buffer, "ICINGA_RESULT", result.Name())
+		journaldField(&buffer, "ICINGA_STATUS", result.Status().String())
+		if perfdata := ResultPerfdata(result); len(perfdata) > 0 {
+			journaldField(&buffer, "ICINGA_PERFDATA", perfdataString(perfdata))
+		}
+		if _, err := conn.Write(buffer.Bytes()); err != nil {
+			return fmt.Errorf("failed to write to journald: %v", err)
+		}
+	}
+	return nil
+}
+
+// journaldField appends a field in the journal native protocol format. Values
+// containing a newline are written with an explicit little endian length.
+func journaldField(buffer *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		buffer.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buffer.WriteString(name + "\n")
+	binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value + "\n")
+}
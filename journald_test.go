@@ -0,0 +1,58 @@
+package icinga
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournaldSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-journald")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on %v: %v", socket, err)
+	}
+	defer conn.Close()
+
+	results := NewResults()
+	results.Add(NewResultWithPerfdata("check 1", ServiceStatusWarning, "line 1\nline 2", []Perfdata{{Label: "load1", Value: 5, Warning: "4"}}))
+	if err := NewJournaldSink(JournaldOptions{Socket: socket, Plugin: "check_foo"}).Write(results); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	buffer := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("failed to read entry: %v", err)
+	}
+	entry := buffer[:n]
+	t.Logf("entry is: %q", entry)
+
+	message := "WARNING: check 1: line 1\nline 2"
+	var length bytes.Buffer
+	binary.Write(&length, binary.LittleEndian, uint64(len(message)))
+	shouldBe := "MESSAGE\n" + length.String() + message + "\n" + strings.Join([]string{
+		"PRIORITY=4",
+		"SYSLOG_IDENTIFIER=check_foo",
+		"ICINGA_PLUGIN=check_foo",
+		"ICINGA_RESULT=check 1",
+		"ICINGA_STATUS=WARNING",
+		"ICINGA_PERFDATA=load1=5;4",
+	}, "\n") + "\n"
+	if string(entry) != shouldBe {
+		t.Errorf("entry should be: %q", shouldBe)
+	}
+}
@@ -0,0 +1,207 @@
+package icinga
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Catalog maps message keys to fmt format strings of a language
+type Catalog map[string]string
+
+// keys of the messages generated by the library
+const (
+	MessageSuccess = "success"
+	// MessageStatusOk to MessageStatusUnknown label the result groups of the
+	// default status message
+	MessageStatusOk       = "status.ok"
+	MessageStatusWarning  = "status.warning"
+	MessageStatusCritical = "status.critical"
+	MessageStatusUnknown  = "status.unknown"
+	MessageNoResult       = "check.no-result"
+	MessagePanicked       = "check.panicked"
+	MessageTimedOut       = "check.timed-out"
+	MessageAborted        = "check.aborted"
+	MessageMetricValue    = "metric.value"
+	MessageNoSamples      = "metric.no-samples"
+	MessageDuplicate      = "metric.duplicate"
+	MessageMissingLabel   = "metric.missing-label"
+	MessageSamples        = "metric.samples"
+	MessageRangeOutside   = "range.outside"
+	MessageRangeInside    = "range.inside"
+	MessageCached         = "ratelimit.cached"
+	MessageRateLimited    = "ratelimit.limited"
+)
+
+// DefaultLocale is used for messages missing in the catalog of the selected
+// locale
+const DefaultLocale = "en"
+
+var (
+	// EnglishCatalog contains the default messages
+	EnglishCatalog = Catalog{
+		MessageSuccess:        DefaultSuccessMessage,
+		MessageStatusOk:       "ok",
+		MessageStatusWarning:  "warning",
+		MessageStatusCritical: "critical",
+		MessageStatusUnknown:  "unknown",
+		MessageNoResult:       "check returned no result",
+		MessagePanicked:       "check panicked: %v",
+		MessageTimedOut:       "check timed out after %v",
+		MessageAborted:        "check aborted: %v",
+		MessageMetricValue:    "%s is %s%s",
+		MessageNoSamples:      "no samples for metric %s",
+		MessageDuplicate:      "samples %s and %s map to the same result",
+		MessageMissingLabel:   "sample %s has no label %s for result %s",
+		MessageSamples:        "collected samples: %d",
+		MessageRangeOutside:   "alert if outside %s .. %s",
+		MessageRangeInside:    "alert if inside %s .. %s",
+		MessageCached:         "%s (cached from %s, rate limited)",
+		MessageRateLimited:    "rate limited, next request possible in %v",
+	}
+
+	// GermanCatalog contains the German messages
+	GermanCatalog = Catalog{
+		MessageSuccess:        "alles in Ordnung",
+		MessageStatusOk:       "ok",
+		MessageStatusWarning:  "Warnung",
+		MessageStatusCritical: "kritisch",
+		MessageStatusUnknown:  "unbekannt",
+		MessageNoResult:       "Check lieferte kein Ergebnis",
+		MessagePanicked:       "Check abgestürzt: %v",
+		MessageTimedOut:       "Zeitüberschreitung des Checks nach %v",
+		MessageAborted:        "Check abgebrochen: %v",
+		MessageMetricValue:    "%s ist %s%s",
+		MessageNoSamples:      "keine Werte für Metrik %s",
+		MessageDuplicate:      "Werte %s und %s ergeben dasselbe Ergebnis",
+		MessageMissingLabel:   "Wert %s hat kein Label %s für Ergebnis %s",
+		MessageSamples:        "erfasste Werte: %d",
+		MessageRangeOutside:   "Alarm außerhalb von %s .. %s",
+		MessageRangeInside:    "Alarm innerhalb von %s .. %s",
+		MessageCached:         "%s (zwischengespeichert von %s, Ratenbegrenzung)",
+		MessageRateLimited:    "Ratenbegrenzung, nächste Anfrage möglich in %v",
+	}
+
+	catalogs = map[string]Catalog{
+		"en": EnglishCatalog,
+		"de": GermanCatalog,
+	}
+	locale            = DefaultLocale
+	summaryTranslated bool
+	localeMutex       sync.RWMutex
+)
+
+// statusMessageKeys are the keys of the result group labels by Status
+var statusMessageKeys = [...]string{
+	MessageStatusOk,
+	MessageStatusWarning,
+	MessageStatusCritical,
+	MessageStatusUnknown,
+}
+
+// RegisterCatalog adds or replaces the catalog of a locale like de or pt_br
+func RegisterCatalog(name string, catalog Catalog) {
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	catalogs[normalizeLocale(name)] = catalog
+}
+
+// SetLocale selects the catalog for library messages of the process. Locales
+// like de_DE.UTF-8 fall back to the catalog of the language.
+func SetLocale(name string) error {
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	name, err := resolveLocale(name)
+	if err != nil {
+		return err
+	}
+	locale = name
+	return nil
+}
+
+// checkLocale returns an error if SetLocale would fail for the locale
+func checkLocale(name string) error {
+	localeMutex.RLock()
+	defer localeMutex.RUnlock()
+	_, err := resolveLocale(name)
+	return err
+}
+
+// resolveLocale returns the catalog name of a locale, localeMutex must be
+// locked
+func resolveLocale(name string) (string, error) {
+	name = normalizeLocale(name)
+	if name == "" || name == "c" || name == "posix" {
+		name = DefaultLocale
+	}
+	if _, found := catalogs[name]; !found {
+		language := strings.SplitN(name, "_", 2)[0]
+		if _, found := catalogs[language]; !found {
+			names := []string{}
+			for n := range catalogs {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("unknown locale %q, valid locales are %s", name, strings.Join(names, ", "))
+		}
+		name = language
+	}
+	return name, nil
+}
+
+// SetSummaryTranslated enables the translation of the status group labels
+// and the DefaultSuccessMessage. They are English by default, as parsers of
+// the plugin output rely on them.
+func SetSummaryTranslated(enabled bool) {
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	summaryTranslated = enabled
+}
+
+// Locale returns the selected locale
+func Locale() string {
+	localeMutex.RLock()
+	defer localeMutex.RUnlock()
+	return locale
+}
+
+// Translate formats the message of the selected locale, messages missing in
+// its catalog are taken from the catalog of its language, e.g. de for de_ch,
+// and then from EnglishCatalog
+func Translate(key string, args ...interface{}) string {
+	localeMutex.RLock()
+	format, found := catalogs[locale][key]
+	if !found {
+		format, found = catalogs[strings.SplitN(locale, "_", 2)[0]][key]
+	}
+	localeMutex.RUnlock()
+	if !found {
+		if format, found = EnglishCatalog[key]; !found {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// translateSummary translates the status group labels and the success
+// message only if enabled with SetSummaryTranslated
+func translateSummary(key string) string {
+	localeMutex.RLock()
+	enabled := summaryTranslated
+	localeMutex.RUnlock()
+	if !enabled {
+		return EnglishCatalog[key]
+	}
+	return Translate(key)
+}
+
+// normalizeLocale turns de-DE.UTF-8 into de_de
+func normalizeLocale(name string) string {
+	name = strings.SplitN(name, ".", 2)[0]
+	name = strings.SplitN(name, "@", 2)[0]
+	return strings.ToLower(strings.Replace(name, "-", "_", -1))
+}
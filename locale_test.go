@@ -0,0 +1,140 @@
+package icinga
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetLocale(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	tests := map[string]string{
+		"de":          "de",
+		"de_DE.UTF-8": "de",
+		"de-AT":       "de",
+		"en_US":       "en",
+		"C":           "en",
+		"":            "en",
+	}
+	for name, shouldBe := range tests {
+		if err := SetLocale(name); err != nil || Locale() != shouldBe {
+			t.Errorf("SetLocale(%q) should select %s but is %s, %v", name, shouldBe, Locale(), err)
+		}
+	}
+	err := SetLocale("fr")
+	t.Logf("SetLocale(fr) is %v", err)
+	if err == nil || err.Error() != `unknown locale "fr", valid locales are de, en` {
+		t.Errorf("SetLocale() should fail for unknown locales")
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	defer SetSummaryTranslated(false)
+	RegisterCatalog("de_CH", Catalog{MessageSuccess: "alles in Ordnig"})
+	defer RegisterCatalog("de_CH", nil)
+
+	results := NewResults()
+	results.Add(NewResultOk("disk"))
+	results.Add(NewResult("load", ServiceStatusWarning, "load 5"))
+	results.Add(RunCheck(context.Background(), "mail", time.Millisecond, func(ctx context.Context) (Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	shouldBe := `UNKNOWN: unknown: [mail] warning: [load] ok: [disk]
+UNKNOWN: mail: check timed out after 1ms
+WARNING: load: load 5
+OK: disk: everything ok
+`
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("English results should be:\n%v\nbut are:\n%v", shouldBe, results)
+	}
+
+	SetLocale("de")
+	results = NewResults()
+	results.Add(NewResultOk("disk"))
+	results.Add(NewResult("load", ServiceStatusWarning, "load 5"))
+	results.Add(RunCheck(context.Background(), "mail", time.Millisecond, func(ctx context.Context) (Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	t.Logf("German results are:\n%v", results)
+	shouldBe = `UNKNOWN: unknown: [mail] warning: [load] ok: [disk]
+UNKNOWN: mail: Zeitüberschreitung des Checks nach 1ms
+WARNING: load: load 5
+OK: disk: everything ok
+`
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("German results should keep the summary English:\n%v", shouldBe)
+	}
+
+	SetSummaryTranslated(true)
+	results = NewResults()
+	results.Add(NewResultOk("disk"))
+	results.Add(NewResult("load", ServiceStatusWarning, "load 5"))
+	t.Logf("German results with translated summary are:\n%v", results)
+	shouldBe = `WARNING: Warnung: [load] ok: [disk]
+WARNING: load: load 5
+OK: disk: alles in Ordnung
+`
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("German results with translated summary should be:\n%v", shouldBe)
+	}
+
+	// missing messages fall back to German and then to English
+	SetLocale("de_CH")
+	EnglishCatalog["test.english-only"] = "only English"
+	defer delete(EnglishCatalog, "test.english-only")
+	if Translate(MessageSuccess) != "alles in Ordnig" || Translate(MessageNoSamples, "load1") != "keine Werte für Metrik load1" {
+		t.Errorf("Translate() should use the registered catalog and fall back to German")
+	}
+	if Translate("test.english-only") != "only English" {
+		t.Errorf("Translate() should fall back to English for messages missing in German")
+	}
+	if Translate("missing.key") != "missing.key" {
+		t.Errorf("Translate() should return unknown keys")
+	}
+}
+
+func TestPluginOptionsLocale(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	defer SetSummaryTranslated(false)
+	os.Setenv("ICINGA_LOCALE", "de_DE.UTF-8")
+	defer os.Unsetenv("ICINGA_LOCALE")
+
+	tests := []struct {
+		args     []string
+		locale   string
+		errorMsg string
+	}{
+		{[]string{}, "de_DE.UTF-8", ""},
+		{[]string{"--locale", "en"}, "en", ""},
+		{[]string{"--locale", "fr"}, "fr", `unknown locale "fr"`},
+	}
+	for _, test := range tests {
+		o, _ := NewPluginOptions("check_foo", "", "")
+		fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		o.Register(fs)
+		err := o.Parse(fs, test.args)
+		t.Logf("Parse(%v) is %s, %v", test.args, o.Locale, err)
+		if o.Locale != test.locale || (err == nil) != (test.errorMsg == "") || (err != nil && !strings.HasPrefix(err.Error(), test.errorMsg)) {
+			t.Errorf("Parse(%v) should take the locale %s of the command line or environment", test.args, test.locale)
+		}
+		// the locale is selected by Run, not while parsing
+		if Locale() != DefaultLocale {
+			t.Errorf("Parse(%v) shouldn't select the locale", test.args)
+		}
+	}
+
+	o := &PluginOptions{Locale: "de", TranslateSummary: true}
+	o.selectLocale()
+	if Locale() != "de" || NewResultOk("disk").Message() != "alles in Ordnung" {
+		t.Errorf("selectLocale() should select the locale and summary translation")
+	}
+}
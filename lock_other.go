@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package icinga
+
+import "os"
+
+// lockFile is a no-op on platforms without flock(2)
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without flock(2)
+func unlockFile(f *os.File) error {
+	return nil
+}
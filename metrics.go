@@ -0,0 +1,472 @@
+package icinga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Sample is a labeled metric value emitted by a Collector
+	Sample struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels,omitempty"`
+		Value  float64           `json:"value"`
+		// Unit like s, B or % is appended to the value in messages
+		Unit string `json:"unit,omitempty"`
+		// Help describes the metric in the Prometheus output, defaults to
+		// the name
+		Help string `json:"help,omitempty"`
+	}
+
+	// Collector collects metric samples without deciding about statuses
+	Collector interface {
+		Collect(ctx context.Context) ([]Sample, error)
+	}
+
+	// CollectorFunc is a function implementing Collector
+	CollectorFunc func(ctx context.Context) ([]Sample, error)
+
+	// CollectorFactory creates a Collector from its config parameters
+	CollectorFactory func(params map[string]string) (Collector, error)
+
+	// CollectorRegistry contains the built-in and custom collectors
+	CollectorRegistry interface {
+		Register(name string, factory CollectorFactory) error
+		New(name string, params map[string]string) (Collector, error)
+		Names() []string
+	}
+
+	// EvaluationRule maps the samples of a metric to results
+	EvaluationRule struct {
+		// Metric is the name of the samples, Labels must all match
+		Metric string            `json:"metric"`
+		Labels map[string]string `json:"labels,omitempty"`
+		// Result is the result name, {label} is replaced by the label value
+		// of the sample. Defaults to the metric name and its labels.
+		Result string `json:"result,omitempty"`
+		// Warning and Critical are thresholds in range syntax, the result is
+		// OK without thresholds. They are added to the perfdata.
+		Warning  string `json:"warning,omitempty"`
+		Critical string `json:"critical,omitempty"`
+		// States maps values to statuses, e.g. {"0": "OK", "1": "CRITICAL"}
+		// for enumerations. Values not in the map are UNKNOWN.
+		States map[string]Status `json:"states,omitempty"`
+	}
+
+	// Evaluator maps samples to Results
+	Evaluator interface {
+		Evaluate(samples []Sample, results Results)
+	}
+
+	collectorRegistry struct {
+		sync.Mutex
+		factories map[string]CollectorFactory
+	}
+
+	evaluatorImpl struct {
+		rules []EvaluationRule
+		// warning and critical are the ranges of the rules, nil if not set
+		warning  []Range
+		critical []Range
+	}
+)
+
+// DefaultCollectors contains the built-in collectors file and loadavg, custom
+// collectors should be registered here as well
+var DefaultCollectors = NewCollectorRegistry()
+
+func init() {
+	DefaultCollectors.Register("file", newFileCollector)
+	DefaultCollectors.Register("loadavg", newLoadavgCollector)
+}
+
+// Collect calls f
+func (f CollectorFunc) Collect(ctx context.Context) ([]Sample, error) {
+	return f(ctx)
+}
+
+// NewCollectorRegistry creates an empty CollectorRegistry
+func NewCollectorRegistry() CollectorRegistry {
+	return &collectorRegistry{factories: make(map[string]CollectorFactory)}
+}
+
+// Register adds a collector, names must be unique
+func (r *collectorRegistry) Register(name string, factory CollectorFactory) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, found := r.factories[name]; found {
+		return fmt.Errorf("collector %q is already registered", name)
+	}
+	r.factories[name] = factory
+	return nil
+}
+
+// New creates a registered collector, its errors are prefixed with the name
+func (r *collectorRegistry) New(name string, params map[string]string) (Collector, error) {
+	r.Lock()
+	factory, found := r.factories[name]
+	r.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown collector %q, valid collectors are %s", name, strings.Join(r.Names(), ", "))
+	}
+	collector, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collector %s: %v", name, err)
+	}
+	return CollectorFunc(func(ctx context.Context) ([]Sample, error) {
+		samples, err := collector.Collect(ctx)
+		if err != nil {
+			return samples, fmt.Errorf("collector %s failed: %v", name, err)
+		}
+		return samples, nil
+	}), nil
+}
+
+// Names returns the sorted names of all collectors
+func (r *collectorRegistry) Names() []string {
+	r.Lock()
+	defer r.Unlock()
+	names := []string{}
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEvaluator creates an Evaluator for the given rules
+func NewEvaluator(rules []EvaluationRule) (Evaluator, error) {
+	e := &evaluatorImpl{rules: rules}
+	for _, rule := range rules {
+		if rule.Metric == "" {
+			return nil, fmt.Errorf("rule without metric")
+		}
+		warning, err := newOptionalRange(rule.Warning)
+		if err != nil {
+			return nil, fmt.Errorf("invalid warning threshold of rule for %s: %v", rule.Metric, err)
+		}
+		critical, err := newOptionalRange(rule.Critical)
+		if err != nil {
+			return nil, fmt.Errorf("invalid critical threshold of rule for %s: %v", rule.Metric, err)
+		}
+		e.warning = append(e.warning, warning)
+		e.critical = append(e.critical, critical)
+	}
+	return e, nil
+}
+
+// newOptionalRange returns nil for an empty threshold, which never alerts
+func newOptionalRange(threshold string) (Range, error) {
+	if threshold == "" {
+		return nil, nil
+	}
+	return NewRange(threshold)
+}
+
+// LoadEvaluator reads the rules of an Evaluator from a JSON file containing
+// a list of EvaluationRules
+func LoadEvaluator(path string) (Evaluator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evaluator rules: %v", err)
+	}
+	var rules []EvaluationRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse evaluator rules %s: %v", path, err)
+	}
+	return NewEvaluator(rules)
+}
+
+// Evaluate adds a Result with the sample as perfdata for every sample matching
+// a rule. A rule without matching samples adds an UNKNOWN Result, as well as
+// samples which map to the name of a result added before or lack a label of
+// the result name.
+func (e *evaluatorImpl) Evaluate(samples []Sample, results Results) {
+	added := make(map[string]Sample)
+	for i, rule := range e.rules {
+		matched := false
+		for _, sample := range samples {
+			if !rule.matches(sample) {
+				continue
+			}
+			matched = true
+
+			name, missing := rule.resultName(sample)
+			if missing != "" {
+				name = sample.ID()
+			}
+			if previous, found := added[name]; found {
+				results.Add(NewResultUnknownMessage(name, Translate(MessageDuplicate, previous.ID(), sample.ID())))
+				continue
+			}
+			added[name] = sample
+			if missing != "" {
+				results.Add(NewResultUnknownMessage(name, Translate(MessageMissingLabel, sample.ID(), missing, rule.Result)))
+				continue
+			}
+
+			status := ServiceStatusOk
+			switch {
+			case rule.States != nil:
+				var found bool
+				if status, found = rule.States[formatValue(sample.Value)]; !found {
+					status = ServiceStatusUnknown
+				}
+			case e.critical[i] != nil && e.critical[i].Check(sample.Value):
+				status = ServiceStatusCritical
+			case e.warning[i] != nil && e.warning[i].Check(sample.Value):
+				status = ServiceStatusWarning
+			}
+			message := Translate(MessageMetricValue, sample.Name, formatValue(sample.Value), sample.Unit)
+			results.Add(NewResultWithPerfdata(name, status, message, []Perfdata{{
+				Label:    name,
+				Value:    sample.Value,
+				Unit:     perfdataUnit(sample.Unit),
+				Warning:  rule.Warning,
+				Critical: rule.Critical,
+			}}))
+		}
+		if !matched {
+			name := rule.Result
+			if name == "" || strings.Contains(name, "{") {
+				name = rule.Metric
+			}
+			results.Add(NewResultUnknownMessage(name, Translate(MessageNoSamples, rule.Metric)))
+		}
+	}
+}
+
+func (rule *EvaluationRule) matches(sample Sample) bool {
+	if sample.Name != rule.Metric {
+		return false
+	}
+	for key, value := range rule.Labels {
+		if sample.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// resultName returns the result name of the sample, or the first label of
+// the name which is missing in the sample
+func (rule *EvaluationRule) resultName(sample Sample) (string, string) {
+	if rule.Result == "" {
+		return sample.ID(), ""
+	}
+	missing := ""
+	name := placeholderPattern.ReplaceAllStringFunc(rule.Result, func(placeholder string) string {
+		label := placeholder[1 : len(placeholder)-1]
+		value, found := sample.Labels[label]
+		if !found && missing == "" {
+			missing = label
+		}
+		return value
+	})
+	if missing != "" {
+		return "", missing
+	}
+	return name, ""
+}
+
+// perfdataUnit returns the unit if it is a valid perfdata unit, other units
+// like req/s are only shown in the message
+func perfdataUnit(unit string) string {
+	switch unit {
+	case "s", "ms", "us", "%", "B", "KB", "MB", "TB", "c":
+		return unit
+	}
+	return ""
+}
+
+// placeholderPattern matches the {label} placeholders of result names
+var placeholderPattern = regexp.MustCompile(`\{[^{}]+\}`)
+
+// ID returns the name and sorted labels like disk_used{mount="/"}
+func (s Sample) ID() string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	keys := []string{}
+	for key := range s.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	labels := []string{}
+	for _, key := range keys {
+		labels = append(labels, fmt.Sprintf("%s=%q", key, s.Labels[key]))
+	}
+	return s.Name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// Perfdata returns the sample as perfdata labeled with its ID
+func (s Sample) Perfdata() Perfdata {
+	return Perfdata{Label: s.ID(), Value: s.Value, Unit: perfdataUnit(s.Unit)}
+}
+
+// NewSamplesResult returns an OK Result with the samples as perfdata, e.g.
+// for samples without an Evaluator
+func NewSamplesResult(name string, samples []Sample) PerfdataResult {
+	perfdata := make([]Perfdata, 0, len(samples))
+	for _, sample := range samples {
+		perfdata = append(perfdata, sample.Perfdata())
+	}
+	return NewResultWithPerfdata(name, ServiceStatusOk, Translate(MessageSamples, len(samples)), perfdata)
+}
+
+// Metrics returns a ChecksFunc which collects the samples of all collectors
+// and evaluates them. Failed collectors are added as UNKNOWN Result named
+// CheckResultName, the samples of the others are still evaluated.
+func Metrics(evaluator Evaluator, collectors ...Collector) ChecksFunc {
+	return func(ctx context.Context, results Results) error {
+		samples := []Sample{}
+		failures := []string{}
+		for _, collector := range collectors {
+			collected, err := collector.Collect(ctx)
+			if err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			samples = append(samples, collected...)
+		}
+		evaluator.Evaluate(samples, results)
+		if len(failures) > 0 {
+			results.Add(NewResultUnknownMessage(CheckResultName, strings.Join(failures, ", ")))
+		}
+		return nil
+	}
+}
+
+// WritePrometheus writes samples in the Prometheus text exposition format as
+// gauges. Samples are grouped by name, invalid characters of names are
+// replaced by underscores.
+func WritePrometheus(w io.Writer, samples []Sample) error {
+	names := []string{}
+	families := make(map[string][]Sample)
+	for _, sample := range samples {
+		name := prometheusName(sample.Name, true)
+		if _, found := families[name]; !found {
+			names = append(names, name)
+		}
+		families[name] = append(families[name], sample)
+	}
+
+	for _, name := range names {
+		help := families[name][0].Help
+		if help == "" {
+			help = families[name][0].Name
+		}
+		help = strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help)
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name); err != nil {
+			return err
+		}
+		for _, sample := range families[name] {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(sample.Labels), formatValue(sample.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prometheusName replaces invalid characters of a metric or label name by
+// underscores, colons are only valid in metric names
+func prometheusName(name string, metric bool) string {
+	valid := []rune{}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':' && metric:
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				valid = append(valid, '_')
+			}
+		default:
+			r = '_'
+		}
+		valid = append(valid, r)
+	}
+	if len(valid) == 0 {
+		return "_"
+	}
+	return string(valid)
+}
+
+// prometheusLabels returns the sorted labels like {mount="/"}, values are
+// escaped as defined by the exposition format
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	escape := strings.NewReplacer("\\", `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := []string{}
+	for _, key := range keys {
+		pairs = append(pairs, prometheusName(key, false)+`="`+escape.Replace(labels[key])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// newFileCollector collects file_size and file_age of the file given by the
+// path parameter
+func newFileCollector(params map[string]string) (Collector, error) {
+	path := params["path"]
+	if path == "" {
+		return nil, fmt.Errorf("missing parameter path")
+	}
+	return CollectorFunc(func(ctx context.Context) ([]Sample, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		labels := map[string]string{"path": path}
+		return []Sample{
+			{Name: "file_size", Labels: labels, Value: float64(info.Size()), Unit: "B"},
+			{Name: "file_age", Labels: labels, Value: time.Since(info.ModTime()).Seconds(), Unit: "s"},
+		}, nil
+	}), nil
+}
+
+// newLoadavgCollector collects load1, load5 and load15 from /proc/loadavg
+func newLoadavgCollector(params map[string]string) (Collector, error) {
+	path := params["path"]
+	if path == "" {
+		path = "/proc/loadavg"
+	}
+	return CollectorFunc(func(ctx context.Context) ([]Sample, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(string(data))
+		samples := []Sample{}
+		for i, name := range []string{"load1", "load5", "load15"} {
+			if i >= len(fields) {
+				return nil, fmt.Errorf("invalid loadavg %q", data)
+			}
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid loadavg %q", data)
+			}
+			samples = append(samples, Sample{Name: name, Value: value})
+		}
+		return samples, nil
+	}), nil
+}
@@ -0,0 +1,222 @@
+package icinga
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvaluator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-metrics")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rules := filepath.Join(dir, "rules.json")
+	err = ioutil.WriteFile(rules, []byte(`[
+  {"metric": "disk_used", "result": "disk {mount}", "warning": "80", "critical": "90"},
+  {"metric": "raid_state", "labels": {"array": "md0"}, "states": {"0": "OK", "1": "WARNING", "2": "CRITICAL"}},
+  {"metric": "raid_state", "labels": {"array": "md1"}, "states": {"0": "OK"}},
+  {"metric": "missing", "critical": "1"},
+  {"metric": "temperature"}
+]`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	evaluator, err := LoadEvaluator(rules)
+	if err != nil {
+		t.Fatalf("LoadEvaluator() failed: %v", err)
+	}
+
+	collector := CollectorFunc(func(ctx context.Context) ([]Sample, error) {
+		return []Sample{
+			{Name: "disk_used", Labels: map[string]string{"mount": "/"}, Value: 85, Unit: "%"},
+			{Name: "disk_used", Labels: map[string]string{"mount": "/var"}, Value: 12.5, Unit: "%"},
+			{Name: "disk_used", Labels: map[string]string{"mount": "/", "device": "sda2"}, Value: 10, Unit: "%"},
+			{Name: "disk_used", Labels: map[string]string{"device": "sdb1"}, Value: 10, Unit: "%"},
+			{Name: "raid_state", Labels: map[string]string{"array": "md0"}, Value: 2},
+			{Name: "raid_state", Labels: map[string]string{"array": "md1"}, Value: 3},
+			{Name: "temperature", Value: -5, Unit: "C"},
+		}, nil
+	})
+	failing := CollectorFunc(func(ctx context.Context) ([]Sample, error) {
+		return nil, errors.New("collector broken failed: no data")
+	})
+
+	results := NewResults()
+	if err := Metrics(evaluator, collector, failing)(context.Background(), results); err != nil {
+		t.Fatalf("Metrics() failed: %v", err)
+	}
+	t.Logf("Metrics() is %v", results)
+
+	shouldBe := []string{
+		`disk /: UNKNOWN: samples disk_used{mount="/"} and disk_used{device="sda2",mount="/"} map to the same result`,
+		"disk /var: OK: disk_used is 12.5%",
+		`disk_used{device="sdb1"}: UNKNOWN: sample disk_used{device="sdb1"} has no label mount for result disk {mount}`,
+		`raid_state{array="md0"}: CRITICAL: raid_state is 2`,
+		`raid_state{array="md1"}: UNKNOWN: raid_state is 3`,
+		"missing: UNKNOWN: no samples for metric missing",
+		"temperature: OK: temperature is -5C",
+		"check: UNKNOWN: collector broken failed: no data",
+	}
+	all := results.All()
+	if len(all) != len(shouldBe) {
+		t.Fatalf("Metrics() should add %d results", len(shouldBe))
+	}
+	for i, result := range all {
+		if s := fmt.Sprintf("%s: %s: %s", result.Name(), result.Status(), result.Message()); s != shouldBe[i] {
+			t.Errorf("result %d should be %v but is %v", i, shouldBe[i], s)
+		}
+	}
+
+	// the samples are the perfdata of their results, with the thresholds of
+	// the rule and only valid perfdata units
+	perfdata := perfdataString(ResultsPerfdata(results))
+	t.Logf("perfdata is %s", perfdata)
+	if shouldBe := `'disk /var'=12.5%;80;90 'raid_state{array="md0"}'=2 'raid_state{array="md1"}'=3 temperature=-5`; perfdata != shouldBe {
+		t.Errorf("perfdata should be %s", shouldBe)
+	}
+
+	for _, invalid := range [][]EvaluationRule{{{}}, {{Metric: "a", Warning: "x"}}} {
+		if _, err := NewEvaluator(invalid); err == nil {
+			t.Errorf("NewEvaluator(%v) should fail", invalid)
+		}
+	}
+}
+
+func TestNewSamplesResult(t *testing.T) {
+	result := NewSamplesResult("metrics", []Sample{
+		{Name: "queue", Labels: map[string]string{"name": "mail"}, Value: 12},
+		{Name: "age", Value: 1.5, Unit: "s"},
+		{Name: "temperature", Value: 20, Unit: "C"},
+	})
+	t.Logf("NewSamplesResult() is %v %s", result, perfdataString(result.Perfdata()))
+	if result.Status() != ServiceStatusOk || result.Message() != "collected samples: 3" {
+		t.Errorf("NewSamplesResult() should be OK with the number of samples")
+	}
+	if shouldBe := `'queue{name="mail"}'=12 age=1.5s temperature=20`; perfdataString(result.Perfdata()) != shouldBe {
+		t.Errorf("perfdata should be %s", shouldBe)
+	}
+}
+
+func TestCollectorRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-metrics")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+	if err := ioutil.WriteFile(path, []byte("12345"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	registry := NewCollectorRegistry()
+	registry.Register("file", newFileCollector)
+	err = registry.Register("custom", func(params map[string]string) (Collector, error) {
+		return CollectorFunc(func(ctx context.Context) ([]Sample, error) {
+			return nil, errors.New("unreachable")
+		}), nil
+	})
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	if err := registry.Register("custom", nil); err == nil {
+		t.Errorf("Register() should fail for duplicate names")
+	}
+	if names := fmt.Sprint(registry.Names()); names != "[custom file]" {
+		t.Errorf("Names() should be [custom file] but is %v", names)
+	}
+
+	collector, err := registry.New("file", map[string]string{"path": path})
+	if err != nil {
+		t.Fatalf("New(file) failed: %v", err)
+	}
+	samples, err := collector.Collect(context.Background())
+	if err != nil || len(samples) != 2 || samples[0].Value != 5 {
+		t.Errorf("file collector should return the size and age but is %v, %v", samples, err)
+	}
+
+	custom, _ := registry.New("custom", nil)
+	_, err = custom.Collect(context.Background())
+	if err == nil || err.Error() != "collector custom failed: unreachable" {
+		t.Errorf("Collect() should prefix the collector name but is %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		errorMsg string
+	}{
+		{"unknown", nil, `unknown collector "unknown", valid collectors are custom, file`},
+		{"file", nil, "invalid collector file: missing parameter path"},
+	}
+	for _, test := range tests {
+		_, err := registry.New(test.name, test.params)
+		t.Logf("New(%v) is %v", test.name, err)
+		if err == nil || err.Error() != test.errorMsg {
+			t.Errorf("New(%v) should fail with: %v", test.name, test.errorMsg)
+		}
+	}
+
+	if names := fmt.Sprint(DefaultCollectors.Names()); names != "[file loadavg]" {
+		t.Errorf("DefaultCollectors should contain the built-in collectors but is %v", names)
+	}
+}
+
+func TestLoadavgCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-metrics")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "loadavg")
+	if err := ioutil.WriteFile(path, []byte("0.52 0.58 0.59 1/467 12345\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	collector, err := DefaultCollectors.New("loadavg", map[string]string{"path": path})
+	if err != nil {
+		t.Fatalf("New(loadavg) failed: %v", err)
+	}
+	samples, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+
+	var buffer bytes.Buffer
+	WritePrometheus(&buffer, append(samples, Sample{Name: "disk_used", Labels: map[string]string{"mount": "/", "device": "sda1"}, Value: 1e9}))
+	shouldBe := "# HELP load1 load1\n# TYPE load1 gauge\nload1 0.52\n" +
+		"# HELP load5 load5\n# TYPE load5 gauge\nload5 0.58\n" +
+		"# HELP load15 load15\n# TYPE load15 gauge\nload15 0.59\n" +
+		"# HELP disk_used disk_used\n# TYPE disk_used gauge\ndisk_used{device=\"sda1\",mount=\"/\"} 1e+09\n"
+	t.Logf("WritePrometheus() is:\n%s", buffer.String())
+	if buffer.String() != shouldBe {
+		t.Errorf("WritePrometheus() should be:\n%s", shouldBe)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	samples := []Sample{
+		{Name: "disk.used", Labels: map[string]string{"mount": "C:\\", "label-x": "a \"b\"\nc"}, Value: 1, Help: "used\\free\nbytes"},
+		{Name: "1st", Value: 2},
+		{Name: "disk.used", Labels: map[string]string{"mount": "/"}, Value: 3},
+	}
+	var buffer bytes.Buffer
+	if err := WritePrometheus(&buffer, samples); err != nil {
+		t.Fatalf("WritePrometheus() failed: %v", err)
+	}
+	shouldBe := "# HELP disk_used used\\\\free\\nbytes\n# TYPE disk_used gauge\n" +
+		"disk_used{label_x=\"a \\\"b\\\"\\nc\",mount=\"C:\\\\\"} 1\n" +
+		"disk_used{mount=\"/\"} 3\n" +
+		"# HELP _1st 1st\n# TYPE _1st gauge\n_1st 2\n"
+	t.Logf("WritePrometheus() is:\n%s", buffer.String())
+	if buffer.String() != shouldBe {
+		t.Errorf("WritePrometheus() should be:\n%s", shouldBe)
+	}
+}
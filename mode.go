@@ -0,0 +1,250 @@
+package icinga
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type (
+	// Mode is a mode of a plugin selected with --mode, e.g. connections or
+	// replication of a database plugin
+	Mode struct {
+		Name        string
+		Description string
+		// Warning and Critical are the default thresholds of the mode, empty
+		// values keep the defaults passed to NewPluginOptions
+		Warning  string
+		Critical string
+		// Flags registers the options of the mode, they are only accepted on
+		// the command line together with the mode
+		Flags func(fs *flag.FlagSet)
+		// Check runs the mode, see RunMode
+		Check ChecksFunc
+	}
+
+	// modeEntry is a registered Mode with its own options
+	modeEntry struct {
+		Mode
+		fs *flag.FlagSet
+	}
+
+	// modeValue is an option shared by several modes, it is set in all of
+	// them
+	modeValue []flag.Value
+)
+
+// AddMode registers a mode, it must be called before Register
+func (o *PluginOptions) AddMode(mode Mode) error {
+	if mode.Name == "" {
+		return fmt.Errorf("mode without name")
+	}
+	if _, found := o.lookupMode(mode.Name); found {
+		return fmt.Errorf("duplicate mode %q", mode.Name)
+	}
+	for _, threshold := range []string{mode.Warning, mode.Critical} {
+		if _, err := NewRange(threshold); threshold != "" && err != nil {
+			return fmt.Errorf("invalid threshold for mode %s: %v", mode.Name, err)
+		}
+	}
+
+	fs := flag.NewFlagSet(mode.Name, flag.ContinueOnError)
+	if mode.Flags != nil {
+		mode.Flags(fs)
+	}
+	o.modes = append(o.modes, &modeEntry{mode, fs})
+	return nil
+}
+
+// Modes returns all registered modes in the order they were added
+func (o *PluginOptions) Modes() []Mode {
+	modes := []Mode{}
+	for _, m := range o.modes {
+		modes = append(modes, m.Mode)
+	}
+	return modes
+}
+
+// RunMode runs the Check of the selected mode like RunContext
+func (o *PluginOptions) RunMode() {
+	m, found := o.lookupMode(o.Mode)
+	if !found || m.Check == nil {
+		ExitUsage(fmt.Errorf("mode %q can't be run", o.Mode))
+	}
+	o.RunContext(m.Check)
+}
+
+func (o *PluginOptions) lookupMode(name string) (*modeEntry, bool) {
+	for _, m := range o.modes {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (o *PluginOptions) modeNames() string {
+	names := []string{}
+	for _, m := range o.modes {
+		names = append(names, m.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// registerModes registers --mode and the options of all modes on fs
+func (o *PluginOptions) registerModes(fs *flag.FlagSet) {
+	fs.StringVar(&o.Mode, "mode", "", "check mode, one of "+o.modeNames())
+
+	shared := make(map[string]modeValue)
+	usage := make(map[string]string)
+	names := []string{}
+	for _, m := range o.modes {
+		m.fs.VisitAll(func(f *flag.Flag) {
+			if _, found := shared[f.Name]; !found {
+				names = append(names, f.Name)
+				usage[f.Name] = f.Usage
+			}
+			shared[f.Name] = append(shared[f.Name], f.Value)
+		})
+	}
+	for _, name := range names {
+		if values := shared[name]; len(values) == 1 {
+			fs.Var(values[0], name, usage[name])
+		} else {
+			fs.Var(values, name, usage[name])
+		}
+	}
+	fs.Usage = func() {
+		o.writeUsage(fs)
+	}
+}
+
+// selectMode checks the selected mode and its options and sets its default
+// thresholds
+func (o *PluginOptions) selectMode() error {
+	if len(o.modes) == 0 {
+		return nil
+	}
+	if o.Mode == "" {
+		return fmt.Errorf("--mode is required, valid modes are %s", o.modeNames())
+	}
+	selected, found := o.lookupMode(o.Mode)
+	if !found {
+		return fmt.Errorf("unknown mode %q, valid modes are %s", o.Mode, o.modeNames())
+	}
+
+	// options of other modes must not be given on the command line, other
+	// sources like config files are shared by all modes
+	invalid := []string{}
+	for name, source := range o.sources {
+		if source == "command line" && selected.fs.Lookup(name) == nil && o.isModeFlag(name) {
+			invalid = append(invalid, "-"+name)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("mode %s doesn't support %s", o.Mode, strings.Join(invalid, ", "))
+	}
+
+	// thresholds may be given by their aliases like w
+	given := o.given()
+	if !given["warning"] && selected.Warning != "" {
+		o.Thresholds.Warning.Set(selected.Warning)
+		o.sources["warning"] = "mode " + o.Mode
+	}
+	if !given["critical"] && selected.Critical != "" {
+		o.Thresholds.Critical.Set(selected.Critical)
+		o.sources["critical"] = "mode " + o.Mode
+	}
+	return nil
+}
+
+func (o *PluginOptions) isModeFlag(name string) bool {
+	for _, m := range o.modes {
+		if m.fs.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeUsage writes the common options followed by every mode with its
+// default thresholds and options
+func (o *PluginOptions) writeUsage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "Usage of %s:\n", fs.Name())
+	common := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	common.SetOutput(w)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !o.isModeFlag(f.Name) {
+			common.Var(f.Value, f.Name, f.Usage)
+			common.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	common.PrintDefaults()
+	o.WriteModes(w)
+}
+
+// WriteModes writes the description, default thresholds and options of all
+// modes
+func (o *PluginOptions) WriteModes(w io.Writer) {
+	fmt.Fprintf(w, "\nModes:\n")
+	for _, m := range o.modes {
+		fmt.Fprintf(w, "  %s\n", m.Name)
+		if m.Description != "" {
+			fmt.Fprintf(w, "    \t%s\n", m.Description)
+		}
+		if m.Warning != "" || m.Critical != "" {
+			fmt.Fprintf(w, "    \tdefault thresholds: warning %q, critical %q\n", m.Warning, m.Critical)
+		}
+
+		// indent the options of the mode
+		var options bytes.Buffer
+		m.fs.SetOutput(&options)
+		m.fs.PrintDefaults()
+		for _, line := range strings.SplitAfter(options.String(), "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "  %s", line)
+			}
+		}
+	}
+}
+
+// Set sets the value in all modes
+func (v modeValue) Set(value string) error {
+	for _, shared := range v {
+		if err := shared.Set(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v modeValue) String() string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0].String()
+}
+
+// IsBoolFlag allows to use shared bool options without value
+func (v modeValue) IsBoolFlag() bool {
+	if len(v) == 0 {
+		return false
+	}
+	b, ok := v[0].(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Type returns the pflag type name of the shared option
+func (v modeValue) Type() string {
+	if len(v) > 0 {
+		if t, ok := v[0].(interface{ Type() string }); ok {
+			return t.Type()
+		}
+	}
+	return "string"
+}
@@ -0,0 +1,152 @@
+package icinga
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newModeOptions(t *testing.T) (*PluginOptions, *flag.FlagSet, map[string]*string) {
+	o, err := NewPluginOptions("check_db", "10", "20")
+	if err != nil {
+		t.Fatalf("failed to create plugin options: %v", err)
+	}
+	values := map[string]*string{}
+	modes := []Mode{
+		{
+			Name:        "connections",
+			Description: "number of connections",
+			Warning:     "100",
+			Critical:    "200",
+			Flags: func(fs *flag.FlagSet) {
+				values["connections.database"] = fs.String("database", "", "database name")
+				values["user"] = fs.String("user", "", "user name")
+			},
+		},
+		{
+			Name:        "replication",
+			Description: "replication lag in seconds",
+			Flags: func(fs *flag.FlagSet) {
+				values["replication.database"] = fs.String("database", "", "database name")
+			},
+			Check: func(ctx context.Context, results Results) error {
+				results.Add(NewResult("replication", ServiceStatusOk, "in sync"))
+				return nil
+			},
+		},
+	}
+	for _, mode := range modes {
+		if err := o.AddMode(mode); err != nil {
+			t.Fatalf("AddMode(%v) failed: %v", mode.Name, err)
+		}
+	}
+	fs := flag.NewFlagSet("check_db", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	o.Register(fs)
+	return o, fs, values
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		args     []string
+		warning  string
+		critical string
+		database string
+		errorMsg string
+	}{
+		{[]string{"--mode", "connections", "--database", "foo"}, "100", "200", "foo", ""},
+		{[]string{"--mode", "connections", "-w", "50"}, "50", "200", "", ""},
+		{[]string{"--mode", "replication", "--database", "bar"}, "10", "20", "bar", ""},
+		{[]string{"--mode", "replication", "--user", "x"}, "", "", "", "mode replication doesn't support -user"},
+		{[]string{"--mode", "locks"}, "", "", "", `unknown mode "locks", valid modes are connections, replication`},
+		{[]string{}, "", "", "", "--mode is required, valid modes are connections, replication"},
+	}
+	for _, test := range tests {
+		o, fs, values := newModeOptions(t)
+		err := o.Parse(fs, test.args)
+		t.Logf("Parse(%v) is %v", test.args, err)
+		if test.errorMsg != "" {
+			if err == nil || err.Error() != test.errorMsg {
+				t.Errorf("Parse(%v) should fail with: %v", test.args, test.errorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%v) should not fail", test.args)
+			continue
+		}
+		if o.Thresholds.Warning.String() != test.warning || o.Thresholds.Critical.String() != test.critical {
+			t.Errorf("Parse(%v) should set thresholds %v/%v but they are %v/%v", test.args,
+				test.warning, test.critical, o.Thresholds.Warning, o.Thresholds.Critical)
+		}
+		if *values[o.Mode+".database"] != test.database {
+			t.Errorf("Parse(%v) should set database %q but it is %q", test.args, test.database, *values[o.Mode+".database"])
+		}
+	}
+}
+
+func TestModesAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-mode")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ini := writeTestFile(t, dir, "plugins.ini", "[check_db]\nw = 60\nc = 70\n")
+
+	// thresholds given by their aliases win over the defaults of the mode
+	o, fs, _ := newModeOptions(t)
+	if err := o.Parse(fs, []string{"--mode", "connections", "--extra-opts", "@" + ini}); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	t.Logf("thresholds are %v/%v", o.Thresholds.Warning, o.Thresholds.Critical)
+	if o.Thresholds.Warning.String() != "60" || o.Thresholds.Critical.String() != "70" {
+		t.Errorf("thresholds should be 60/70 from extra-opts")
+	}
+}
+
+func TestModesInvalid(t *testing.T) {
+	o, err := NewPluginOptions("check_db", "", "")
+	if err != nil {
+		t.Fatalf("failed to create plugin options: %v", err)
+	}
+	tests := []struct {
+		mode     Mode
+		errorMsg string
+	}{
+		{Mode{Name: ""}, "mode without name"},
+		{Mode{Name: "a", Critical: "x"}, `invalid threshold for mode a: failed to parse upper limit: strconv.ParseFloat: parsing "x": invalid syntax`},
+		{Mode{Name: "b"}, ""},
+		{Mode{Name: "b"}, `duplicate mode "b"`},
+	}
+	for _, test := range tests {
+		err := o.AddMode(test.mode)
+		t.Logf("AddMode(%v) is %v", test.mode.Name, err)
+		if test.errorMsg == "" && err != nil || test.errorMsg != "" && (err == nil || err.Error() != test.errorMsg) {
+			t.Errorf("AddMode(%v) should fail with: %v", test.mode.Name, test.errorMsg)
+		}
+	}
+}
+
+func TestModesUsage(t *testing.T) {
+	o, fs, _ := newModeOptions(t)
+	var buffer bytes.Buffer
+	fs.SetOutput(&buffer)
+	fs.Usage()
+	usage := buffer.String()
+	t.Logf("usage is:\n%s", usage)
+	for _, s := range []string{"-mode string", "connections\n", "default thresholds: warning \"100\"", "replication lag"} {
+		if !strings.Contains(usage, s) {
+			t.Errorf("usage should contain %q", s)
+		}
+	}
+	if strings.Count(usage, "-database") != 2 {
+		t.Errorf("usage should list -database once per mode")
+	}
+	if len(o.Modes()) != 2 || o.Modes()[1].Check == nil {
+		t.Errorf("Modes() should return the added modes")
+	}
+}
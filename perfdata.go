@@ -0,0 +1,185 @@
+package icinga
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Perfdata is a performance data value of a Result, it is written as
+	// 'label'=value[unit];[warning];[critical];[min];[max]
+	Perfdata struct {
+		Label string  `json:"label"`
+		Value float64 `json:"value"`
+		// Unit is one of s, ms, us, %, B, KB, MB, TB, c or empty
+		Unit string `json:"unit,omitempty"`
+		// Warning and Critical are thresholds in range syntax
+		Warning  string   `json:"warning,omitempty"`
+		Critical string   `json:"critical,omitempty"`
+		Min      *float64 `json:"min,omitempty"`
+		Max      *float64 `json:"max,omitempty"`
+	}
+
+	// PerfdataResult is a Result with performance data, which is appended to
+	// the first line of the plugin output
+	PerfdataResult interface {
+		Result
+		Perfdata() []Perfdata
+	}
+)
+
+// NewResultWithPerfdata creates a new instance of PerfdataResult
+func NewResultWithPerfdata(name string, status Status, message string, perfdata []Perfdata) PerfdataResult {
+	return &resultImpl{name: name, status: status, message: message, perfdata: append([]Perfdata{}, perfdata...)}
+}
+
+// NewResultWithDetailsAndPerfdata creates a new instance of PerfdataResult
+// with ordered detail lines, it is a DetailedResult as well
+func NewResultWithDetailsAndPerfdata(name string, status Status, message string, details []string, perfdata []Perfdata) PerfdataResult {
+	return &resultImpl{name, status, message, append([]string{}, details...), append([]Perfdata{}, perfdata...)}
+}
+
+// Perfdata returns the performance data
+func (r *resultImpl) Perfdata() []Perfdata {
+	return r.perfdata
+}
+
+// ResultPerfdata returns the performance data of a PerfdataResult
+func ResultPerfdata(result Result) []Perfdata {
+	if withPerfdata, ok := result.(PerfdataResult); ok {
+		return withPerfdata.Perfdata()
+	}
+	return nil
+}
+
+// ResultsPerfdata returns the performance data of all results in the order
+// they were added
+func ResultsPerfdata(results Results) []Perfdata {
+	perfdata := []Perfdata{}
+	for _, result := range resultList(results) {
+		perfdata = append(perfdata, ResultPerfdata(result)...)
+	}
+	return perfdata
+}
+
+// ParsePerfdata parses a single value like 'used'=85%;80;90;0;100
+func ParsePerfdata(s string) (Perfdata, error) {
+	var p Perfdata
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return p, fmt.Errorf("invalid perfdata %q", s)
+	}
+	p.Label = s[:i]
+	if strings.HasPrefix(p.Label, "'") {
+		if len(p.Label) < 3 || !strings.HasSuffix(p.Label, "'") {
+			return p, fmt.Errorf("invalid perfdata label %s", p.Label)
+		}
+		p.Label = strings.Replace(p.Label[1:len(p.Label)-1], "''", "'", -1)
+	}
+
+	fields := strings.Split(s[i+1:], ";")
+	if len(fields) > 5 {
+		return p, fmt.Errorf("invalid perfdata %q", s)
+	}
+	value := strings.TrimRight(fields[0], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ%")
+	p.Unit = fields[0][len(value):]
+	var err error
+	if p.Value, err = strconv.ParseFloat(value, 64); err != nil {
+		return p, fmt.Errorf("invalid perfdata value %q", fields[0])
+	}
+	for j, field := range fields[1:] {
+		switch {
+		case field == "":
+		case j < 2:
+			if _, err := NewRange(field); err != nil {
+				return p, fmt.Errorf("invalid perfdata threshold %q: %v", field, err)
+			}
+			if j == 0 {
+				p.Warning = field
+			} else {
+				p.Critical = field
+			}
+		default:
+			limit, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return p, fmt.Errorf("invalid perfdata limit %q", field)
+			}
+			if j == 2 {
+				p.Min = &limit
+			} else {
+				p.Max = &limit
+			}
+		}
+	}
+	return p, nil
+}
+
+// ParsePerfdataList parses values separated by spaces like the perfdata of
+// a plugin output, quoted labels may contain spaces
+func ParsePerfdataList(s string) ([]Perfdata, error) {
+	perfdata := []Perfdata{}
+	quoted := false
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] == '\'' {
+			quoted = !quoted
+		}
+		if i == len(s) || (s[i] == ' ' && !quoted) {
+			if start >= 0 {
+				p, err := ParsePerfdata(s[start:i])
+				if err != nil {
+					return nil, err
+				}
+				perfdata = append(perfdata, p)
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("invalid perfdata %q", s)
+	}
+	return perfdata, nil
+}
+
+// String returns the perfdata in the plugin output format, the label is
+// quoted if necessary
+func (p Perfdata) String() string {
+	label := p.Label
+	if strings.ContainsAny(label, " '=\t") {
+		label = "'" + strings.Replace(label, "'", "''", -1) + "'"
+	}
+	fields := []string{label + "=" + formatValue(p.Value) + p.Unit, p.Warning, p.Critical, "", ""}
+	if p.Min != nil {
+		fields[3] = formatValue(*p.Min)
+	}
+	if p.Max != nil {
+		fields[4] = formatValue(*p.Max)
+	}
+	return strings.TrimRight(strings.Join(fields, ";"), ";")
+}
+
+// perfdataString returns the perfdata separated by spaces
+func perfdataString(perfdata []Perfdata) string {
+	values := make([]string, len(perfdata))
+	for i, p := range perfdata {
+		values[i] = p.String()
+	}
+	return strings.Join(values, " ")
+}
+
+// writePerfdata writes " | " followed by the perfdata separated by spaces,
+// nothing is written without perfdata
+func writePerfdata(sw *countingWriter, perfdata []Perfdata) {
+	for i, p := range perfdata {
+		if i == 0 {
+			sw.WriteString(" |")
+		}
+		sw.WriteString(" ")
+		sw.WriteString(p.String())
+	}
+}
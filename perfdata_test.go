@@ -0,0 +1,76 @@
+package icinga
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPerfdata(t *testing.T) {
+	tests := []struct {
+		perfdata string
+		shouldBe string
+	}{
+		{"used=85%;80;90;0;100", ""},
+		{"load1=0.5", ""},
+		{"'disk /var'=12B;;~:100", ""},
+		{"'it''s'=1c", ""},
+		{"time=1.5s;;;0", ""},
+		{"count=3;;;;", "count=3"},
+	}
+	for _, test := range tests {
+		p, err := ParsePerfdata(test.perfdata)
+		if err != nil {
+			t.Errorf("ParsePerfdata(%q) failed: %v", test.perfdata, err)
+			continue
+		}
+		shouldBe := test.shouldBe
+		if shouldBe == "" {
+			shouldBe = test.perfdata
+		}
+		t.Logf("ParsePerfdata(%q) is %+v", test.perfdata, p)
+		if p.String() != shouldBe {
+			t.Errorf("ParsePerfdata(%q) should be written as %s but is %s", test.perfdata, shouldBe, p)
+		}
+	}
+
+	for _, invalid := range []string{"used", "=1", "used=x", "used=1;x", "used=1;;;x", "'used=1", "used=1;;;;;"} {
+		if _, err := ParsePerfdata(invalid); err == nil {
+			t.Errorf("ParsePerfdata(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestParsePerfdataList(t *testing.T) {
+	perfdata, err := ParsePerfdataList(" used=85%;80;90  'disk usage'=1B 'it''s'=2 ")
+	t.Logf("ParsePerfdataList() is %v, %v", perfdata, err)
+	if err != nil || perfdataString(perfdata) != "used=85%;80;90 'disk usage'=1B 'it''s'=2" {
+		t.Errorf("ParsePerfdataList() should parse all values")
+	}
+	for _, invalid := range []string{"used=1 x", "'disk usage=1"} {
+		if _, err := ParsePerfdataList(invalid); err == nil {
+			t.Errorf("ParsePerfdataList(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestResultsPerfdata(t *testing.T) {
+	max := 100.0
+	results := NewResults()
+	results.Add(NewResultWithPerfdata("disk", ServiceStatusWarning, "85% used", []Perfdata{
+		{Label: "used", Value: 85, Unit: "%", Warning: "80", Critical: "90", Max: &max},
+	}))
+	results.Add(NewResultOk("mail"))
+	results.Add(NewResultWithPerfdata("load", ServiceStatusOk, "load 0.5", []Perfdata{{Label: "load1", Value: 0.5}}))
+
+	shouldBe := `WARNING: warning: [disk] ok: [mail load] | used=85%;80;90;;100 load1=0.5
+WARNING: disk: 85% used
+OK: mail: everything ok
+OK: load: load 0.5
+`
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("results should be:\n%s\nbut are:\n%s", shouldBe, results)
+	}
+	if perfdata := ResultsPerfdata(results); len(perfdata) != 2 || perfdata[1].Label != "load1" {
+		t.Errorf("ResultsPerfdata() should return the perfdata of all results but is %v", perfdata)
+	}
+}
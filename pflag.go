@@ -0,0 +1,36 @@
+package icinga
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// RegisterPFlags registers the standard options on a pflag.FlagSet, e.g. the
+// flags of a cobra command. Single letter options become shorthands. After
+// parsing, ApplyPFlags must be called, e.g. in PreRunE of a cobra command.
+func (o *PluginOptions) RegisterPFlags(pfs *pflag.FlagSet) {
+	fs := flag.NewFlagSet(pfs.Name(), flag.ContinueOnError)
+	o.Register(fs)
+	pfs.AddGoFlagSet(fs)
+	o.fs = fs
+}
+
+// ApplyPFlags applies the other sources of options with Apply after pfs was
+// parsed, options changed in pfs are taken from the command line
+func (o *PluginOptions) ApplyPFlags(pfs *pflag.FlagSet) error {
+	if o.fs == nil {
+		return fmt.Errorf("options have not been registered")
+	}
+	return o.Apply(o.fs, pfs.Changed)
+}
+
+// ParsePFlags parses the command line with pfs and applies the other
+// sources of options, the options must be registered with RegisterPFlags
+func (o *PluginOptions) ParsePFlags(pfs *pflag.FlagSet, args []string) error {
+	if err := pfs.Parse(args); err != nil {
+		return err
+	}
+	return o.ApplyPFlags(pfs)
+}
@@ -0,0 +1,49 @@
+package icinga
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	_ pflag.Value = &RangeValue{}
+	_ pflag.Value = &StatusValue{}
+	_ pflag.Value = &verbosityValue{}
+	_ pflag.Value = &timeoutValue{}
+)
+
+func TestParsePFlags(t *testing.T) {
+	os.Setenv("CHECK_FOO_WARNING", "1")
+	os.Setenv("CHECK_FOO_CRITICAL", "2")
+	defer os.Unsetenv("CHECK_FOO_WARNING")
+	defer os.Unsetenv("CHECK_FOO_CRITICAL")
+
+	o, _ := NewPluginOptions("check_foo", "10", "20")
+	pfs := pflag.NewFlagSet("check_foo", pflag.ContinueOnError)
+	o.RegisterPFlags(pfs)
+	if err := o.ParsePFlags(pfs, []string{"-w", "5:", "-t", "30", "-v", "-v", "--output", "json"}); err != nil {
+		t.Fatalf("ParsePFlags() failed: %v", err)
+	}
+
+	// the command line wins over environment variables
+	if o.Thresholds.Warning.String() != "5:" || o.Thresholds.Critical.String() != "2" {
+		t.Errorf("thresholds should be 5: and 2 but are %v and %v", o.Thresholds.Warning, o.Thresholds.Critical)
+	}
+	if o.Timeout != 30*time.Second || o.Verbosity != 2 || o.Output != "json" {
+		t.Errorf("options should be parsed but are %+v", o)
+	}
+
+	for _, args := range [][]string{{"--output", "xml"}, {"-t", "0"}, {"--profile", "prod"}} {
+		o, _ := NewPluginOptions("check_foo", "10", "20")
+		pfs := pflag.NewFlagSet("check_foo", pflag.ContinueOnError)
+		o.RegisterPFlags(pfs)
+		err := o.ParsePFlags(pfs, args)
+		t.Logf("ParsePFlags(%v) is %v", args, err)
+		if err == nil {
+			t.Errorf("ParsePFlags(%v) should fail", args)
+		}
+	}
+}
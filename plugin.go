@@ -0,0 +1,467 @@
+package icinga
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type (
+	// PluginOptions are the standard options of a check plugin
+	PluginOptions struct {
+		Name       string
+		Thresholds *StatusCheckValue
+		Timeout    time.Duration
+		// StreamTimeout replaces Timeout for ndjson output, so long running
+		// checks are not cut off after the plugin timeout
+		StreamTimeout time.Duration
+		Verbosity     int
+		ExtraOpts     string
+		// Output is text, json or ndjson, see RunContext for ndjson
+		Output string
+		// Repeat runs the check multiple times for debugging, see Run
+		Repeat   int
+		Interval time.Duration
+		// ConfigFile is read with LoadConfig, Profile is a comma separated
+		// list of its profiles. The table of ConfigHost is applied last, it
+		// defaults to ConfigHost().
+		ConfigFile string
+		Profile    string
+		ConfigHost string
+		// ShowConfig prints the effective configuration instead of running
+		// the check
+		ShowConfig bool
+		// Mode is the selected mode if modes were added with AddMode
+		Mode string
+		// Faults are injected into RunContext, only plugins listed in
+		// FaultInjectionAllowFile accept them
+		Faults FaultsValue
+		// Locale selects the language of library messages, Run and
+		// RunContext select it for the whole process, see SetLocale
+		Locale string
+		// TranslateSummary translates the status group labels and the
+		// success message as well, see SetSummaryTranslated
+		TranslateSummary bool
+		// LogSink is syslog or journald to write the results to the system
+		// log on Exit, see NewSystemLogSink
+		LogSink string
+
+		fs      *flag.FlagSet
+		sources map[string]string
+		modes   []*modeEntry
+	}
+
+	// timeoutValue parses plain seconds like the Nagios plugins do as well as
+	// durations like 1m30s
+	timeoutValue struct {
+		timeout *time.Duration
+	}
+
+	resultsJSON struct {
+		Status  Status         `json:"status"`
+		Message string         `json:"message"`
+		Results []HistoryEntry `json:"results"`
+	}
+)
+
+const (
+	// DefaultTimeout is the default plugin timeout
+	DefaultTimeout = 10 * time.Second
+	// DefaultStreamTimeout is the default timeout with ndjson output
+	DefaultStreamTimeout = time.Hour
+)
+
+// NewPluginOptions creates the standard options of a plugin with default
+// thresholds
+func NewPluginOptions(name string, warning string, critical string) (*PluginOptions, error) {
+	thresholds, err := NewStatusCheckValue(warning, critical)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginOptions{
+		Name:          name,
+		Thresholds:    thresholds,
+		Timeout:       DefaultTimeout,
+		StreamTimeout: DefaultStreamTimeout,
+		Output:        "text",
+	}, nil
+}
+
+// Register registers the standard options on fs. Single letter flags become
+// shorthands when fs is added to a pflag.FlagSet. If modes were added,
+// --mode and the options of all modes are registered as well.
+func (o *PluginOptions) Register(fs *flag.FlagSet) {
+	for _, name := range []string{"w", "warning"} {
+		fs.Var(o.Thresholds.Warning, name, "warning threshold")
+	}
+	for _, name := range []string{"c", "critical"} {
+		fs.Var(o.Thresholds.Critical, name, "critical threshold")
+	}
+	timeout := &timeoutValue{&o.Timeout}
+	for _, name := range []string{"t", "timeout"} {
+		fs.Var(timeout, name, "plugin timeout in seconds or as duration")
+	}
+	fs.Var(&timeoutValue{&o.StreamTimeout}, "stream-timeout", "timeout with ndjson output in seconds or as duration")
+	verbosity := &verbosityValue{&o.Verbosity}
+	for _, name := range []string{"v", "verbose"} {
+		fs.Var(verbosity, name, "verbose output, can be given multiple times")
+	}
+	fs.StringVar(&o.ExtraOpts, "extra-opts", "", "read options from an ini file, [section][@file]")
+	fs.StringVar(&o.Output, "output", o.Output, "output format, text, json or ndjson")
+	fs.IntVar(&o.Repeat, "repeat", 0, "run the check n times and print a summary, for debugging")
+	fs.DurationVar(&o.Interval, "interval", time.Second, "interval between repeated runs")
+	fs.StringVar(&o.ConfigFile, "config", "", "read options from a config file")
+	fs.StringVar(&o.Profile, "profile", "", "comma separated list of config profiles, later profiles win")
+	fs.StringVar(&o.ConfigHost, "config-host", "", "host table of the config file, defaults to $HOSTNAME$ or this host")
+	fs.BoolVar(&o.ShowConfig, "show-config", false, "print the effective configuration and exit")
+	fs.Var(&o.Faults, "inject-fault", "inject a fault for testing: status:result=status, latency=duration, timeout or panic")
+	fs.StringVar(&o.Locale, "locale", DefaultLocale, "language of the messages, e.g. de, missing messages are English")
+	fs.BoolVar(&o.TranslateSummary, "translate-summary", false, "translate the status groups and success message as well")
+	fs.StringVar(&o.LogSink, "log-sink", "", "also write the results to the system log, syslog or journald")
+	if len(o.modes) > 0 {
+		o.registerModes(fs)
+	}
+}
+
+// Parse parses the command line and applies the other sources of options
+// with Apply. fs should use flag.ContinueOnError, errors should be reported
+// with ExitUsage.
+func (o *PluginOptions) Parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	given := visited(fs)
+	return o.Apply(fs, func(name string) bool {
+		return given[name]
+	})
+}
+
+// Apply applies environment variables (see ApplyEnv), --config and
+// --extra-opts to the options registered on fs and validates them, after the
+// command line was parsed. changed reports if an option was given on the
+// command line. Options given on the command line win over environment
+// variables, which win over the config file, which wins over extra-opts. The
+// default thresholds of the selected mode are used if no thresholds are set
+// otherwise.
+func (o *PluginOptions) Apply(fs *flag.FlagSet, changed func(name string) bool) error {
+	o.fs = fs
+	o.sources = make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if changed(f.Name) {
+			o.sources[f.Name] = "command line"
+		}
+	})
+
+	applied, err := applyEnv(fs, o.Name, os.LookupEnv, o.given())
+	if err != nil {
+		return err
+	}
+	o.addSources(applied)
+
+	if o.ConfigFile != "" {
+		config, err := LoadConfig(o.ConfigFile)
+		if err != nil {
+			return err
+		}
+		profiles := []string{}
+		for _, profile := range strings.Split(o.Profile, ",") {
+			if profile = strings.TrimSpace(profile); profile != "" {
+				profiles = append(profiles, profile)
+			}
+		}
+		host := o.ConfigHost
+		if host == "" {
+			host = ConfigHost()
+		}
+		applied, err := config.(*configImpl).apply(fs, profiles, host, o.given())
+		if err != nil {
+			return err
+		}
+		o.addSources(applied)
+	} else if o.Profile != "" {
+		return fmt.Errorf("--profile requires --config")
+	} else if o.ConfigHost != "" {
+		return fmt.Errorf("--config-host requires --config")
+	}
+
+	if o.ExtraOpts != "" {
+		applied, err := applyExtraOpts(fs, o.ExtraOpts, o.Name, o.given())
+		if err != nil {
+			return err
+		}
+		o.addSources(applied)
+	}
+	if err := o.selectMode(); err != nil {
+		return err
+	}
+	return o.validate()
+}
+
+// given returns the names of all options set so far, including aliases
+func (o *PluginOptions) given() map[string]bool {
+	names := make(map[string]bool)
+	for name := range o.sources {
+		names[name] = true
+	}
+	return withAliases(o.fs, names)
+}
+
+func (o *PluginOptions) addSources(options []option) {
+	for _, applied := range options {
+		o.sources[applied.name] = applied.source()
+	}
+}
+
+// WriteConfig writes the effective value and its source for every option
+// of the parsed FlagSet. Aliases like -w and -warning are written once.
+func (o *PluginOptions) WriteConfig(w io.Writer) error {
+	if o.fs == nil {
+		return fmt.Errorf("options have not been parsed")
+	}
+
+	// group aliases sharing the same value
+	type entry struct {
+		name   string
+		value  string
+		source string
+	}
+	entries := []*entry{}
+	byValue := make(map[interface{}]*entry)
+	o.fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "show-config" {
+			return
+		}
+		var e *entry
+		if reflect.ValueOf(f.Value).Kind() == reflect.Ptr {
+			e = byValue[f.Value]
+		}
+		if e == nil {
+			e = &entry{f.Name, f.Value.String(), "default"}
+			entries = append(entries, e)
+			if reflect.ValueOf(f.Value).Kind() == reflect.Ptr {
+				byValue[f.Value] = e
+			}
+		}
+		if len(f.Name) > len(e.name) {
+			e.name = f.Name
+		}
+		if source, found := o.sources[f.Name]; found {
+			e.source = source
+		}
+	})
+
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s = %q # %s\n", e.name, e.value, e.source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *PluginOptions) validate() error {
+	if o.Output != "text" && o.Output != "json" && o.Output != "ndjson" {
+		return fmt.Errorf("invalid output format %q, must be text, json or ndjson", o.Output)
+	}
+	if o.Output == "ndjson" && o.Repeat > 1 {
+		return fmt.Errorf("--repeat is not supported with ndjson output")
+	}
+	if len(o.Faults.Faults) > 0 {
+		allowed, err := FaultInjectionAllowed(o.Name)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("fault injection is not allowed for %s, see %s", o.Name, FaultInjectionAllowFile)
+		}
+	}
+	if o.Timeout <= 0 {
+		return fmt.Errorf("invalid timeout %v", o.Timeout)
+	}
+	if o.StreamTimeout <= 0 {
+		return fmt.Errorf("invalid stream timeout %v", o.StreamTimeout)
+	}
+	if err := checkLocale(o.Locale); err != nil {
+		return err
+	}
+	if o.LogSink != "" {
+		if _, err := NewSystemLogSink(o.LogSink, o.Name); err != nil {
+			return err
+		}
+	}
+	if o.Repeat < 0 || o.Interval < 0 {
+		return fmt.Errorf("invalid repeat %d with interval %v", o.Repeat, o.Interval)
+	}
+	return nil
+}
+
+// StatusCheck returns a StatusCheck for the warning and critical options
+func (o *PluginOptions) StatusCheck() StatusCheck {
+	return o.Thresholds.StatusCheck()
+}
+
+// Exit prints the Results in the selected output format and exits the
+// program. With --log-sink the results are written to the system log first,
+// failures are reported on stderr without changing the status.
+func (o *PluginOptions) Exit(results Results) {
+	if o.LogSink != "" {
+		sink, err := NewSystemLogSink(o.LogSink, o.Name)
+		if err == nil {
+			err = sink.Write(results)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write to %s: %v\n", o.LogSink, err)
+		}
+	}
+	if o.Output == "ndjson" {
+		stream, ok := results.(StreamingResults)
+		if !ok {
+			// the results were not streamed, write them all at once
+			stream = &streamResults{Results: results, encoder: json.NewEncoder(os.Stdout), start: time.Now()}
+			for _, result := range results.All() {
+				stream.Add(result)
+			}
+		}
+		stream.Exit()
+	}
+	if o.Output == "json" {
+		json.NewEncoder(os.Stdout).Encode(resultsJSON{
+			results.CalculateStatus(),
+			results.GenerateMessage(),
+			historyEntries(results),
+		})
+		os.Exit(results.CalculateStatus().Ordinal())
+	}
+	results.Exit()
+}
+
+// Run runs the check and exits the program like Exit. With --repeat the check
+// is run repeatedly, a status line is printed per run followed by a summary
+// and the program exits with the status of the last run. With --output json
+// every run and the summary are written as JSON lines. With --show-config
+// the effective configuration is printed instead. Faults given with
+// --inject-fault are injected into every run, the results of check are added
+// to new Results then.
+func (o *PluginOptions) Run(check func() Results) {
+	o.selectLocale()
+	o.run(o.injectFaults(check))
+}
+
+// selectLocale selects the validated locale for the process
+func (o *PluginOptions) selectLocale() {
+	SetLocale(o.Locale)
+	SetSummaryTranslated(o.TranslateSummary)
+}
+
+func (o *PluginOptions) run(check func() Results) {
+	if o.ShowConfig {
+		o.WriteConfig(os.Stdout)
+		os.Exit(0)
+	}
+	if o.Repeat <= 1 {
+		o.Exit(check())
+	}
+	if o.Output == "json" {
+		summary := RepeatJSON(os.Stdout, o.Repeat, o.Interval, check)
+		json.NewEncoder(os.Stdout).Encode(summary)
+		os.Exit(summary.Overall.Last.Ordinal())
+	}
+	summary := Repeat(os.Stdout, o.Repeat, o.Interval, check)
+	fmt.Print(summary)
+	os.Exit(summary.Overall.Last.Ordinal())
+}
+
+// RunContext runs checks like Run, the context passed to checks is done when
+// the plugin timeout expires. With ndjson output every Result is written as
+// soon as it is added, followed by a summary record, and --stream-timeout
+// replaces --timeout. SIGINT and SIGTERM cancel the context, so the summary
+// is written for the partial results.
+// Faults given with --inject-fault are injected into checks.
+func (o *PluginOptions) RunContext(checks ChecksFunc) {
+	o.selectLocale()
+	checks = InjectFaults(o.Faults.Faults, checks)
+	if o.Output == "ndjson" && !o.ShowConfig {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			select {
+			case <-signals:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		o.Exit(o.stream(ctx, os.Stdout, checks))
+	}
+	o.run(func() Results {
+		return RunChecks(context.Background(), o.Timeout, NewResults(), checks)
+	})
+}
+
+// injectFaults returns check with the faults given with --inject-fault
+func (o *PluginOptions) injectFaults(check func() Results) func() Results {
+	if len(o.Faults.Faults) == 0 {
+		return check
+	}
+	return func() Results {
+		return RunChecks(context.Background(), o.Timeout, NewResults(), InjectFaults(o.Faults.Faults, func(ctx context.Context, results Results) error {
+			for _, result := range resultList(check()) {
+				results.Add(result)
+			}
+			return nil
+		}))
+	}
+}
+
+// stream runs the checks with ndjson output to w until they are done, ctx is
+// canceled or the stream timeout expires
+func (o *PluginOptions) stream(ctx context.Context, w io.Writer, checks ChecksFunc) Results {
+	return RunChecks(ctx, o.StreamTimeout, NewStreamingResults(w, NewResults()), checks)
+}
+
+// UsageResult returns an UNKNOWN Result for an invalid command line
+func UsageResult(err error) Result {
+	return NewResultUnknownMessage("usage", err.Error())
+}
+
+// ExitUsage exits the program with UNKNOWN for an invalid command line, e.g.
+// from a cobra FlagErrorFunc
+func ExitUsage(err error) {
+	UsageResult(err).Exit()
+}
+
+// Set parses seconds or a duration
+func (v *timeoutValue) Set(value string) error {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		*v.timeout = time.Duration(seconds) * time.Second
+		return nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q", value)
+	}
+	*v.timeout = timeout
+	return nil
+}
+
+func (v *timeoutValue) String() string {
+	if v == nil || v.timeout == nil {
+		return DefaultTimeout.String()
+	}
+	return v.timeout.String()
+}
+
+// Type returns the pflag type name
+func (v *timeoutValue) Type() string {
+	return "duration"
+}
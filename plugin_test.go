@@ -0,0 +1,144 @@
+package icinga
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPluginOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-plugin")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ini := filepath.Join(dir, "plugins.ini")
+	err = ioutil.WriteFile(ini, []byte(`
+[check_foo]
+warning = 5:
+critical = 2:
+timeout = 30
+
+[other]
+critical = 99
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write ini: %v", err)
+	}
+
+	o, err := NewPluginOptions("check_foo", "10", "20")
+	if err != nil {
+		t.Fatalf("failed to create plugin options: %v", err)
+	}
+	fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+	o.Register(fs)
+	args := []string{"--extra-opts", "@" + ini, "-c", "1:", "-t", "5", "-v", "-v", "-output", "json"}
+	if err := o.Parse(fs, args); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	if o.Thresholds.Warning.String() != "5:" {
+		t.Errorf("warning should be read from extra-opts but is %v", o.Thresholds.Warning)
+	}
+	if o.Thresholds.Critical.String() != "1:" {
+		t.Errorf("critical should be read from the command line but is %v", o.Thresholds.Critical)
+	}
+	if o.Timeout != 5*time.Second {
+		t.Errorf("timeout should be read from the command line but is %v", o.Timeout)
+	}
+	if o.Verbosity != 2 {
+		t.Errorf("verbosity should be 2 but is %d", o.Verbosity)
+	}
+	if o.StatusCheck().Check(3) != ServiceStatusWarning {
+		t.Errorf("StatusCheck() should use the parsed thresholds")
+	}
+}
+
+func TestPluginOptionsInvalid(t *testing.T) {
+	tests := [][]string{
+		{"-w", "abc"},
+		{"-t", "soon"},
+		{"-output", "xml"},
+		{"-locale", "xx"},
+		{"-log-sink", "file"},
+		{"-unknown"},
+	}
+	for _, args := range tests {
+		o, err := NewPluginOptions("check_foo", "", "")
+		if err != nil {
+			t.Fatalf("failed to create plugin options: %v", err)
+		}
+		fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		o.Register(fs)
+		err = o.Parse(fs, args)
+		t.Logf("Parse(%v) is %v", args, err)
+		if err == nil {
+			t.Errorf("Parse(%v) should fail", args)
+			continue
+		}
+		if UsageResult(err).Status() != ServiceStatusUnknown {
+			t.Errorf("UsageResult() should be %v", ServiceStatusUnknown)
+		}
+	}
+}
+
+func TestPluginOptionsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-plugin")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := writeTestFile(t, dir, "check_foo.toml", `warning = "5:"
+critical = "2:"
+
+[prod]
+critical = "3:"
+
+[host.db1]
+t = "20"
+`)
+	ini := writeTestFile(t, dir, "plugins.ini", `[check_foo]
+critical = 1:
+timeout = 30
+`)
+
+	o, err := NewPluginOptions("check_foo", "10", "20")
+	if err != nil {
+		t.Fatalf("failed to create plugin options: %v", err)
+	}
+	fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+	o.Register(fs)
+	args := []string{"-config", config, "-profile", "prod", "-config-host", "db1", "-extra-opts", "@" + ini, "-w", "4:"}
+	if err := o.Parse(fs, args); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := o.WriteConfig(&buffer); err != nil {
+		t.Fatalf("WriteConfig() failed: %v", err)
+	}
+	t.Logf("WriteConfig() is:\n%v", buffer.String())
+
+	shouldContain := []string{
+		`warning = "4:" # command line`,
+		`critical = "3:" # ` + config + `:5`,
+		`timeout = "20s" # ` + config + `:8`,
+		`verbose = "0" # default`,
+	}
+	for _, line := range shouldContain {
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("WriteConfig() should contain %v", line)
+		}
+	}
+	if strings.Contains(buffer.String(), "w = ") {
+		t.Errorf("WriteConfig() should not contain aliases")
+	}
+}
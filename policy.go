@@ -2,8 +2,7 @@ package icinga
 
 import (
 	"bytes"
-	"fmt"
-	"strings"
+	"io"
 )
 
 type (
@@ -24,7 +23,7 @@ func NewDefaultStatusPolicy() StatusPolicy {
 
 func (p *defaultStatusPolicy) Calculate(results Results) Status {
 	calculatedStatus := ServiceStatusOk
-	for _, result := range results.All() {
+	for _, result := range resultList(results) {
 		if result.Status() > calculatedStatus {
 			calculatedStatus = result.Status()
 		}
@@ -38,6 +37,12 @@ type (
 		Generate(Results) string
 	}
 
+	// StatusMessageWriter is implemented by status message policies which
+	// can write the message without building a string first
+	StatusMessageWriter interface {
+		WriteMessage(io.Writer, Results) (int64, error)
+	}
+
 	defaultStatusMessagePolicy struct {
 		order []Status
 	}
@@ -56,21 +61,39 @@ func NewDefaultStatusMessagePolicy() StatusMessagePolicy {
 }
 
 func (p *defaultStatusMessagePolicy) Generate(results Results) string {
-	// group all checks by status
-	statusMap := make(map[Status][]string)
-	for _, result := range results.All() {
-		statusMap[result.Status()] = append(statusMap[result.Status()], result.Name())
-	}
-
-	// concatente checks per status
 	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("%s: ", results.CalculateStatus()))
+	p.WriteMessage(&buffer, results)
+	return buffer.String()
+}
+
+// WriteMessage writes the overall status followed by the names of all checks
+// grouped by status, the group labels are translated if enabled with
+// SetSummaryTranslated
+func (p *defaultStatusMessagePolicy) WriteMessage(w io.Writer, results Results) (int64, error) {
+	sw := stringWriterFor(w)
+	sw.WriteString(results.CalculateStatus().String())
+	sw.WriteString(":")
+
+	list := resultList(results)
 	for _, status := range p.order {
-		if checks, found := statusMap[status]; found {
-			buffer.WriteString(fmt.Sprintf("%s: %s ", strings.ToLower(status.String()), checks))
+		first := true
+		for _, result := range list {
+			if result.Status() != status {
+				continue
+			}
+			if first {
+				sw.WriteString(" ")
+				sw.WriteString(translateSummary(statusMessageKeys[status]))
+				sw.WriteString(": [")
+				first = false
+			} else {
+				sw.WriteString(" ")
+			}
+			sw.WriteString(result.Name())
+		}
+		if !first {
+			sw.WriteString("]")
 		}
 	}
-
-	// remove white space at the end
-	return strings.Trim(buffer.String(), " ")
+	return sw.n, sw.err
 }
@@ -0,0 +1,302 @@
+package icinga
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The privileged helper protocol allows to run a few root-only probes in a
+// small setuid or capability-bearing helper binary instead of running the
+// whole plugin as root. The helper serves a fixed allow-list of operations,
+// requests and responses are exchanged as JSON lines over a pipe:
+//
+//	// helper, installed setuid root
+//	helper := icinga.NewPrivilegedHelper()
+//	helper.Register("read-file", icinga.ReadFileOperation([]string{"/etc/shadow"}))
+//	helper.Serve(os.Stdin, os.Stdout)
+//
+//	// plugin
+//	executor, err := icinga.NewExecutor(icinga.ExecutorOptions{
+//		Rules: []icinga.CommandRule{{Path: "/usr/lib/nagios/plugins/foo-helper"}},
+//	})
+//	client, err := icinga.NewPrivilegedClient(executor, "/usr/lib/nagios/plugins/foo-helper")
+//	content, err := icinga.PrivilegedReadFile(client, "/etc/shadow")
+
+type (
+	// PrivilegedOperation handles a request in the privileged helper, the
+	// returned value is sent back as JSON
+	PrivilegedOperation func(params json.RawMessage) (interface{}, error)
+
+	// PrivilegedHelper serves the registered operations
+	PrivilegedHelper interface {
+		Register(name string, operation PrivilegedOperation)
+		Serve(r io.Reader, w io.Writer) error
+	}
+
+	// PrivilegedClient calls operations of a privileged helper
+	PrivilegedClient interface {
+		Call(operation string, params interface{}, result interface{}) error
+		Close() error
+	}
+
+	// PrivilegedRequest is sent from the client to the helper
+	PrivilegedRequest struct {
+		Operation string          `json:"operation"`
+		Params    json.RawMessage `json:"params,omitempty"`
+	}
+
+	// PrivilegedResponse is sent from the helper to the client
+	PrivilegedResponse struct {
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  string          `json:"error,omitempty"`
+	}
+
+	// ReadFileRequest are the params of ReadFileOperation
+	ReadFileRequest struct {
+		Path string `json:"path"`
+	}
+
+	// ReadFileResponse is the result of ReadFileOperation
+	ReadFileResponse struct {
+		Content []byte `json:"content"`
+	}
+
+	privilegedHelper struct {
+		operations map[string]PrivilegedOperation
+	}
+
+	privilegedClient struct {
+		sync.Mutex
+		writer  io.Writer
+		scanner *bufio.Scanner
+		closer  func() error
+	}
+)
+
+const (
+	// maxPrivilegedMessageSize limits the size of a single request or response
+	maxPrivilegedMessageSize = 4 * 1024 * 1024
+	// maxPrivilegedFileSize limits files read by ReadFileOperation, so that
+	// the base64 encoded content fits into a response
+	maxPrivilegedFileSize = 3 * 1024 * 1024
+)
+
+// NewPrivilegedHelper creates a helper without operations
+func NewPrivilegedHelper() PrivilegedHelper {
+	return &privilegedHelper{make(map[string]PrivilegedOperation)}
+}
+
+// Register adds an operation to the allow-list
+func (h *privilegedHelper) Register(name string, operation PrivilegedOperation) {
+	h.operations[name] = operation
+}
+
+// Serve handles requests from r until it is closed. Responses exceeding the
+// message size are replaced by an error, so the client can read further
+// responses.
+func (h *privilegedHelper) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxPrivilegedMessageSize)
+	for scanner.Scan() {
+		response, err := json.Marshal(h.handle(scanner.Bytes()))
+		if err == nil && len(response) >= maxPrivilegedMessageSize {
+			response, err = json.Marshal(PrivilegedResponse{
+				Error: fmt.Sprintf("response of %d bytes exceeds the limit of %d bytes", len(response), maxPrivilegedMessageSize),
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode response: %v", err)
+		}
+		if _, err := w.Write(append(response, '\n')); err != nil {
+			return fmt.Errorf("failed to write response: %v", err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (h *privilegedHelper) handle(line []byte) PrivilegedResponse {
+	var request PrivilegedRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return PrivilegedResponse{Error: fmt.Sprintf("invalid request: %v", err)}
+	}
+	operation, found := h.operations[request.Operation]
+	if !found {
+		return PrivilegedResponse{Error: fmt.Sprintf("operation %q not allowed", request.Operation)}
+	}
+	result, err := operation(request.Params)
+	if err != nil {
+		return PrivilegedResponse{Error: err.Error()}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return PrivilegedResponse{Error: fmt.Sprintf("failed to encode result: %v", err)}
+	}
+	return PrivilegedResponse{Result: data}
+}
+
+// NewPrivilegedClient starts the helper binary through an Executor created by
+// NewExecutor, which must allow the path and arguments, and returns a client
+// talking to it over its stdin and stdout. The environment and resource
+// limits of the executor apply, its timeout doesn't.
+func NewPrivilegedClient(executor Executor, path string, args ...string) (PrivilegedClient, error) {
+	e, ok := executor.(*executorImpl)
+	if !ok {
+		return nil, fmt.Errorf("failed to start privileged helper: unsupported executor %T", executor)
+	}
+	cmd, err := e.command(path, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start privileged helper: %v", err)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start privileged helper: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start privileged helper: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start privileged helper: %v", err)
+	}
+	return newPrivilegedClient(stdout, stdin, func() error {
+		stdin.Close()
+		return cmd.Wait()
+	}), nil
+}
+
+// NewPrivilegedClientConn returns a client talking to a helper over the given
+// reader and writer, e.g. an already running helper
+func NewPrivilegedClientConn(r io.Reader, w io.Writer) PrivilegedClient {
+	return newPrivilegedClient(r, w, func() error { return nil })
+}
+
+func newPrivilegedClient(r io.Reader, w io.Writer, closer func() error) *privilegedClient {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxPrivilegedMessageSize)
+	return &privilegedClient{writer: w, scanner: scanner, closer: closer}
+}
+
+// Call sends a request and decodes the result of the operation into result
+func (c *privilegedClient) Call(operation string, params interface{}, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode params: %v", err)
+	}
+
+	request, err := json.Marshal(PrivilegedRequest{operation, data})
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %v", err)
+	}
+	if len(request) >= maxPrivilegedMessageSize {
+		return fmt.Errorf("request of %d bytes exceeds the limit of %d bytes", len(request), maxPrivilegedMessageSize)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if _, err := c.writer.Write(append(request, '\n')); err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+		return fmt.Errorf("failed to read response: %v", io.ErrUnexpectedEOF)
+	}
+
+	var response PrivilegedResponse
+	if err := json.Unmarshal(c.scanner.Bytes(), &response); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("privileged %s failed: %s", operation, response.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// Close stops the helper
+func (c *privilegedClient) Close() error {
+	return c.closer()
+}
+
+// ReadFileOperation returns an operation which reads files from an allow-list
+// of absolute paths. Symlinks are resolved before the path is checked, the
+// resolved path is opened without following symlinks and the opened file must
+// be the allowed file, so the path can't be swapped in between. Files are
+// limited to 3 MiB.
+func ReadFileOperation(allowed []string) PrivilegedOperation {
+	allowList := make(map[string]bool)
+	for _, path := range allowed {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		allowList[filepath.Clean(path)] = true
+	}
+	return func(params json.RawMessage) (interface{}, error) {
+		var request ReadFileRequest
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid params: %v", err)
+		}
+		path, err := filepath.EvalSymlinks(filepath.Clean(request.Path))
+		if err != nil || !filepath.IsAbs(request.Path) || !allowList[path] {
+			return nil, fmt.Errorf("path %q not allowed", request.Path)
+		}
+		content, err := readAllowedFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %v", request.Path, err)
+		}
+		return ReadFileResponse{content}, nil
+	}
+}
+
+// readAllowedFile reads the regular file at the resolved path if the opened
+// file is still the file at that path
+func readAllowedFile(path string) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|openNoFollow, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	opened, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !opened.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	if !os.SameFile(opened, allowed) {
+		return nil, fmt.Errorf("file changed while opening it")
+	}
+	if opened.Size() > maxPrivilegedFileSize {
+		return nil, fmt.Errorf("file exceeds the limit of %d bytes", maxPrivilegedFileSize)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(f, maxPrivilegedFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxPrivilegedFileSize {
+		return nil, fmt.Errorf("file exceeds the limit of %d bytes", maxPrivilegedFileSize)
+	}
+	return content, nil
+}
+
+// PrivilegedReadFile reads a file through the "read-file" operation of a helper
+func PrivilegedReadFile(client PrivilegedClient, path string) ([]byte, error) {
+	var response ReadFileResponse
+	if err := client.Call("read-file", ReadFileRequest{path}, &response); err != nil {
+		return nil, err
+	}
+	return response.Content, nil
+}
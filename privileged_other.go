@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package icinga
+
+// openNoFollow is not supported on this platform, the opened file is still
+// compared with the allowed file
+const openNoFollow = 0
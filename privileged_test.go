@@ -0,0 +1,112 @@
+package icinga
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrivilegedHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-privileged")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	other := filepath.Join(dir, "other")
+	link := filepath.Join(dir, "link")
+	large := filepath.Join(dir, "large")
+	if err := ioutil.WriteFile(large, make([]byte, maxPrivilegedFileSize+1), 0600); err != nil {
+		t.Fatalf("failed to write %v: %v", large, err)
+	}
+	for _, path := range []string{secret, other} {
+		if err := ioutil.WriteFile(path, []byte("content of "+filepath.Base(path)), 0600); err != nil {
+			t.Fatalf("failed to write %v: %v", path, err)
+		}
+	}
+	if err := os.Symlink(other, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	helper := NewPrivilegedHelper()
+	helper.Register("read-file", ReadFileOperation([]string{secret, large, dir}))
+	helper.Register("echo", func(params json.RawMessage) (interface{}, error) {
+		return params, nil
+	})
+	helper.Register("large", func(params json.RawMessage) (interface{}, error) {
+		return strings.Repeat("x", maxPrivilegedMessageSize), nil
+	})
+
+	requestReader, requestWriter := io.Pipe()
+	responseReader, responseWriter := io.Pipe()
+	go func() {
+		helper.Serve(requestReader, responseWriter)
+		responseWriter.Close()
+	}()
+	client := NewPrivilegedClientConn(responseReader, requestWriter)
+	defer requestWriter.Close()
+
+	content, err := PrivilegedReadFile(client, secret)
+	if err != nil {
+		t.Fatalf("PrivilegedReadFile(%v) failed: %v", secret, err)
+	}
+	if string(content) != "content of secret" {
+		t.Errorf("PrivilegedReadFile(%v) returned %q", secret, content)
+	}
+
+	tests := []struct {
+		operation string
+		params    interface{}
+		errorMsg  string
+	}{
+		{"read-file", ReadFileRequest{other}, "not allowed"},
+		{"read-file", ReadFileRequest{link}, "not allowed"},
+		{"read-file", ReadFileRequest{"secret"}, "not allowed"},
+		{"read-file", ReadFileRequest{large}, "exceeds the limit"},
+		{"read-file", ReadFileRequest{dir}, "not a regular file"},
+		{"exec", nil, `operation "exec" not allowed`},
+		{"large", nil, "exceeds the limit"},
+		{"echo", strings.Repeat("x", maxPrivilegedMessageSize), "exceeds the limit"},
+	}
+	for _, test := range tests {
+		err := client.Call(test.operation, test.params, nil)
+		t.Logf("Call(%v, %v) is %v", test.operation, test.params, err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Call(%v, %v) should fail with %v", test.operation, test.params, test.errorMsg)
+		}
+	}
+
+	// the client keeps working after responses exceeding the limit
+	var echo map[string]int
+	if err := client.Call("echo", map[string]int{"a": 1}, &echo); err != nil || echo["a"] != 1 {
+		t.Errorf("Call(echo) should return the params but is %v, %v", echo, err)
+	}
+}
+
+func TestNewPrivilegedClient(t *testing.T) {
+	executor, err := NewExecutor(ExecutorOptions{Rules: []CommandRule{{Path: "/bin/cat"}}})
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	if _, err := NewPrivilegedClient(executor, "/bin/sh"); err == nil || !strings.Contains(err.Error(), CommandNotAllowed) {
+		t.Errorf("NewPrivilegedClient(/bin/sh) should fail with %v but is %v", CommandNotAllowed, err)
+	}
+
+	// cat sends the requests back, they are responses without error
+	client, err := NewPrivilegedClient(executor, "/bin/cat")
+	if err != nil {
+		t.Fatalf("NewPrivilegedClient(/bin/cat) failed: %v", err)
+	}
+	if err := client.Call("echo", nil, nil); err != nil {
+		t.Errorf("Call(echo) failed: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+}
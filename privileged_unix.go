@@ -0,0 +1,9 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package icinga
+
+import "syscall"
+
+// openNoFollow makes open(2) fail if the last path element is a symlink
+const openNoFollow = syscall.O_NOFOLLOW
@@ -18,6 +18,13 @@ type (
 		CheckInt32(int32) bool
 	}
 
+	// BatchRange is implemented by ranges which check a batch of values
+	// faster than one by one, see RangeCheckAll
+	BatchRange interface {
+		Range
+		CheckAll(values []float64, alerts []bool) []bool
+	}
+
 	rangeImpl struct {
 		Start  float64
 		End    float64
@@ -107,6 +114,54 @@ func (r *rangeImpl) CheckInt32(val int32) bool {
 	return r.Check(float64(val))
 }
 
+// CheckAll checks a batch of values and appends the results to alerts[:0],
+// passing the slice of a previous call avoids allocations.
+func (r *rangeImpl) CheckAll(values []float64, alerts []bool) []bool {
+	alerts = alerts[:0]
+	for _, value := range values {
+		alerts = append(alerts, (r.Start <= value && value <= r.End) == r.Invert)
+	}
+	return alerts
+}
+
+// RangeCheckAll checks a batch of values and appends the results to
+// alerts[:0], ranges implementing BatchRange check them at once
+func RangeCheckAll(r Range, values []float64, alerts []bool) []bool {
+	if batch, ok := r.(BatchRange); ok {
+		return batch.CheckAll(values, alerts)
+	}
+	alerts = alerts[:0]
+	for _, value := range values {
+		alerts = append(alerts, r.Check(value))
+	}
+	return alerts
+}
+
 func (r *rangeImpl) CheckValue(val interface{}) bool {
 	return r.Check(val.(float64))
 }
+
+// ExplainRange describes when a threshold like 10:20 or @10:20 raises an
+// alert in the selected locale, e.g. "alert if outside 10 .. 20"
+func ExplainRange(value string) (string, error) {
+	parsed, err := NewRange(value)
+	if err != nil {
+		return "", err
+	}
+	r := parsed.(*rangeImpl)
+	key := MessageRangeOutside
+	if r.Invert {
+		key = MessageRangeInside
+	}
+	return Translate(key, formatLimit(r.Start), formatLimit(r.End)), nil
+}
+
+func formatLimit(limit float64) string {
+	switch {
+	case math.IsInf(limit, 1):
+		return "∞"
+	case math.IsInf(limit, -1):
+		return "-∞"
+	}
+	return formatValue(limit)
+}
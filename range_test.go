@@ -140,3 +140,89 @@ func TestInsideRangeOfTenAndTwenty(t *testing.T) {
 		}
 	}
 }
+
+func TestRangeCheckAll(t *testing.T) {
+	r, err := NewRange("@10:20")
+	if err != nil {
+		t.Fatalf("failed to parse range: %v", err)
+	}
+	values := []float64{9.0, 10.0, 15.0, 20.0, 21.0}
+	shouldBe := []bool{false, true, true, true, false}
+
+	alerts := RangeCheckAll(r, values, nil)
+	for i, alert := range alerts {
+		if alert != shouldBe[i] || alert != r.Check(values[i]) {
+			t.Errorf("RangeCheckAll()[%d] should be: %v", i, shouldBe[i])
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		alerts = RangeCheckAll(r, values, alerts)
+	})
+	t.Logf("RangeCheckAll() allocs: %v", allocs)
+	if allocs != 0 {
+		t.Errorf("RangeCheckAll() should not allocate with a reused slice")
+	}
+
+	// ranges without CheckAll are checked one by one
+	var custom Range = insideRange{r}
+	if _, ok := custom.(BatchRange); ok {
+		t.Fatalf("insideRange should not be a BatchRange")
+	}
+	for i, alert := range RangeCheckAll(custom, values, nil) {
+		if alert != shouldBe[i] {
+			t.Errorf("RangeCheckAll()[%d] of a custom range should be: %v", i, shouldBe[i])
+		}
+	}
+}
+
+// insideRange implements Range without CheckAll
+type insideRange struct {
+	r Range
+}
+
+func (i insideRange) Check(value float64) bool {
+	return i.r.Check(value)
+}
+
+func (i insideRange) CheckInt(value int) bool {
+	return i.r.CheckInt(value)
+}
+
+func (i insideRange) CheckInt32(value int32) bool {
+	return i.r.CheckInt32(value)
+}
+
+func BenchmarkRangeCheckAll(b *testing.B) {
+	r, _ := NewRange("10:20")
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = float64(i % 30)
+	}
+	alerts := make([]bool, 0, len(values))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		alerts = RangeCheckAll(r, values, alerts)
+	}
+}
+
+func TestExplainRange(t *testing.T) {
+	tests := map[string]string{
+		"10":     "alert if outside 0 .. 10",
+		"10:":    "alert if outside 10 .. ∞",
+		"~:10":   "alert if outside -∞ .. 10",
+		"@10:20": "alert if inside 10 .. 20",
+		"0.5:1":  "alert if outside 0.5 .. 1",
+	}
+	for threshold, shouldBe := range tests {
+		explained, err := ExplainRange(threshold)
+		t.Logf("ExplainRange(%q) is %q", threshold, explained)
+		if err != nil || explained != shouldBe {
+			t.Errorf("ExplainRange(%q) should be %q", threshold, shouldBe)
+		}
+	}
+	if _, err := ExplainRange("abc"); err == nil {
+		t.Errorf("ExplainRange() should fail for invalid thresholds")
+	}
+}
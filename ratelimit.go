@@ -0,0 +1,170 @@
+package icinga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+type (
+	// RateLimiter is a token bucket shared by all plugin invocations
+	RateLimiter interface {
+		// Take takes a token. If the bucket is empty it returns false and the
+		// time until the next token is available.
+		Take() (bool, time.Duration, error)
+	}
+
+	// RateLimitOptions options for RateLimit
+	RateLimitOptions struct {
+		Limiter RateLimiter
+		// CacheFile stores the last result of the check, it is returned
+		// while the budget is exhausted. No result is cached if empty.
+		CacheFile string
+		// MaxAge is the maximum age of a cached result, defaults to 1 hour
+		MaxAge time.Duration
+	}
+
+	fileRateLimiter struct {
+		path  string
+		rate  float64
+		burst float64
+		now   func() time.Time
+	}
+
+	// rateLimitState is the bucket persisted by fileRateLimiter
+	rateLimitState struct {
+		Tokens float64   `json:"tokens"`
+		Time   time.Time `json:"time"`
+	}
+
+	// cachedResult is a result persisted by RateLimit
+	cachedResult struct {
+		Time     time.Time  `json:"time"`
+		Name     string     `json:"name"`
+		Status   Status     `json:"status"`
+		Message  string     `json:"message"`
+		Details  []string   `json:"details,omitempty"`
+		Perfdata []Perfdata `json:"perfdata,omitempty"`
+	}
+)
+
+// NewFileRateLimiter creates a RateLimiter which stores its bucket in the
+// given file, all invocations using the same file share the budget. The bucket
+// holds up to burst tokens and is refilled with rate tokens per second.
+func NewFileRateLimiter(path string, rate float64, burst float64) (RateLimiter, error) {
+	if rate <= 0 || burst < 1 {
+		return nil, fmt.Errorf("invalid rate limit %v/s with burst %v", rate, burst)
+	}
+	return &fileRateLimiter{path, rate, burst, time.Now}, nil
+}
+
+// Take takes a token from the bucket
+func (l *fileRateLimiter) Take() (bool, time.Duration, error) {
+	lock, err := os.OpenFile(l.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to open rate limit lock: %v", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return false, 0, fmt.Errorf("failed to lock rate limit: %v", err)
+	}
+	defer unlockFile(lock)
+
+	now := l.now()
+	state := rateLimitState{Tokens: l.burst, Time: now}
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, 0, fmt.Errorf("failed to read rate limit: %v", err)
+	}
+	// a broken state file starts with a full bucket
+	if err == nil && json.Unmarshal(data, &state) == nil {
+		if elapsed := now.Sub(state.Time).Seconds(); elapsed > 0 {
+			state.Tokens = math.Min(l.burst, state.Tokens+elapsed*l.rate)
+		}
+		state.Time = now
+	}
+
+	if state.Tokens < 1 {
+		wait := time.Duration((1 - state.Tokens) / l.rate * float64(time.Second))
+		return false, wait, l.write(state)
+	}
+	state.Tokens--
+	return true, 0, l.write(state)
+}
+
+func (l *fileRateLimiter) write(state rateLimitState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode rate limit: %v", err)
+	}
+	if err := writeFileAtomic(l.path, data); err != nil {
+		return fmt.Errorf("failed to write rate limit: %v", err)
+	}
+	return nil
+}
+
+// RateLimit returns a CheckFunc which runs check only if the limiter has a
+// token left. Otherwise the last cached result with its details and perfdata
+// is returned if it isn't older than MaxAge, or an UNKNOWN "rate limited"
+// Result.
+func RateLimit(options RateLimitOptions, check CheckFunc) CheckFunc {
+	if options.MaxAge <= 0 {
+		options.MaxAge = time.Hour
+	}
+	now := limiterClock(options.Limiter)
+	return func(ctx context.Context) (Result, error) {
+		allowed, wait, err := options.Limiter.Take()
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			if cached, found := readCachedResult(options.CacheFile, now().Add(-options.MaxAge)); found {
+				message := Translate(MessageCached, cached.Message, cached.Time.Format(time.RFC3339))
+				return NewResultWithDetailsAndPerfdata(cached.Name, cached.Status, message, cached.Details, cached.Perfdata), nil
+			}
+			return nil, fmt.Errorf("%s", Translate(MessageRateLimited, wait.Round(time.Millisecond)))
+		}
+
+		result, err := check(ctx)
+		if err != nil || result == nil || options.CacheFile == "" {
+			return result, err
+		}
+		cached := cachedResult{now(), result.Name(), result.Status(), result.Message(), nil, ResultPerfdata(result)}
+		if detailed, ok := result.(DetailedResult); ok {
+			cached.Details = detailed.Details()
+		}
+		data, err := json.Marshal(cached)
+		if err == nil {
+			// the result is valid even if it can't be cached
+			writeFileAtomic(options.CacheFile, data)
+		}
+		return result, nil
+	}
+}
+
+// limiterClock returns the clock of the limiter, so cached results age with
+// its bucket
+func limiterClock(limiter RateLimiter) func() time.Time {
+	if l, ok := limiter.(*fileRateLimiter); ok {
+		return func() time.Time { return l.now() }
+	}
+	return time.Now
+}
+
+// readCachedResult returns the cached result if it wasn't cached before
+// oldest
+func readCachedResult(path string, oldest time.Time) (cachedResult, bool) {
+	var cached cachedResult
+	if path == "" {
+		return cached, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &cached) != nil {
+		return cached, false
+	}
+	return cached, !cached.Time.Before(oldest)
+}
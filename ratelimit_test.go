@@ -0,0 +1,136 @@
+package icinga
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileRateLimiter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-ratelimit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	limiter, err := NewFileRateLimiter(filepath.Join(dir, "api.json"), 0.5, 2)
+	if err != nil {
+		t.Fatalf("NewFileRateLimiter() failed: %v", err)
+	}
+	now := time.Now()
+	limiter.(*fileRateLimiter).now = func() time.Time { return now }
+
+	tests := []struct {
+		elapsed time.Duration
+		allowed bool
+		wait    time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 2 * time.Second},
+		{time.Second, false, time.Second},
+		{time.Second, true, 0},
+		{time.Minute, true, 0},
+		{0, true, 0},
+		{0, false, 2 * time.Second},
+	}
+	for i, test := range tests {
+		now = now.Add(test.elapsed)
+		allowed, wait, err := limiter.Take()
+		t.Logf("Take() %d is %v, %v, %v", i, allowed, wait, err)
+		if err != nil || allowed != test.allowed || wait != test.wait {
+			t.Errorf("Take() %d should be %v, %v", i, test.allowed, test.wait)
+		}
+	}
+
+	if _, err := NewFileRateLimiter("x", 0, 1); err == nil {
+		t.Errorf("NewFileRateLimiter() should fail without rate")
+	}
+}
+
+func TestFileRateLimiterShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-ratelimit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every invocation uses its own limiter, all of them share the file
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter, _ := NewFileRateLimiter(filepath.Join(dir, "api.json"), 0.001, 5)
+			ok, _, err := limiter.Take()
+			if err != nil {
+				t.Errorf("Take() failed: %v", err)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if ok {
+				allowed++
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("%d invocations should be allowed but %d were", 5, allowed)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-ratelimit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	check := func(ctx context.Context) (Result, error) {
+		calls++
+		return NewResultWithDetailsAndPerfdata("api", ServiceStatusWarning, "quota 90%", []string{"900 of 1000 requests"},
+			[]Perfdata{{Label: "quota", Value: 90, Unit: "%", Warning: "80"}}), nil
+	}
+	limiter, _ := NewFileRateLimiter(filepath.Join(dir, "api.json"), 0.001, 1)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	limiter.(*fileRateLimiter).now = func() time.Time { return now }
+	cache := filepath.Join(dir, "api.cache")
+
+	tests := []struct {
+		options RateLimitOptions
+		elapsed time.Duration
+		status  Status
+		message string
+		calls   int
+	}{
+		{RateLimitOptions{Limiter: limiter, CacheFile: cache}, 0, ServiceStatusWarning, "quota 90%", 1},
+		{RateLimitOptions{Limiter: limiter, CacheFile: cache}, time.Minute, ServiceStatusWarning, "quota 90% (cached from 2026-10-17T12:00:00Z", 1},
+		{RateLimitOptions{Limiter: limiter, CacheFile: cache, MaxAge: 10 * time.Minute}, 10 * time.Minute, ServiceStatusUnknown, "rate limited, next request possible in 5m40s", 1},
+		{RateLimitOptions{Limiter: limiter}, 0, ServiceStatusUnknown, "rate limited, next request possible in 5m40s", 1},
+	}
+	for i, test := range tests {
+		now = now.Add(test.elapsed)
+		result := RunCheck(context.Background(), "api", time.Second, RateLimit(test.options, check))
+		t.Logf("RateLimit() %d is %v", i, result)
+		if result.Status() != test.status || !strings.HasPrefix(result.Message(), test.message) || calls != test.calls {
+			t.Errorf("RateLimit() %d should be %v: %v with %d calls", i, test.status, test.message, test.calls)
+		}
+		// the cached result keeps the details and perfdata
+		if test.status == ServiceStatusWarning {
+			if details := ResultDetails(result); len(details) != 1 || details[0] != "900 of 1000 requests" {
+				t.Errorf("RateLimit() %d should keep the details but is %v", i, details)
+			}
+			if perfdata := perfdataString(ResultPerfdata(result)); perfdata != "quota=90%;80" {
+				t.Errorf("RateLimit() %d should keep the perfdata but is %v", i, perfdata)
+			}
+		}
+	}
+}
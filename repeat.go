@@ -0,0 +1,197 @@
+package icinga
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// RepeatSummary contains statistics over repeated check runs
+	RepeatSummary struct {
+		Runs    int                     `json:"runs"`
+		Overall RepeatStats             `json:"overall"`
+		Results map[string]*RepeatStats `json:"results"`
+		// Perfdata contains the statistics per perfdata label
+		Perfdata map[string]*PerfdataStats `json:"perfdata,omitempty"`
+	}
+
+	// RepeatStats counts the statuses and status changes of a check or result
+	RepeatStats struct {
+		Statuses    [ServiceStatusUnknown + 1]int
+		Transitions int
+		Last        Status
+		seen        bool
+	}
+
+	// PerfdataStats contains the minimum, maximum and average of a perfdata
+	// value over repeated runs
+	PerfdataStats struct {
+		Min   float64 `json:"min"`
+		Max   float64 `json:"max"`
+		Sum   float64 `json:"-"`
+		Count int     `json:"count"`
+		Unit  string  `json:"unit,omitempty"`
+	}
+
+	// repeatRunJSON is a run written by RepeatJSON
+	repeatRunJSON struct {
+		Run      int     `json:"run"`
+		Duration float64 `json:"duration"`
+		resultsJSON
+	}
+)
+
+// Repeat runs a check n times with the given interval in between. It prints
+// a status line per run to w and returns the statistics of all runs.
+func Repeat(w io.Writer, n int, interval time.Duration, check func() Results) *RepeatSummary {
+	return repeat(n, interval, check, func(i int, duration time.Duration, results Results) {
+		fmt.Fprintf(w, "run %d/%d (%v): %s\n", i, n, duration.Round(time.Millisecond), results.GenerateMessage())
+	})
+}
+
+// RepeatJSON runs a check like Repeat, but writes every run as JSON line to w
+// like --output json with the run number and its duration in seconds
+func RepeatJSON(w io.Writer, n int, interval time.Duration, check func() Results) *RepeatSummary {
+	encoder := json.NewEncoder(w)
+	return repeat(n, interval, check, func(i int, duration time.Duration, results Results) {
+		encoder.Encode(repeatRunJSON{i, duration.Seconds(), resultsJSON{
+			results.CalculateStatus(),
+			results.GenerateMessage(),
+			historyEntries(results),
+		}})
+	})
+}
+
+func repeat(n int, interval time.Duration, check func() Results, written func(int, time.Duration, Results)) *RepeatSummary {
+	summary := &RepeatSummary{Results: make(map[string]*RepeatStats), Perfdata: make(map[string]*PerfdataStats)}
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			time.Sleep(interval)
+		}
+		start := time.Now()
+		results := check()
+		summary.Add(results)
+		written(i, time.Since(start), results)
+	}
+	return summary
+}
+
+// Add adds the Results of a run to the summary
+func (s *RepeatSummary) Add(results Results) {
+	s.Runs++
+	s.Overall.add(results.CalculateStatus())
+	for _, result := range results.All() {
+		stats, found := s.Results[result.Name()]
+		if !found {
+			stats = &RepeatStats{}
+			s.Results[result.Name()] = stats
+		}
+		stats.add(result.Status())
+
+		for _, p := range ResultPerfdata(result) {
+			if s.Perfdata == nil {
+				s.Perfdata = make(map[string]*PerfdataStats)
+			}
+			stats, found := s.Perfdata[p.Label]
+			if !found {
+				stats = &PerfdataStats{Min: math.Inf(1), Max: math.Inf(-1)}
+				s.Perfdata[p.Label] = stats
+			}
+			stats.add(p)
+		}
+	}
+}
+
+func (s *RepeatStats) add(status Status) {
+	if s.seen && s.Last != status {
+		s.Transitions++
+	}
+	s.Statuses[status]++
+	s.Last = status
+	s.seen = true
+}
+
+func (s *RepeatStats) String() string {
+	counts := []string{}
+	for status, count := range s.Statuses {
+		if count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, Status(status)))
+		}
+	}
+	return fmt.Sprintf("%s, %d transitions", strings.Join(counts, ", "), s.Transitions)
+}
+
+// MarshalJSON writes the statuses as object like {"OK": 2}
+func (s *RepeatStats) MarshalJSON() ([]byte, error) {
+	statuses := make(map[string]int)
+	for status, count := range s.Statuses {
+		if count > 0 {
+			statuses[Status(status).String()] = count
+		}
+	}
+	return json.Marshal(struct {
+		Statuses    map[string]int `json:"statuses"`
+		Transitions int            `json:"transitions"`
+		Last        Status         `json:"last"`
+	}{statuses, s.Transitions, s.Last})
+}
+
+func (s *PerfdataStats) add(p Perfdata) {
+	s.Min = math.Min(s.Min, p.Value)
+	s.Max = math.Max(s.Max, p.Value)
+	s.Sum += p.Value
+	s.Count++
+	s.Unit = p.Unit
+}
+
+// Avg returns the average value
+func (s *PerfdataStats) Avg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// MarshalJSON adds the average
+func (s *PerfdataStats) MarshalJSON() ([]byte, error) {
+	type stats PerfdataStats
+	return json.Marshal(struct {
+		stats
+		Avg float64 `json:"avg"`
+	}{stats(*s), s.Avg()})
+}
+
+func (s *PerfdataStats) String() string {
+	return fmt.Sprintf("min %s%s, avg %s%s, max %s%s",
+		formatValue(s.Min), s.Unit, formatValue(math.Round(s.Avg()*1000)/1000), s.Unit, formatValue(s.Max), s.Unit)
+}
+
+func (s *RepeatSummary) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%d runs: %s\n", s.Runs, &s.Overall))
+
+	names := []string{}
+	for name := range s.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buffer.WriteString(fmt.Sprintf("%s: %s\n", name, s.Results[name]))
+	}
+
+	labels := []string{}
+	for label := range s.Perfdata {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		buffer.WriteString(fmt.Sprintf("perfdata %s: %s\n", label, s.Perfdata[label]))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,79 @@
+package icinga
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRepeat(t *testing.T) {
+	statuses := []Status{
+		ServiceStatusOk,
+		ServiceStatusWarning,
+		ServiceStatusWarning,
+		ServiceStatusCritical,
+		ServiceStatusOk,
+	}
+	run := 0
+	check := func() Results {
+		results := NewResults()
+		results.Add(NewResult("check 1", statuses[run], "some message"))
+		results.Add(NewResultWithPerfdata("check 2", ServiceStatusOk, "ok", []Perfdata{{Label: "time", Value: float64(run + 1), Unit: "s"}}))
+		run++
+		return results
+	}
+
+	var buffer bytes.Buffer
+	summary := Repeat(&buffer, len(statuses), 0, check)
+	t.Logf("output is:\n%v%v", buffer.String(), summary)
+
+	if lines := strings.Count(buffer.String(), "\n"); lines != len(statuses) {
+		t.Errorf("Repeat() should print %d status lines but printed %d", len(statuses), lines)
+	}
+	shouldBe := `5 runs: 2 OK, 2 WARNING, 1 CRITICAL, 3 transitions
+check 1: 2 OK, 2 WARNING, 1 CRITICAL, 3 transitions
+check 2: 5 OK, 0 transitions
+perfdata time: min 1s, avg 3s, max 5s
+`
+	if summary.String() != shouldBe {
+		t.Errorf("summary should be:\n%v", shouldBe)
+	}
+	if summary.Overall.Last != ServiceStatusOk {
+		t.Errorf("last status should be %v", ServiceStatusOk)
+	}
+}
+
+func TestRepeatJSON(t *testing.T) {
+	run := 0
+	check := func() Results {
+		run++
+		results := NewResults()
+		results.Add(NewResultWithPerfdata("check 1", Status(run%2), "some message", []Perfdata{{Label: "load1", Value: float64(run)}}))
+		return results
+	}
+
+	var buffer bytes.Buffer
+	summary := RepeatJSON(&buffer, 3, 0, check)
+	json.NewEncoder(&buffer).Encode(summary)
+	t.Logf("output is:\n%s", buffer.String())
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("RepeatJSON() should write 3 runs and the summary")
+	}
+	var first struct {
+		Run     int            `json:"run"`
+		Status  Status         `json:"status"`
+		Results []HistoryEntry `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Run != 1 || first.Status != ServiceStatusWarning || len(first.Results[0].Perfdata) != 1 {
+		t.Errorf("the first run should be a JSON record: %v", err)
+	}
+	shouldBe := `{"runs":3,"overall":{"statuses":{"OK":1,"WARNING":2},"transitions":2,"last":"WARNING"},` +
+		`"results":{"check 1":{"statuses":{"OK":1,"WARNING":2},"transitions":2,"last":"WARNING"}},` +
+		`"perfdata":{"load1":{"min":1,"max":3,"count":3,"avg":2}}}`
+	if lines[3] != shouldBe {
+		t.Errorf("summary should be %s", shouldBe)
+	}
+}
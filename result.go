@@ -14,10 +14,19 @@ type (
 		Exit()
 	}
 
+	// DetailedResult is a Result with detail lines, e.g. the failing files,
+	// which are written as long output below the result
+	DetailedResult interface {
+		Result
+		Details() []string
+	}
+
 	resultImpl struct {
-		name    string
-		status  Status
-		message string
+		name     string
+		status   Status
+		message  string
+		details  []string
+		perfdata []Perfdata
 	}
 )
 
@@ -26,24 +35,36 @@ const (
 	DefaultSuccessMessage string = "everything ok"
 )
 
+// MaxDetailLines limits the detail lines written per result, further lines
+// are replaced by a line with their number
+var MaxDetailLines = 20
+
 // NewResult creates a new instance of Result
 func NewResult(name string, status Status, message string) Result {
-	return &resultImpl{name, status, message}
+	return &resultImpl{name, status, message, nil, nil}
+}
+
+// NewResultWithDetails creates a new instance of DetailedResult with ordered
+// detail lines
+func NewResultWithDetails(name string, status Status, message string, details []string) DetailedResult {
+	return &resultImpl{name, status, message, append([]string{}, details...), nil}
 }
 
 // NewResultOk creates a new instance of Result and set result to ServiceStateOk
+// with the DefaultSuccessMessage, which is translated if enabled with
+// SetSummaryTranslated
 func NewResultOk(name string) Result {
-	return &resultImpl{name, ServiceStatusOk, DefaultSuccessMessage}
+	return &resultImpl{name, ServiceStatusOk, translateSummary(MessageSuccess), nil, nil}
 }
 
 // NewResultOkMessage creates a new instance of Result and set result to ServiceStateOk
 func NewResultOkMessage(name string, message string) Result {
-	return &resultImpl{name, ServiceStatusOk, message}
+	return &resultImpl{name, ServiceStatusOk, message, nil, nil}
 }
 
 // NewResultUnknownMessage creates a new instance of Result and set result to ServiceStateOk
 func NewResultUnknownMessage(name string, message string) Result {
-	return &resultImpl{name, ServiceStatusUnknown, message}
+	return &resultImpl{name, ServiceStatusUnknown, message, nil, nil}
 }
 
 func (r *resultImpl) Name() string {
@@ -58,12 +79,38 @@ func (r *resultImpl) Message() string {
 	return r.message
 }
 
+// Details returns the detail lines
+func (r *resultImpl) Details() []string {
+	return r.details
+}
+
+// ResultDetails returns the detail lines of a DetailedResult, truncated to
+// MaxDetailLines
+func ResultDetails(result Result) []string {
+	detailed, ok := result.(DetailedResult)
+	if !ok {
+		return nil
+	}
+	details := detailed.Details()
+	if MaxDetailLines < 0 || len(details) <= MaxDetailLines {
+		return details
+	}
+	truncated := append([]string{}, details[:MaxDetailLines]...)
+	return append(truncated, fmt.Sprintf("... and %d more", len(details)-MaxDetailLines))
+}
+
 func (r *resultImpl) String() string {
 	return fmt.Sprintf("{name: %s, status: %s, message: %s}", r.name, r.status, r.message)
 }
 
 // Exit prints the check result and exits the program
 func (r *resultImpl) Exit() {
-	fmt.Printf("%s: %s\n", r.Status(), r.Message())
+	fmt.Printf("%s: %s", r.Status(), r.Message())
+	sw := stringWriterFor(os.Stdout)
+	writePerfdata(&sw, r.perfdata)
+	fmt.Println()
+	for _, line := range ResultDetails(r) {
+		fmt.Printf("  %s\n", line)
+	}
 	os.Exit(r.Status().Ordinal())
 }
@@ -2,8 +2,9 @@ package icinga
 
 import (
 	"bytes"
-	"fmt"
+	"io"
 	"os"
+	"sort"
 )
 
 type (
@@ -17,7 +18,8 @@ type (
 	}
 
 	resultsImpl struct {
-		results             map[string]Result
+		results             []Result
+		index               map[string]int
 		statusPolicy        StatusPolicy
 		statusMessagePolicy StatusMessagePolicy
 	}
@@ -31,7 +33,7 @@ type (
 
 // NewResults creates a new instance of Results
 func NewResults() Results {
-	return &resultsImpl{make(map[string]Result), NewDefaultStatusPolicy(), NewDefaultStatusMessagePolicy()}
+	return &resultsImpl{nil, make(map[string]int), NewDefaultStatusPolicy(), NewDefaultStatusMessagePolicy()}
 }
 
 // NewResultsWithOptions creates a new instance of Results with options
@@ -49,21 +51,40 @@ func NewResultsWithOptions(options ResultsOptions) Results {
 	} else {
 		statusMessagePolicy = NewDefaultStatusMessagePolicy()
 	}
-	return &resultsImpl{make(map[string]Result), statusPolicy, statusMessagePolicy}
+	return &resultsImpl{nil, make(map[string]int), statusPolicy, statusMessagePolicy}
 }
 
-// Add adds a element to the set
+// Add adds a element to the set, a result with the same name is replaced
 func (r *resultsImpl) Add(result Result) {
-	r.results[result.Name()] = result
+	if i, found := r.index[result.Name()]; found {
+		r.results[i] = result
+		return
+	}
+	r.index[result.Name()] = len(r.results)
+	r.results = append(r.results, result)
 }
 
-// All returns all values from the set
+// All returns all values from the set in the order they were added
 func (r *resultsImpl) All() []Result {
-	values := []Result{}
-	for _, value := range r.results {
-		values = append(values, value)
+	return append(make([]Result, 0, len(r.results)), r.results...)
+}
+
+// resultList returns all results without copying them for the Results of
+// this package, the returned slice must not be modified
+func resultList(results Results) []Result {
+	if impl, ok := results.(*resultsImpl); ok {
+		return impl.results
 	}
-	return values
+	return results.All()
+}
+
+// sortedByName returns a copy of the results ordered by name
+func sortedByName(results Results) []Result {
+	sorted := append([]Result{}, resultList(results)...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name() < sorted[j].Name()
+	})
+	return sorted
 }
 
 // CalculateStatus calculates the service status for multiple checks
@@ -85,27 +106,58 @@ var resultOrder = []Status{
 
 // Exit prints the check result and exits the program
 func (r *resultsImpl) Exit() {
-	fmt.Print(r)
+	r.WriteTo(os.Stdout)
 	os.Exit(r.CalculateStatus().Ordinal())
 }
 
 func (r *resultsImpl) String() string {
 	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("%s\n", r.GenerateMessage()))
+	r.WriteTo(&buffer)
+	return buffer.String()
+}
 
-	// group all checks by status
-	statusMap := make(map[Status][]Result)
-	for _, result := range r.All() {
-		statusMap[result.Status()] = append(statusMap[result.Status()], result)
+// WriteTo writes the overall message followed by one line per result,
+// grouped by status. The perfdata of all results is appended to the overall
+// message, detail lines are indented below their result.
+func (r *resultsImpl) WriteTo(w io.Writer) (int64, error) {
+	sw := stringWriterFor(w)
+	if writer, ok := r.statusMessagePolicy.(StatusMessageWriter); ok {
+		n, err := writer.WriteMessage(w, r)
+		sw.n, sw.err = n, err
+	} else {
+		sw.WriteString(r.GenerateMessage())
 	}
+	first := true
+	for _, result := range r.results {
+		if perfdata := ResultPerfdata(result); len(perfdata) > 0 {
+			if first {
+				sw.WriteString(" |")
+				first = false
+			}
+			for _, p := range perfdata {
+				sw.WriteString(" ")
+				sw.WriteString(p.String())
+			}
+		}
+	}
+	sw.WriteString("\n")
 
 	for _, status := range resultOrder {
-		if results, found := statusMap[status]; found {
-			for _, result := range results {
-				buffer.WriteString(fmt.Sprintf("%s: %s: %s\n", status, result.Name(), result.Message()))
+		for _, result := range r.results {
+			if result.Status() == status {
+				sw.WriteString(status.String())
+				sw.WriteString(": ")
+				sw.WriteString(result.Name())
+				sw.WriteString(": ")
+				sw.WriteString(result.Message())
+				sw.WriteString("\n")
+				for _, line := range ResultDetails(result) {
+					sw.WriteString("  ")
+					sw.WriteString(line)
+					sw.WriteString("\n")
+				}
 			}
 		}
 	}
-
-	return buffer.String()
+	return sw.n, sw.err
 }
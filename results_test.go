@@ -1,6 +1,9 @@
 package icinga
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"testing"
 )
 
@@ -23,3 +26,121 @@ func TestResults(t *testing.T) {
 	//results.Exit()
 	//fmt.Printf("%v", results)
 }
+
+func TestResultsOrder(t *testing.T) {
+	results := NewResults()
+	results.Add(NewResult("check 2", ServiceStatusOk, "some ok"))
+	results.Add(NewResult("check 1", ServiceStatusCritical, "some critical"))
+	results.Add(NewResult("check 3", ServiceStatusWarning, "some warning"))
+	results.Add(NewResult("check 2", ServiceStatusCritical, "replaced"))
+
+	shouldBe := `CRITICAL: critical: [check 2 check 1] warning: [check 3]
+CRITICAL: check 2: replaced
+CRITICAL: check 1: some critical
+WARNING: check 3: some warning
+`
+	t.Logf("String() is:\n%v", results)
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("String() should be:\n%v", shouldBe)
+	}
+	if len(results.All()) != 3 {
+		t.Errorf("All() should return 3 results")
+	}
+}
+
+func TestResultsDetails(t *testing.T) {
+	defer func(max int) { MaxDetailLines = max }(MaxDetailLines)
+	MaxDetailLines = 2
+
+	results := NewResults()
+	results.Add(NewResultWithDetails("files", ServiceStatusCritical, "3 files failed", []string{"/a", "/b", "/c"}))
+	results.Add(NewResultWithDetails("errors", ServiceStatusWarning, "retried", []string{"timeout"}))
+	results.Add(NewResultOk("plain"))
+
+	shouldBe := `CRITICAL: critical: [files] warning: [errors] ok: [plain]
+CRITICAL: files: 3 files failed
+  /a
+  /b
+  ... and 1 more
+WARNING: errors: retried
+  timeout
+OK: plain: everything ok
+`
+	t.Logf("String() is:\n%v", results)
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("String() should be:\n%v", shouldBe)
+	}
+
+	entries := historyEntries(results)
+	t.Logf("historyEntries() is %v", entries)
+	if len(entries[1].Details) != 3 || entries[2].Details != nil {
+		t.Errorf("historyEntries() should contain the truncated details")
+	}
+}
+
+func TestResultsAllocs(t *testing.T) {
+	results := NewResults()
+	for i := 0; i < 100; i++ {
+		results.Add(NewResult(fmt.Sprintf("check %d", i), Status(i%4), "some message"))
+	}
+	var buffer bytes.Buffer
+	results.(io.WriterTo).WriteTo(&buffer)
+
+	tests := []struct {
+		name     string
+		run      func()
+		shouldBe float64
+	}{
+		{"CalculateStatus", func() { results.CalculateStatus() }, 0},
+		{"WriteTo", func() {
+			buffer.Reset()
+			results.(io.WriterTo).WriteTo(&buffer)
+		}, 0},
+		{"All", func() { results.All() }, 1},
+	}
+	for _, test := range tests {
+		allocs := testing.AllocsPerRun(100, test.run)
+		t.Logf("%v allocs: %v", test.name, allocs)
+		if allocs > test.shouldBe {
+			t.Errorf("%v should not allocate more than %v times", test.name, test.shouldBe)
+		}
+	}
+}
+
+func BenchmarkResultsWriteTo(b *testing.B) {
+	results := NewResults()
+	for i := 0; i < 100; i++ {
+		results.Add(NewResult(fmt.Sprintf("check %d", i), Status(i%4), "some message"))
+	}
+	var buffer bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer.Reset()
+		results.(io.WriterTo).WriteTo(&buffer)
+	}
+}
+
+func BenchmarkResultsString(b *testing.B) {
+	results := NewResults()
+	for i := 0; i < 100; i++ {
+		results.Add(NewResult(fmt.Sprintf("check %d", i), Status(i%4), "some message"))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = fmt.Sprint(results)
+	}
+}
+
+func BenchmarkResultsCalculateStatus(b *testing.B) {
+	results := NewResults()
+	for i := 0; i < 100; i++ {
+		results.Add(NewResult(fmt.Sprintf("check %d", i), Status(i%4), "some message"))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		results.CalculateStatus()
+	}
+}
@@ -0,0 +1,422 @@
+// Package script runs custom checks written in Starlark. Scripts add results
+// with the predeclared functions and run with a timeout and a step limit:
+//
+//	avg = float(read_file("/proc/loadavg").split(" ")[0])
+//	check = status_check(warning="2", critical="4")
+//	result("load", check.check(avg), "load is %s" % avg,
+//		perfdata=[{"label": "load1", "value": avg, "warning": "2", "critical": "4"}])
+//	metric("load1", avg)
+//
+// Predeclared are OK, WARNING, CRITICAL and UNKNOWN and the functions
+// status_check, result, metric, read_file, http_get and exec. Files, URLs and
+// commands must be allowed by the Options, see package allow.
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/allow"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+type (
+	// Options options to run a script
+	Options struct {
+		// Timeout defaults to icinga.DefaultTimeout, the deadline of the
+		// context applies as well
+		Timeout time.Duration
+		// MaxSteps limits the executed Starlark instructions, defaults to
+		// DefaultMaxSteps
+		MaxSteps uint64
+		// Files are the paths read_file may read, shell patterns are allowed,
+		// see allow.NewFiles
+		Files []string
+		// URLPrefixes are the prefixes of URLs http_get may fetch, see
+		// allow.NewURLs
+		URLPrefixes []string
+		// HTTPClient is used by http_get, defaults to http.DefaultClient. It
+		// only follows redirects to allowed URLs.
+		HTTPClient *http.Client
+		// Executor runs the commands of exec, exec fails if nil
+		Executor icinga.Executor
+		// Evaluator evaluates the samples added with metric, they are only
+		// returned by Run and added as perfdata by Checks if nil
+		Evaluator icinga.Evaluator
+		// Args are available as args dict in the script
+		Args map[string]string
+		// Print receives the output of print, it is discarded if nil
+		Print io.Writer
+	}
+
+	// runner holds the state of a single script run
+	runner struct {
+		ctx     context.Context
+		options Options
+		results icinga.Results
+		samples []icinga.Sample
+		files   allow.Files
+		urls    allow.URLs
+		client  *http.Client
+	}
+)
+
+const (
+	// MetricsResultName is the name of the OK Result with the samples as
+	// perfdata added by Checks without Evaluator
+	MetricsResultName = "metrics"
+	// DefaultMaxSteps is the default step limit of a script
+	DefaultMaxSteps = 10000000
+	// maxBodySize limits the response body of http_get
+	maxBodySize = 1024 * 1024
+	// maxFileSize limits the files read by read_file
+	maxFileSize = 16 * 1024 * 1024
+)
+
+// Run executes the script and adds its results to results. src is the source
+// code, the file is read if it is nil. The samples added with metric are
+// returned.
+func Run(ctx context.Context, filename string, src interface{}, options Options, results icinga.Results) ([]icinga.Sample, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = icinga.DefaultTimeout
+	}
+	if options.MaxSteps == 0 {
+		options.MaxSteps = DefaultMaxSteps
+	}
+	files, err := allow.NewFiles(options.Files)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := allow.NewURLs(options.URLPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	r := &runner{ctx: ctx, options: options, results: results, files: files, urls: urls, client: urls.Client(options.HTTPClient)}
+	thread := &starlark.Thread{
+		Name: filename,
+		Print: func(thread *starlark.Thread, msg string) {
+			if options.Print != nil {
+				fmt.Fprintln(options.Print, msg)
+			}
+		},
+	}
+	thread.SetMaxExecutionSteps(options.MaxSteps)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(fmt.Sprintf("script timed out after %v", options.Timeout))
+		case <-done:
+		}
+	}()
+
+	fileOptions := &syntax.FileOptions{TopLevelControl: true, While: true, GlobalReassign: true}
+	if _, err := starlark.ExecFileOptions(fileOptions, thread, filename, src, r.predeclared()); err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return r.samples, scriptError(filename, evalErr)
+		}
+		return r.samples, fmt.Errorf("script %s failed: %v", filename, err)
+	}
+	if options.Evaluator != nil {
+		options.Evaluator.Evaluate(r.samples, results)
+	}
+	return r.samples, nil
+}
+
+// Checks returns a ChecksFunc which runs the script file, e.g. for
+// icinga.PluginOptions.RunContext. Without Evaluator the samples are added as
+// perfdata of a Result named MetricsResultName.
+func Checks(filename string, options Options) icinga.ChecksFunc {
+	return func(ctx context.Context, results icinga.Results) error {
+		samples, err := Run(ctx, filename, nil, options, results)
+		if err == nil && options.Evaluator == nil && len(samples) > 0 {
+			results.Add(icinga.NewSamplesResult(MetricsResultName, samples))
+		}
+		return err
+	}
+}
+
+// scriptError returns the message of a failed script with the innermost
+// position in the script and the failed builtin
+func scriptError(filename string, err *starlark.EvalError) error {
+	message := err.Msg
+	stack := err.CallStack
+	if len(stack) > 0 && stack[len(stack)-1].Pos.Filename() != filename {
+		if name := stack[len(stack)-1].Name; !strings.HasPrefix(message, name+": ") {
+			message = name + ": " + message
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Pos.Filename() == filename {
+			return fmt.Errorf("script failed at %s: %s", stack[i].Pos, message)
+		}
+	}
+	return fmt.Errorf("script %s failed: %s", filename, message)
+}
+
+func (r *runner) predeclared() starlark.StringDict {
+	args := starlark.NewDict(len(r.options.Args))
+	for key, value := range r.options.Args {
+		args.SetKey(starlark.String(key), starlark.String(value))
+	}
+	return starlark.StringDict{
+		"OK":           starlark.String(icinga.ServiceStatusOk.String()),
+		"WARNING":      starlark.String(icinga.ServiceStatusWarning.String()),
+		"CRITICAL":     starlark.String(icinga.ServiceStatusCritical.String()),
+		"UNKNOWN":      starlark.String(icinga.ServiceStatusUnknown.String()),
+		"args":         args,
+		"status_check": starlark.NewBuiltin("status_check", r.statusCheck),
+		"result":       starlark.NewBuiltin("result", r.result),
+		"metric":       starlark.NewBuiltin("metric", r.metric),
+		"read_file":    starlark.NewBuiltin("read_file", r.readFile),
+		"http_get":     starlark.NewBuiltin("http_get", r.httpGet),
+		"exec":         starlark.NewBuiltin("exec", r.exec),
+	}
+}
+
+// statusCheck implements status_check(warning="", critical="") returning a
+// struct with check(value)
+func (r *runner) statusCheck(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var warning, critical string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "warning?", &warning, "critical?", &critical); err != nil {
+		return nil, err
+	}
+	check, err := icinga.NewStatusCheck(warning, critical)
+	if err != nil {
+		return nil, err
+	}
+	checkFn := starlark.NewBuiltin("check", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var value starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &value); err != nil {
+			return nil, err
+		}
+		number, ok := starlark.AsFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("expected number, got %s", value.Type())
+		}
+		return starlark.String(check.Check(number).String()), nil
+	})
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"warning":  starlark.String(warning),
+		"critical": starlark.String(critical),
+		"check":    checkFn,
+	}), nil
+}
+
+// result implements result(name, status, message, details=[], perfdata=[])
+// with perfdata as dicts with label, value, unit, warning, critical, min and
+// max
+func (r *runner) result(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, status, message string
+	var details, perfdataList *starlark.List
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "status", &status, "message", &message, "details?", &details, "perfdata?", &perfdataList); err != nil {
+		return nil, err
+	}
+	var value icinga.StatusValue
+	if err := value.Set(status); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	lines := []string{}
+	if details != nil {
+		for i := 0; i < details.Len(); i++ {
+			line, ok := starlark.AsString(details.Index(i))
+			if !ok {
+				line = details.Index(i).String()
+			}
+			lines = append(lines, line)
+		}
+	}
+	perfdata := []icinga.Perfdata{}
+	if perfdataList != nil {
+		for i := 0; i < perfdataList.Len(); i++ {
+			p, err := perfdataValue(perfdataList.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("invalid perfdata %d: %v", i, err)
+			}
+			perfdata = append(perfdata, p)
+		}
+	}
+	switch {
+	case len(perfdata) > 0:
+		r.results.Add(icinga.NewResultWithDetailsAndPerfdata(name, value.Status, message, lines, perfdata))
+	case len(lines) > 0:
+		r.results.Add(icinga.NewResultWithDetails(name, value.Status, message, lines))
+	default:
+		r.results.Add(icinga.NewResult(name, value.Status, message))
+	}
+	return starlark.None, nil
+}
+
+// perfdataValue returns the perfdata of a dict passed to result
+func perfdataValue(value starlark.Value) (icinga.Perfdata, error) {
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return icinga.Perfdata{}, fmt.Errorf("expected dict, got %s", value.Type())
+	}
+	perfdata := icinga.Perfdata{}
+	hasValue := false
+	for _, item := range dict.Items() {
+		key, _ := starlark.AsString(item[0])
+		switch key {
+		case "label", "unit", "warning", "critical":
+			s, ok := starlark.AsString(item[1])
+			if !ok {
+				return perfdata, fmt.Errorf("%s must be a string, got %s", key, item[1].Type())
+			}
+			switch key {
+			case "label":
+				perfdata.Label = s
+			case "unit":
+				perfdata.Unit = s
+			case "warning":
+				perfdata.Warning = s
+			case "critical":
+				perfdata.Critical = s
+			}
+		case "value", "min", "max":
+			number, ok := starlark.AsFloat(item[1])
+			if !ok {
+				return perfdata, fmt.Errorf("%s must be a number, got %s", key, item[1].Type())
+			}
+			switch key {
+			case "value":
+				perfdata.Value = number
+				hasValue = true
+			case "min":
+				perfdata.Min = &number
+			case "max":
+				perfdata.Max = &number
+			}
+		default:
+			return perfdata, fmt.Errorf("unknown key %s", item[0])
+		}
+	}
+	if perfdata.Label == "" || !hasValue {
+		return perfdata, fmt.Errorf("label and value are required")
+	}
+	return perfdata, nil
+}
+
+// metric implements metric(name, value, unit="", labels={})
+func (r *runner) metric(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, unit string
+	var value starlark.Value
+	var labels *starlark.Dict
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "value", &value, "unit?", &unit, "labels?", &labels); err != nil {
+		return nil, err
+	}
+	number, ok := starlark.AsFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("expected number, got %s", value.Type())
+	}
+	sample := icinga.Sample{Name: name, Value: number, Unit: unit}
+	if labels != nil && labels.Len() > 0 {
+		sample.Labels = make(map[string]string)
+		for _, item := range labels.Items() {
+			key, _ := starlark.AsString(item[0])
+			label, ok := starlark.AsString(item[1])
+			if !ok {
+				label = item[1].String()
+			}
+			sample.Labels[key] = label
+		}
+	}
+	r.samples = append(r.samples, sample)
+	return starlark.None, nil
+}
+
+// readFile implements read_file(path) for allowed files
+func (r *runner) readFile(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	content, err := r.files.ReadFile(path, maxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	return starlark.String(content), nil
+}
+
+// httpGet implements http_get(url, headers={}) returning a struct with
+// status, body and headers
+func (r *runner) httpGet(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url string
+	var headers *starlark.Dict
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &url, "headers?", &headers); err != nil {
+		return nil, err
+	}
+	if err := r.urls.Check(url); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	if headers != nil {
+		for _, item := range headers.Items() {
+			key, _ := starlark.AsString(item[0])
+			value, _ := starlark.AsString(item[1])
+			request.Header.Set(key, value)
+		}
+	}
+	response, err := r.client.Do(request.WithContext(r.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	responseHeaders := starlark.NewDict(len(response.Header))
+	for key := range response.Header {
+		responseHeaders.SetKey(starlark.String(strings.ToLower(key)), starlark.String(response.Header.Get(key)))
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status":  starlark.MakeInt(response.StatusCode),
+		"body":    starlark.String(body),
+		"headers": responseHeaders,
+	}), nil
+}
+
+// exec implements exec(path, *args) through the restricted executor
+func (r *runner) exec(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("unexpected keyword arguments")
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing path")
+	}
+	if r.options.Executor == nil {
+		return nil, fmt.Errorf("no commands allowed")
+	}
+	command := []string{}
+	for _, arg := range args {
+		s, ok := starlark.AsString(arg)
+		if !ok {
+			return nil, fmt.Errorf("expected string arguments, got %s", arg.Type())
+		}
+		command = append(command, s)
+	}
+	output, err := r.options.Executor.Run(r.ctx, command[0], command[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	return starlark.String(output), nil
+}
@@ -0,0 +1,143 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-script")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	loadavg := filepath.Join(dir, "loadavg")
+	if err := ioutil.WriteFile(loadavg, []byte("2.50 1.00 0.50 1/100 123\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", r.Header.Get("X-Token"))
+		fmt.Fprint(w, "healthy")
+	}))
+	defer server.Close()
+
+	executor, err := icinga.NewExecutor(icinga.ExecutorOptions{Rules: []icinga.CommandRule{{Path: "/bin/echo", Args: []string{"hello"}}}})
+	if err != nil {
+		t.Fatalf("NewExecutor() failed: %v", err)
+	}
+
+	src := `
+avg = float(read_file(args["file"]).split(" ")[0])
+check = status_check(warning="2", critical="4")
+result("load", check.check(avg), "load is %s" % avg, details=["1 minute average"],
+       perfdata=[{"label": "load1", "value": avg, "warning": check.warning, "critical": check.critical, "min": 0}])
+metric("load1", avg, labels={"host": "db1"})
+
+response = http_get(args["url"], headers={"X-Token": "v1"})
+result("http", OK if response.status == 200 else CRITICAL, "%s %s" % (response.body, response.headers["x-version"]))
+result("exec", OK, exec("/bin/echo", "hello").strip())
+print("done")
+`
+	var output bytes.Buffer
+	results := icinga.NewResults()
+	options := Options{
+		Files:       []string{filepath.Join(dir, "*")},
+		URLPrefixes: []string{server.URL + "/"},
+		Executor:    executor,
+		Args:        map[string]string{"file": loadavg, "url": server.URL + "/health"},
+		Print:       &output,
+	}
+	samples, err := Run(context.Background(), "check.star", src, options, results)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	t.Logf("Run() is %v", results)
+
+	shouldBe := `WARNING: warning: [load] ok: [http exec] | load1=2.5;2;4;0
+WARNING: load: load is 2.5
+  1 minute average
+OK: http: healthy v1
+OK: exec: hello
+`
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("Run() should be:\n%v", shouldBe)
+	}
+	if len(samples) != 1 || samples[0].ID() != `load1{host="db1"}` || samples[0].Value != 2.5 {
+		t.Errorf("Run() should return the metric but is %v", samples)
+	}
+	if output.String() != "done\n" {
+		t.Errorf("print should write to Print but is %q", output.String())
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	tests := []struct {
+		src      string
+		options  Options
+		errorMsg string
+	}{
+		{`read_file("/etc/shadow")`, Options{}, `script failed at check.star:1:10: read_file: path "/etc/shadow" not allowed`},
+		{`http_get("http://example.com")`, Options{}, `http_get: url "http://example.com" not allowed`},
+		{`http_get("http://example.com.evil.net/")`, Options{URLPrefixes: []string{"http://example.com"}}, `http_get: url "http://example.com.evil.net/" not allowed`},
+		{`read_file("/proc/self/environ")`, Options{Files: []string{"/proc/self/*"}}, `read_file: path "/proc/self/environ" not allowed`},
+		{`pass`, Options{Files: []string{"etc/*"}}, `file pattern "etc/*" is not absolute`},
+		{`exec("/bin/sh", "-c", "id")`, Options{}, "exec: no commands allowed"},
+		{`result("a", "BROKEN", "")`, Options{}, `result: invalid status "BROKEN"`},
+		{`status_check(warning="x")`, Options{}, "can't parse warning threshold string x"},
+		{`result("a", OK, "", perfdata=[{"label": "a"}])`, Options{}, "result: invalid perfdata 0: label and value are required"},
+		{`result("a", OK, "", perfdata=[{"label": "a", "value": "1"}])`, Options{}, "result: invalid perfdata 0: value must be a number, got string"},
+		{`result("a", OK, "", perfdata=[{"label": "a", "value": 1, "limit": 2}])`, Options{}, `result: invalid perfdata 0: unknown key "limit"`},
+		{"while True:\n  pass", Options{MaxSteps: 1000}, "too many steps"},
+		{"while True:\n  pass", Options{MaxSteps: 1 << 62, Timeout: 50 * time.Millisecond}, "script failed at check.star:1:1: Starlark computation cancelled: script timed out after 50ms"},
+		{`fail("broken")`, Options{}, "script failed at check.star:1:5: fail: broken"},
+		{`syntax error`, Options{}, "got identifier, want newline"},
+	}
+	for _, test := range tests {
+		_, err := Run(context.Background(), "check.star", test.src, test.options, icinga.NewResults())
+		t.Logf("Run(%q) is %v", test.src, err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Run(%q) should fail with: %v", test.src, test.errorMsg)
+		}
+	}
+}
+
+func TestChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-script")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "check.star")
+	if err := ioutil.WriteFile(script, []byte(`metric("queue", 120)`), 0644); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	evaluator, err := icinga.NewEvaluator([]icinga.EvaluationRule{{Metric: "queue", Warning: "100"}})
+	if err != nil {
+		t.Fatalf("NewEvaluator() failed: %v", err)
+	}
+	results := icinga.RunChecks(context.Background(), time.Second, icinga.NewResults(), Checks(script, Options{Evaluator: evaluator}))
+	t.Logf("Checks() is %v", results)
+	if results.CalculateStatus() != icinga.ServiceStatusWarning {
+		t.Errorf("Checks() should evaluate the metrics")
+	}
+
+	// without rules the samples are added as perfdata
+	results = icinga.RunChecks(context.Background(), time.Second, icinga.NewResults(), Checks(script, Options{}))
+	t.Logf("Checks() is %v", results)
+	if shouldBe := "OK: ok: [metrics] | queue=120\nOK: metrics: collected samples: 1\n"; fmt.Sprint(results) != shouldBe {
+		t.Errorf("Checks() should be:\n%v", shouldBe)
+	}
+}
@@ -0,0 +1,313 @@
+package icinga
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// SignedResults are rendered Results of a passive check with a signature
+	// covering all fields
+	SignedResults struct {
+		Host     string     `json:"host"`
+		Service  string     `json:"service"`
+		Status   Status     `json:"status"`
+		Output   string     `json:"output"`
+		Perfdata []Perfdata `json:"perfdata,omitempty"`
+		Time     time.Time  `json:"time"`
+		// Nonce is a random value which protects against replays
+		Nonce     string `json:"nonce"`
+		KeyID     string `json:"key_id"`
+		Algorithm string `json:"algorithm"`
+		// Signature is the base64 encoded signature
+		Signature string `json:"signature,omitempty"`
+	}
+
+	// Signer signs SignedResults
+	Signer interface {
+		Sign(results *SignedResults) error
+	}
+
+	// Verifier verifies the signature, age and nonce of SignedResults
+	Verifier interface {
+		Verify(results *SignedResults) error
+	}
+
+	// VerifierOptions options to create a Verifier. Several keys can be
+	// given for key rotation, they are selected by the key id.
+	VerifierOptions struct {
+		HMACKeys    map[string][]byte
+		Ed25519Keys map[string]ed25519.PublicKey
+		// MaxAge is the maximum difference between the time of the results
+		// and now, defaults to 5 minutes
+		MaxAge time.Duration
+		// NonceFile stores the nonces seen within MaxAge, so they are shared
+		// by all receiving processes. They are only kept in memory if empty.
+		NonceFile string
+	}
+
+	hmacSigner struct {
+		keyID string
+		key   []byte
+	}
+
+	ed25519Signer struct {
+		keyID string
+		key   ed25519.PrivateKey
+	}
+
+	verifierImpl struct {
+		sync.Mutex
+		options VerifierOptions
+		// nonces maps the nonces to the time of their results
+		nonces map[string]time.Time
+		now    func() time.Time
+	}
+)
+
+const (
+	// SignatureHMAC signs with HMAC-SHA256
+	SignatureHMAC = "hmac-sha256"
+	// SignatureEd25519 signs with Ed25519
+	SignatureEd25519 = "ed25519"
+)
+
+// NewHMACSigner creates a Signer using HMAC-SHA256
+func NewHMACSigner(keyID string, key []byte) (Signer, error) {
+	if len(key) < 16 {
+		return nil, fmt.Errorf("HMAC key %s is too short, at least 16 bytes are required", keyID)
+	}
+	return &hmacSigner{keyID, key}, nil
+}
+
+// NewEd25519Signer creates a Signer using Ed25519
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) (Signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 key %s", keyID)
+	}
+	return &ed25519Signer{keyID, key}, nil
+}
+
+// SignResults renders and signs the Results of a service with the perfdata
+// of the results
+func SignResults(signer Signer, host string, service string, results Results) (*SignedResults, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %v", err)
+	}
+	signed := &SignedResults{
+		Host:    host,
+		Service: service,
+		Status:  results.CalculateStatus(),
+		Output:  renderResults(results),
+		Time:    time.Now(),
+		Nonce:   hex.EncodeToString(nonce),
+	}
+	if perfdata := ResultsPerfdata(results); len(perfdata) > 0 {
+		signed.Perfdata = perfdata
+	}
+	if err := signer.Sign(signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// renderResults returns the plugin output of the Results
+func renderResults(results Results) string {
+	if writer, ok := results.(io.WriterTo); ok {
+		var buffer bytes.Buffer
+		writer.WriteTo(&buffer)
+		return buffer.String()
+	}
+	return results.GenerateMessage() + "\n"
+}
+
+// payload returns the signed bytes, the fields are encoded as JSON without
+// signature
+func (r *SignedResults) payload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = ""
+	unsigned.Time = r.Time.UTC()
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signed results: %v", err)
+	}
+	return data, nil
+}
+
+// Sign signs the results with HMAC-SHA256
+func (s *hmacSigner) Sign(results *SignedResults) error {
+	results.KeyID, results.Algorithm = s.keyID, SignatureHMAC
+	payload, err := results.payload()
+	if err != nil {
+		return err
+	}
+	results.Signature = base64.StdEncoding.EncodeToString(hmacSum(s.key, payload))
+	return nil
+}
+
+// Sign signs the results with Ed25519
+func (s *ed25519Signer) Sign(results *SignedResults) error {
+	results.KeyID, results.Algorithm = s.keyID, SignatureEd25519
+	payload, err := results.payload()
+	if err != nil {
+		return err
+	}
+	results.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload))
+	return nil
+}
+
+func hmacSum(key []byte, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// NewVerifier creates a Verifier with the given keys
+func NewVerifier(options VerifierOptions) (Verifier, error) {
+	if len(options.HMACKeys) == 0 && len(options.Ed25519Keys) == 0 {
+		return nil, fmt.Errorf("verifier without keys")
+	}
+	for id, key := range options.Ed25519Keys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %s", id)
+		}
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = 5 * time.Minute
+	}
+	return &verifierImpl{options: options, nonces: make(map[string]time.Time), now: time.Now}, nil
+}
+
+// Verify checks the signature, rejects results outside of MaxAge and
+// results with a nonce which was already seen
+func (v *verifierImpl) Verify(results *SignedResults) error {
+	if results.Signature == "" {
+		return fmt.Errorf("unsigned results")
+	}
+	signature, err := base64.StdEncoding.DecodeString(results.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	payload, err := results.payload()
+	if err != nil {
+		return err
+	}
+
+	switch results.Algorithm {
+	case SignatureHMAC:
+		key, found := v.options.HMACKeys[results.KeyID]
+		if !found {
+			return fmt.Errorf("unknown HMAC key %q", results.KeyID)
+		}
+		if !hmac.Equal(signature, hmacSum(key, payload)) {
+			return fmt.Errorf("invalid signature")
+		}
+	case SignatureEd25519:
+		key, found := v.options.Ed25519Keys[results.KeyID]
+		if !found {
+			return fmt.Errorf("unknown Ed25519 key %q", results.KeyID)
+		}
+		if !ed25519.Verify(key, payload, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unknown signature algorithm %q", results.Algorithm)
+	}
+
+	now := v.now()
+	if age := now.Sub(results.Time); age > v.options.MaxAge || age < -v.options.MaxAge {
+		return fmt.Errorf("results from %s are outside of the accepted time window", results.Time.Format(time.RFC3339))
+	}
+	if results.Nonce == "" {
+		return fmt.Errorf("results without nonce")
+	}
+	return v.useNonce(results.Nonce, results.Time, now)
+}
+
+// useNonce records the nonce, it fails if the nonce was already seen.
+// Nonces are forgotten when their results are outside of MaxAge.
+func (v *verifierImpl) useNonce(nonce string, t time.Time, now time.Time) error {
+	v.Lock()
+	defer v.Unlock()
+	if v.options.NonceFile == "" {
+		return recordNonce(v.nonces, nonce, t, now, v.options.MaxAge)
+	}
+
+	lock, err := os.OpenFile(v.options.NonceFile+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open nonce lock: %v", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock nonces: %v", err)
+	}
+	defer unlockFile(lock)
+
+	nonces := make(map[string]time.Time)
+	data, err := ioutil.ReadFile(v.options.NonceFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read nonces: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &nonces); err != nil {
+			return fmt.Errorf("failed to parse nonces %s: %v", v.options.NonceFile, err)
+		}
+	}
+	if err := recordNonce(nonces, nonce, t, now, v.options.MaxAge); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(nonces); err != nil {
+		return fmt.Errorf("failed to encode nonces: %v", err)
+	}
+	if err := writeFileAtomic(v.options.NonceFile, data); err != nil {
+		return fmt.Errorf("failed to write nonces: %v", err)
+	}
+	return nil
+}
+
+func recordNonce(nonces map[string]time.Time, nonce string, t time.Time, now time.Time, maxAge time.Duration) error {
+	for seen, seenTime := range nonces {
+		if now.Sub(seenTime) > maxAge {
+			delete(nonces, seen)
+		}
+	}
+	if _, found := nonces[nonce]; found {
+		return fmt.Errorf("replayed results with nonce %s", nonce)
+	}
+	nonces[nonce] = t
+	return nil
+}
+
+// VerifiedResult returns the verified results as Result named like the
+// service, the perfdata after " | " in the first line of the output is
+// parsed into a PerfdataResult. Invalid or unsigned results are UNKNOWN.
+func VerifiedResult(verifier Verifier, results *SignedResults) Result {
+	if err := verifier.Verify(results); err != nil {
+		return NewResultUnknownMessage(results.Service, fmt.Sprintf("rejected results of %s: %v", results.Host, err))
+	}
+	lines := strings.SplitN(strings.TrimRight(results.Output, "\n"), "\n", 2)
+	i := strings.Index(lines[0], " | ")
+	if i < 0 {
+		return NewResult(results.Service, results.Status, strings.Join(lines, "\n"))
+	}
+	perfdata, err := ParsePerfdataList(lines[0][i+3:])
+	if err != nil {
+		return NewResultUnknownMessage(results.Service, fmt.Sprintf("rejected results of %s: %v", results.Host, err))
+	}
+	lines[0] = lines[0][:i]
+	return NewResultWithPerfdata(results.Service, results.Status, strings.Join(lines, "\n"), perfdata)
+}
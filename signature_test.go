@@ -0,0 +1,160 @@
+package icinga
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignResults(t *testing.T) {
+	hmacKey := []byte("0123456789abcdef")
+	public, private, _ := ed25519.GenerateKey(nil)
+	oldPublic, oldPrivate, _ := ed25519.GenerateKey(nil)
+	hmacSigner, _ := NewHMACSigner("2026-10", hmacKey)
+	ed25519Signer, _ := NewEd25519Signer("2026-10", private)
+	oldSigner, _ := NewEd25519Signer("2026-09", oldPrivate)
+	verifier, err := NewVerifier(VerifierOptions{
+		HMACKeys:    map[string][]byte{"2026-10": hmacKey},
+		Ed25519Keys: map[string]ed25519.PublicKey{"2026-10": public, "2026-09": oldPublic},
+	})
+	if err != nil {
+		t.Fatalf("NewVerifier() failed: %v", err)
+	}
+
+	results := NewResults()
+	results.Add(NewResultWithPerfdata("disk", ServiceStatusWarning, "85% used", []Perfdata{{Label: "disk used", Value: 85, Unit: "%", Warning: "80", Critical: "90"}}))
+	for _, signer := range []Signer{hmacSigner, ed25519Signer, oldSigner} {
+		signed, err := SignResults(signer, "db1", "disk", results)
+		if err != nil {
+			t.Fatalf("SignResults() failed: %v", err)
+		}
+		if len(signed.Perfdata) != 1 || signed.Perfdata[0].Label != "disk used" {
+			t.Errorf("SignResults() should contain the perfdata of the results but is %v", signed.Perfdata)
+		}
+
+		// the results are transported as JSON
+		data, _ := json.Marshal(signed)
+		t.Logf("signed results are %s", data)
+		received := &SignedResults{}
+		if err := json.Unmarshal(data, received); err != nil {
+			t.Fatalf("failed to decode signed results: %v", err)
+		}
+		result := VerifiedResult(verifier, received)
+		t.Logf("VerifiedResult() is %v", result)
+		if result.Name() != "disk" || result.Status() != ServiceStatusWarning ||
+			result.Message() != "WARNING: warning: [disk]\nWARNING: disk: 85% used" {
+			t.Errorf("VerifiedResult() should return the signed results")
+		}
+		if perfdata := perfdataString(ResultPerfdata(result)); perfdata != "'disk used'=85%;80;90" {
+			t.Errorf("VerifiedResult() should parse the perfdata of the output but is %s", perfdata)
+		}
+
+		result = VerifiedResult(verifier, received)
+		t.Logf("VerifiedResult() of a replay is %v", result)
+		if result.Status() != ServiceStatusUnknown || !strings.Contains(result.Message(), "replayed results") {
+			t.Errorf("VerifiedResult() should reject replays")
+		}
+	}
+
+	// signed output with invalid perfdata is rejected
+	signed, _ := SignResults(hmacSigner, "db1", "disk", results)
+	signed.Output = "WARNING: disk | used=x\n"
+	hmacSigner.Sign(signed)
+	result := VerifiedResult(verifier, signed)
+	t.Logf("VerifiedResult() with invalid perfdata is %v", result)
+	if result.Status() != ServiceStatusUnknown || !strings.Contains(result.Message(), `invalid perfdata value "x"`) {
+		t.Errorf("VerifiedResult() should reject invalid perfdata")
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	signer, _ := NewHMACSigner("current", key)
+	retired, _ := NewHMACSigner("retired", key)
+	verifier, _ := NewVerifier(VerifierOptions{HMACKeys: map[string][]byte{"current": key}, MaxAge: time.Minute})
+	sign := func(modify func(*SignedResults)) *SignedResults {
+		signed, _ := SignResults(signer, "db1", "disk", NewResults())
+		modify(signed)
+		return signed
+	}
+	resign := func(r *SignedResults) {
+		signer.Sign(r)
+	}
+
+	tests := []struct {
+		results  *SignedResults
+		errorMsg string
+	}{
+		{sign(func(r *SignedResults) { r.Signature = "" }), "unsigned results"},
+		{sign(func(r *SignedResults) { r.Status = ServiceStatusOk; r.Output = "OK: forged\n" }), "invalid signature"},
+		{sign(func(r *SignedResults) { r.Perfdata = []Perfdata{{Label: "forged", Value: 1}} }), "invalid signature"},
+		{sign(func(r *SignedResults) { r.Host = "db2" }), "invalid signature"},
+		{sign(func(r *SignedResults) { r.Time = r.Time.Add(time.Second) }), "invalid signature"},
+		{sign(func(r *SignedResults) { r.Algorithm = SignatureEd25519 }), `unknown Ed25519 key "current"`},
+		{sign(func(r *SignedResults) { retired.Sign(r) }), `unknown HMAC key "retired"`},
+		{sign(func(r *SignedResults) { r.Signature = "%%%" }), "invalid signature encoding"},
+		{sign(func(r *SignedResults) { r.Time = r.Time.Add(-2 * time.Minute); resign(r) }), "outside of the accepted time window"},
+		{sign(func(r *SignedResults) { r.Time = r.Time.Add(2 * time.Minute); resign(r) }), "outside of the accepted time window"},
+		{sign(func(r *SignedResults) { r.Nonce = ""; resign(r) }), "results without nonce"},
+	}
+	for _, test := range tests {
+		err := verifier.Verify(test.results)
+		t.Logf("Verify() is %v", err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Verify() should fail with: %v", test.errorMsg)
+		}
+	}
+
+	if _, err := NewHMACSigner("short", []byte("short")); err == nil {
+		t.Errorf("NewHMACSigner() should reject short keys")
+	}
+	if _, err := NewVerifier(VerifierOptions{}); err == nil {
+		t.Errorf("NewVerifier() should require keys")
+	}
+}
+
+func TestVerifyNonceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-signature")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := []byte("0123456789abcdef")
+	signer, _ := NewHMACSigner("current", key)
+	options := VerifierOptions{HMACKeys: map[string][]byte{"current": key}, MaxAge: time.Minute, NonceFile: filepath.Join(dir, "nonces")}
+	signed, _ := SignResults(signer, "db1", "disk", NewResults())
+
+	// every receiving process has its own verifier
+	first, _ := NewVerifier(options)
+	if err := first.Verify(signed); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+	second, _ := NewVerifier(options)
+	err = second.Verify(signed)
+	t.Logf("Verify() of a replay is %v", err)
+	if err == nil {
+		t.Errorf("Verify() should reject replays seen by other processes")
+	}
+
+	// expired nonces are removed
+	later := second.(*verifierImpl)
+	later.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	signed, _ = SignResults(signer, "db1", "disk", NewResults())
+	signed.Time = later.now()
+	signer.Sign(signed)
+	if err := later.Verify(signed); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+	data, _ := ioutil.ReadFile(options.NonceFile)
+	nonces := make(map[string]time.Time)
+	json.Unmarshal(data, &nonces)
+	if len(nonces) != 1 {
+		t.Errorf("nonce file should only contain the new nonce but is %s", data)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build go1.21
+// +build go1.21
+
+package icinga
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+type (
+	// SlogErrorCollector is a slog.Handler which collects all error records
+	// of a check run, to report them as UNKNOWN Result
+	SlogErrorCollector interface {
+		slog.Handler
+		Result(name string) Result
+	}
+
+	slogErrorCollector struct {
+		next   slog.Handler
+		attrs  []slog.Attr
+		errors *slogErrors
+	}
+
+	slogErrors struct {
+		sync.Mutex
+		messages []string
+	}
+)
+
+// SlogLevel maps the number of -v flags to a slog.Level, following the
+// verbosity levels of the plugin development guidelines
+func SlogLevel(verbosity int) slog.Level {
+	switch {
+	case verbosity <= 0:
+		return slog.LevelWarn
+	case verbosity == 1:
+		return slog.LevelInfo
+	case verbosity == 2:
+		return slog.LevelDebug
+	}
+	return slog.LevelDebug - 4
+}
+
+// NewVerboseLogger returns a slog.Logger which writes text records to w
+// if they are enabled by the given verbosity
+func NewVerboseLogger(w io.Writer, verbosity int) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: SlogLevel(verbosity)}))
+}
+
+// slogLevelForStatus maps a Status to a slog.Level
+func slogLevelForStatus(status Status) slog.Level {
+	switch status {
+	case ServiceStatusOk:
+		return slog.LevelInfo
+	case ServiceStatusWarning:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// LogResults logs every Result and the overall status as structured records
+func LogResults(logger *slog.Logger, results Results) {
+	ctx := context.Background()
+	for _, result := range sortedByName(results) {
+		logger.LogAttrs(ctx, slogLevelForStatus(result.Status()), result.Message(),
+			slog.String("name", result.Name()),
+			slog.String("status", result.Status().String()))
+	}
+	status := results.CalculateStatus()
+	logger.LogAttrs(ctx, slogLevelForStatus(status), results.GenerateMessage(),
+		slog.String("status", status.String()))
+}
+
+// NewSlogErrorCollector creates a slog.Handler which collects all records of
+// level error and above. All records are passed on to next, if not nil.
+func NewSlogErrorCollector(next slog.Handler) SlogErrorCollector {
+	return &slogErrorCollector{next, nil, &slogErrors{}}
+}
+
+// Enabled reports whether the handler handles records at the given level
+func (h *slogErrorCollector) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= slog.LevelError {
+		return true
+	}
+	return h.next != nil && h.next.Enabled(ctx, level)
+}
+
+// Handle collects error records and passes the record on
+func (h *slogErrorCollector) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		var buffer strings.Builder
+		buffer.WriteString(record.Message)
+		appendAttr := func(attr slog.Attr) bool {
+			buffer.WriteString(fmt.Sprintf(" %s=%v", attr.Key, attr.Value))
+			return true
+		}
+		for _, attr := range h.attrs {
+			appendAttr(attr)
+		}
+		record.Attrs(appendAttr)
+
+		h.errors.Lock()
+		h.errors.messages = append(h.errors.messages, buffer.String())
+		h.errors.Unlock()
+	}
+	if h.next != nil && h.next.Enabled(ctx, record.Level) {
+		return h.next.Handle(ctx, record)
+	}
+	return nil
+}
+
+// WithAttrs returns a handler which adds attrs to every record
+func (h *slogErrorCollector) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := h.next
+	if next != nil {
+		next = next.WithAttrs(attrs)
+	}
+	return &slogErrorCollector{next, append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...), h.errors}
+}
+
+// WithGroup returns a handler which passes records to a grouped next handler
+func (h *slogErrorCollector) WithGroup(name string) slog.Handler {
+	next := h.next
+	if next != nil {
+		next = next.WithGroup(name)
+	}
+	return &slogErrorCollector{next, h.attrs, h.errors}
+}
+
+// Result returns an UNKNOWN Result containing all collected errors or nil if
+// no error was logged
+func (h *slogErrorCollector) Result(name string) Result {
+	h.errors.Lock()
+	defer h.errors.Unlock()
+	if len(h.errors.messages) == 0 {
+		return nil
+	}
+	return NewResultUnknownMessage(name, strings.Join(h.errors.messages, ", "))
+}
@@ -0,0 +1,86 @@
+//go:build go1.21
+// +build go1.21
+
+package icinga
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLevel(t *testing.T) {
+	tests := []struct {
+		verbosity int
+		shouldBe  slog.Level
+	}{
+		{0, slog.LevelWarn},
+		{1, slog.LevelInfo},
+		{2, slog.LevelDebug},
+		{3, slog.LevelDebug - 4},
+	}
+	for _, test := range tests {
+		level := SlogLevel(test.verbosity)
+		t.Logf("SlogLevel(%v) is %v", test.verbosity, level)
+		if level != test.shouldBe {
+			t.Errorf("SlogLevel(%v) should be %v", test.verbosity, test.shouldBe)
+		}
+	}
+}
+
+func TestLogResults(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buffer, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+
+	results := NewResults()
+	results.Add(NewResult("check 1", ServiceStatusWarning, "some warning"))
+	results.Add(NewResultOk("check 2"))
+	LogResults(logger, results)
+
+	shouldBe := `level=WARN msg="some warning" name="check 1" status=WARNING
+level=INFO msg="everything ok" name="check 2" status=OK
+level=WARN msg="WARNING: warning: [check 1] ok: [check 2]" status=WARNING
+`
+	t.Logf("log is:\n%v", buffer.String())
+	if buffer.String() != shouldBe {
+		t.Errorf("log should be:\n%v", shouldBe)
+	}
+}
+
+func TestSlogErrorCollector(t *testing.T) {
+	var buffer bytes.Buffer
+	collector := NewSlogErrorCollector(slog.NewTextHandler(&buffer, nil))
+	logger := slog.New(collector)
+
+	if result := collector.Result("logs"); result != nil {
+		t.Errorf("Result() should be nil without errors")
+	}
+
+	logger.Info("connecting")
+	logger.With("host", "db1").Error("connection failed", "attempt", 2)
+	logger.Error("giving up")
+
+	result := collector.Result("logs")
+	if result == nil {
+		t.Fatalf("Result() should not be nil")
+	}
+	t.Logf("Result() is %v", result)
+	if result.Status() != ServiceStatusUnknown {
+		t.Errorf("Result() status should be %v", ServiceStatusUnknown)
+	}
+	shouldBe := "connection failed host=db1 attempt=2, giving up"
+	if result.Message() != shouldBe {
+		t.Errorf("Result() message should be %v", shouldBe)
+	}
+	if strings.Count(buffer.String(), "\n") != 3 {
+		t.Errorf("all records should be passed on")
+	}
+}
@@ -1,5 +1,7 @@
 package icinga
 
+import "fmt"
+
 // Status defines the service status
 type Status int
 
@@ -48,3 +50,21 @@ func NewStatus(statusString string) Status {
 	}
 	panic("invalid icinga.Status")
 }
+
+// MarshalText implements encoding.TextMarshaler
+func (s Status) MarshalText() ([]byte, error) {
+	if s < ServiceStatusOk || s > ServiceStatusUnknown {
+		return nil, fmt.Errorf("invalid icinga.Status %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *Status) UnmarshalText(text []byte) error {
+	status, found := statusMap[string(text)]
+	if !found {
+		return fmt.Errorf("invalid icinga.Status %q", text)
+	}
+	*s = status
+	return nil
+}
@@ -12,6 +12,13 @@ type (
 		CompareBool(value bool) Status
 	}
 
+	// BatchStatusCheck is implemented by status checks which check a batch
+	// of values faster than one by one, see StatusCheckAll
+	BatchStatusCheck interface {
+		StatusCheck
+		CheckAll(values []float64, statuses []Status) []Status
+	}
+
 	statusCheckImpl struct {
 		warning  Range
 		critical Range
@@ -62,6 +69,29 @@ func (e *statusCheckImpl) CheckInt32(value int32) Status {
 	return e.Check(float64(value))
 }
 
+// CheckAll checks a batch of values and appends the statuses to
+// statuses[:0], passing the slice of a previous call avoids allocations.
+func (e *statusCheckImpl) CheckAll(values []float64, statuses []Status) []Status {
+	statuses = statuses[:0]
+	for _, value := range values {
+		statuses = append(statuses, e.Check(value))
+	}
+	return statuses
+}
+
+// StatusCheckAll checks a batch of values and appends the statuses to
+// statuses[:0], status checks implementing BatchStatusCheck check them at once
+func StatusCheckAll(c StatusCheck, values []float64, statuses []Status) []Status {
+	if batch, ok := c.(BatchStatusCheck); ok {
+		return batch.CheckAll(values, statuses)
+	}
+	statuses = statuses[:0]
+	for _, value := range values {
+		statuses = append(statuses, c.Check(value))
+	}
+	return statuses
+}
+
 // Compare evaluates a clousre and return the Status parsed from the
 // result string
 func (e *statusCheckImpl) Compare(value func() bool) Status {
@@ -61,3 +61,41 @@ func TestStatusCheckCompare(t *testing.T) {
 		}
 	}
 }
+
+func TestStatusCheckCheckAll(t *testing.T) {
+	e, err := NewStatusCheck("5:", "2:")
+	if err != nil {
+		t.Fatalf("failed to initialize escalation: %v", err)
+	}
+	values := []float64{-5.0, 1.0, 2.0, 4.0, 5.0}
+	shouldBe := []Status{ServiceStatusCritical, ServiceStatusCritical, ServiceStatusWarning, ServiceStatusWarning, ServiceStatusOk}
+
+	statuses := StatusCheckAll(e, values, nil)
+	for i, status := range statuses {
+		if status != shouldBe[i] {
+			t.Errorf("StatusCheckAll()[%d] should be: %v", i, shouldBe[i])
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		statuses = StatusCheckAll(e, values, statuses)
+	})
+	t.Logf("StatusCheckAll() allocs: %v", allocs)
+	if allocs != 0 {
+		t.Errorf("StatusCheckAll() should not allocate with a reused slice")
+	}
+}
+
+func BenchmarkStatusCheckCheckAll(b *testing.B) {
+	e, _ := NewStatusCheck("10", "20")
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = float64(i % 30)
+	}
+	statuses := make([]Status, 0, len(values))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		statuses = StatusCheckAll(e, values, statuses)
+	}
+}
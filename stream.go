@@ -0,0 +1,128 @@
+package icinga
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// StreamingResults writes every added Result as NDJSON line, followed by
+	// a summary record when the check is done
+	StreamingResults interface {
+		Results
+		// WriteSummary writes the summary record
+		WriteSummary() error
+		// Err returns the first error writing the stream
+		Err() error
+	}
+
+	// StreamRecord is a line of the NDJSON stream
+	StreamRecord struct {
+		// Type is StreamRecordResult or StreamRecordSummary
+		Type     string     `json:"type"`
+		Time     time.Time  `json:"time"`
+		Name     string     `json:"name,omitempty"`
+		Status   Status     `json:"status"`
+		Message  string     `json:"message"`
+		Details  []string   `json:"details,omitempty"`
+		Perfdata []Perfdata `json:"perfdata,omitempty"`
+		// Results is the number of results of a summary
+		Results int `json:"results,omitempty"`
+		// Duration is the runtime in seconds until the summary
+		Duration float64 `json:"duration,omitempty"`
+	}
+
+	streamResults struct {
+		Results
+		sync.Mutex
+		encoder *json.Encoder
+		start   time.Time
+		err     error
+	}
+)
+
+const (
+	// StreamRecordResult is the type of a record for a Result
+	StreamRecordResult = "result"
+	// StreamRecordSummary is the type of the final record with the overall
+	// status and message
+	StreamRecordSummary = "summary"
+)
+
+// NewStreamingResults returns Results which write every added Result to w
+// immediately, status and message are calculated by results
+func NewStreamingResults(w io.Writer, results Results) StreamingResults {
+	return &streamResults{Results: results, encoder: json.NewEncoder(w), start: time.Now()}
+}
+
+// Add adds the Result and writes it to the stream
+func (r *streamResults) Add(result Result) {
+	r.Lock()
+	defer r.Unlock()
+	r.Results.Add(result)
+	r.write(StreamRecord{
+		Type:     StreamRecordResult,
+		Time:     time.Now(),
+		Name:     result.Name(),
+		Status:   result.Status(),
+		Message:  result.Message(),
+		Details:  ResultDetails(result),
+		Perfdata: ResultPerfdata(result),
+	})
+}
+
+// WriteSummary writes the overall status and message of all results
+func (r *streamResults) WriteSummary() error {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	r.write(StreamRecord{
+		Type:     StreamRecordSummary,
+		Time:     now,
+		Status:   r.Results.CalculateStatus(),
+		Message:  r.Results.GenerateMessage(),
+		Results:  len(r.Results.All()),
+		Duration: now.Sub(r.start).Seconds(),
+	})
+	return r.err
+}
+
+// Err returns the first error writing the stream
+func (r *streamResults) Err() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.err
+}
+
+// Exit writes the summary and exits the program with the overall status
+func (r *streamResults) Exit() {
+	r.WriteSummary()
+	os.Exit(r.CalculateStatus().Ordinal())
+}
+
+func (r *streamResults) write(record StreamRecord) {
+	if r.err == nil {
+		r.err = r.encoder.Encode(record)
+	}
+}
+
+func (r *streamResults) All() []Result {
+	r.Lock()
+	defer r.Unlock()
+	return r.Results.All()
+}
+
+func (r *streamResults) CalculateStatus() Status {
+	r.Lock()
+	defer r.Unlock()
+	return r.Results.CalculateStatus()
+}
+
+func (r *streamResults) GenerateMessage() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.Results.GenerateMessage()
+}
@@ -0,0 +1,104 @@
+package icinga
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStreamingResults(t *testing.T) {
+	var buffer bytes.Buffer
+	stream := NewStreamingResults(&buffer, NewResults())
+
+	// the second check never finishes, the first result must be streamed
+	// before the timeout
+	lines := make(chan int, 1)
+	RunChecks(context.Background(), 50*time.Millisecond, stream, func(ctx context.Context, results Results) error {
+		results.Add(NewResult("scan /", ServiceStatusOk, "done"))
+		lines <- bytes.Count(buffer.Bytes(), []byte("\n"))
+		results.Add(NewResult("scan /var", ServiceStatusWarning, "slow"))
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := stream.WriteSummary(); err != nil {
+		t.Fatalf("WriteSummary() failed: %v", err)
+	}
+	if count := <-lines; count != 1 {
+		t.Errorf("a result should be written as soon as it is added, but %d lines were written", count)
+	}
+
+	expected := []StreamRecord{
+		{Type: StreamRecordResult, Name: "scan /", Status: ServiceStatusOk, Message: "done"},
+		{Type: StreamRecordResult, Name: "scan /var", Status: ServiceStatusWarning, Message: "slow"},
+		{Type: StreamRecordResult, Name: CheckResultName, Status: ServiceStatusUnknown, Message: "check timed out after 50ms"},
+		{Type: StreamRecordSummary, Status: ServiceStatusUnknown, Message: stream.GenerateMessage(), Results: 3},
+	}
+	scanner := bufio.NewScanner(&buffer)
+	for i := 0; scanner.Scan(); i++ {
+		t.Logf("line %d is %s", i, scanner.Text())
+		var record StreamRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d is invalid: %v", i, err)
+		}
+		if i >= len(expected) {
+			t.Errorf("there should be %d lines", len(expected))
+			break
+		}
+		if record.Time.IsZero() {
+			t.Errorf("line %d should contain the time", i)
+		}
+		record.Time = time.Time{}
+		if record.Type == StreamRecordSummary && record.Duration <= 0 {
+			t.Errorf("summary should contain the duration")
+		}
+		record.Duration = 0
+		if !reflect.DeepEqual(record, expected[i]) {
+			t.Errorf("line %d should be %+v", i, expected[i])
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("Err() should be nil but is %v", err)
+	}
+}
+
+func TestPluginOptionsStreamTimeout(t *testing.T) {
+	tests := []struct {
+		args   []string
+		status Status
+	}{
+		{[]string{"--output", "ndjson", "--timeout", "10ms"}, ServiceStatusOk},
+		{[]string{"--output", "ndjson", "--timeout", "10ms", "--stream-timeout", "20ms"}, ServiceStatusUnknown},
+	}
+	for _, test := range tests {
+		o, err := NewPluginOptions("check_foo", "10", "20")
+		if err != nil {
+			t.Fatalf("failed to create plugin options: %v", err)
+		}
+		fs := flag.NewFlagSet("check_foo", flag.ContinueOnError)
+		o.Register(fs)
+		if err := o.Parse(fs, test.args); err != nil {
+			t.Fatalf("Parse(%v) failed: %v", test.args, err)
+		}
+
+		// the check runs longer than --timeout but not than --stream-timeout
+		var buffer bytes.Buffer
+		results := o.stream(context.Background(), &buffer, func(ctx context.Context, results Results) error {
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			results.Add(NewResultOk("scan"))
+			return nil
+		})
+		t.Logf("stream with %v is %v: %s", test.args, results.CalculateStatus(), buffer.String())
+		if results.CalculateStatus() != test.status {
+			t.Errorf("stream with %v should be %v", test.args, test.status)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package icinga
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type (
+	// SyslogOptions options to generate a new syslog Sink
+	SyslogOptions struct {
+		// Network is one of unixgram, udp or tcp, defaults to unixgram
+		Network string
+		// Address defaults to /dev/log
+		Address string
+		// Facility defaults to 3 (daemon) if nil
+		Facility *int
+		// Hostname defaults to os.Hostname()
+		Hostname string
+		// Plugin is used as APP-NAME and plugin parameter
+		Plugin string
+	}
+
+	syslogSink struct {
+		options  SyslogOptions
+		facility int
+		now      func() time.Time
+	}
+)
+
+const (
+	// syslogStructuredDataID uses the private enterprise number reserved for
+	// documentation (RFC 5612)
+	syslogStructuredDataID = "icinga@32473"
+)
+
+// NewSystemLogSink returns a Sink writing to the system log, target is either
+// "syslog" or "journald", see PluginOptions.LogSink
+func NewSystemLogSink(target string, plugin string) (Sink, error) {
+	switch target {
+	case "syslog":
+		return NewSyslogSink(SyslogOptions{Plugin: plugin}), nil
+	case "journald":
+		return NewJournaldSink(JournaldOptions{Plugin: plugin}), nil
+	}
+	return nil, fmt.Errorf("unknown system log target %q, must be syslog or journald", target)
+}
+
+// NewSyslogSink creates a Sink which writes every Result as RFC 5424 message
+// with structured data
+func NewSyslogSink(options SyslogOptions) Sink {
+	if options.Network == "" {
+		options.Network = "unixgram"
+	}
+	if options.Address == "" {
+		options.Address = "/dev/log"
+	}
+	facility := 3
+	if options.Facility != nil {
+		facility = *options.Facility
+	}
+	if options.Hostname == "" {
+		options.Hostname, _ = os.Hostname()
+	}
+	return &syslogSink{options, facility, time.Now}
+}
+
+// Write sends one message per Result
+func (s *syslogSink) Write(results Results) error {
+	conn, err := net.Dial(s.options.Network, s.options.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	defer conn.Close()
+
+	for _, result := range sortedByName(results) {
+		message := s.format(result)
+		if s.options.Network == "tcp" {
+			// octet counting framing, see RFC 6587
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+		if _, err := conn.Write([]byte(message)); err != nil {
+			return fmt.Errorf("failed to write to syslog: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) format(result Result) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("<%d>1 %s %s %s %d - ",
+		s.facility*8+syslogSeverity(result.Status()),
+		s.now().Format(time.RFC3339Nano),
+		syslogHeaderField(s.options.Hostname),
+		syslogHeaderField(s.options.Plugin),
+		os.Getpid()))
+	buffer.WriteString(fmt.Sprintf("[%s plugin=\"%s\" name=\"%s\" status=\"%s\"",
+		syslogStructuredDataID,
+		syslogParamValue(s.options.Plugin),
+		syslogParamValue(result.Name()),
+		result.Status()))
+	if perfdata := ResultPerfdata(result); len(perfdata) > 0 {
+		buffer.WriteString(fmt.Sprintf(" perfdata=\"%s\"", syslogParamValue(perfdataString(perfdata))))
+	}
+	buffer.WriteString("] ")
+	buffer.WriteString(fmt.Sprintf("%s: %s: %s", result.Status(), result.Name(), result.Message()))
+	return buffer.String()
+}
+
+// syslogSeverity maps a Status to a syslog severity
+func syslogSeverity(status Status) int {
+	switch status {
+	case ServiceStatusOk:
+		return 6 // informational
+	case ServiceStatusWarning:
+		return 4 // warning
+	case ServiceStatusCritical:
+		return 2 // critical
+	}
+	return 3 // error
+}
+
+// syslogHeaderField returns the NILVALUE for empty header fields and removes
+// characters not allowed in header fields
+func syslogHeaderField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// syslogParamValue escapes '"', '\' and ']' in structured data parameter values
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,60 @@
+package icinga
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSyslogSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-syslog")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "log")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on %v: %v", socket, err)
+	}
+	defer conn.Close()
+
+	kern := 0
+	sink := NewSyslogSink(SyslogOptions{Address: socket, Facility: &kern, Hostname: "host1", Plugin: "check_foo"})
+	sink.(*syslogSink).now = func() time.Time { return time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	results := NewResults()
+	results.Add(NewResult(`check "1"`, ServiceStatusOk, "some ok"))
+	results.Add(NewResultWithPerfdata("check 2", ServiceStatusCritical, "some critical", []Perfdata{{Label: "used", Value: 98, Unit: "%"}}))
+	if err := sink.Write(results); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	tests := []string{
+		`^<6>1 2018-01-01T00:00:00Z host1 check_foo \d+ - \[icinga@32473 plugin="check_foo" name="check \\"1\\"" status="OK"\] OK: check "1": some ok$`,
+		`^<2>1 2018-01-01T00:00:00Z host1 check_foo \d+ - \[icinga@32473 plugin="check_foo" name="check 2" status="CRITICAL" perfdata="used=98%"\] CRITICAL: check 2: some critical$`,
+	}
+	buffer := make([]byte, 4096)
+	for _, test := range tests {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buffer)
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		message := string(buffer[:n])
+		t.Logf("message is: %v", message)
+		if !regexp.MustCompile(test).MatchString(message) {
+			t.Errorf("message should match: %v", test)
+		}
+	}
+
+	// the facility defaults to daemon
+	if facility := NewSyslogSink(SyslogOptions{}).(*syslogSink).facility; facility != 3 {
+		t.Errorf("facility should default to 3 but is %d", facility)
+	}
+}
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"context"
+	"io"
+
+	"github.com/djaenecke/icinga-checks-library/transport/icingapb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	// ResultServer receives the reports submitted to the ResultService
+	ResultServer interface {
+		// Submit handles a report, an error aborts the stream of the client
+		Submit(ctx context.Context, report *Report) error
+	}
+
+	// ResultServerFunc is a function implementing ResultServer
+	ResultServerFunc func(ctx context.Context, report *Report) error
+
+	// ResultClient submits reports to a ResultService
+	ResultClient interface {
+		// Submit opens a stream, reports are sent until it is closed
+		Submit(ctx context.Context) (ReportStream, error)
+	}
+
+	// ReportStream is a stream of reports submitted by a ResultClient
+	ReportStream interface {
+		Send(report *Report) error
+		// Close closes the stream and returns the number of reports accepted
+		// by the server
+		Close() (uint64, error)
+	}
+
+	// resultService implements the generated service with a ResultServer
+	resultService struct {
+		icingapb.UnimplementedResultServiceServer
+		srv ResultServer
+	}
+
+	resultClient struct {
+		client icingapb.ResultServiceClient
+	}
+
+	reportStream struct {
+		stream icingapb.ResultService_SubmitClient
+	}
+)
+
+// ServiceName is the full name of the ResultService
+const ServiceName = "icinga.v1.ResultService"
+
+// Submit calls f
+func (f ResultServerFunc) Submit(ctx context.Context, report *Report) error {
+	return f(ctx, report)
+}
+
+// NewServer creates a gRPC server with the ResultService
+func NewServer(srv ResultServer, options ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(options...)
+	RegisterResultServer(s, srv)
+	return s
+}
+
+// RegisterResultServer registers the ResultService
+func RegisterResultServer(s grpc.ServiceRegistrar, srv ResultServer) {
+	icingapb.RegisterResultServiceServer(s, &resultService{srv: srv})
+}
+
+// Submit passes the received reports to the ResultServer and returns their
+// number when the client closes the stream
+func (s *resultService) Submit(stream icingapb.ResultService_SubmitServer) error {
+	var accepted uint64
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&icingapb.SubmitResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		report, err := FromProto(message)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid report: %v", err)
+		}
+		if err := s.srv.Submit(stream.Context(), report); err != nil {
+			return err
+		}
+		accepted++
+	}
+}
+
+// NewResultClient creates a ResultClient using conn
+func NewResultClient(conn grpc.ClientConnInterface) ResultClient {
+	return &resultClient{icingapb.NewResultServiceClient(conn)}
+}
+
+// Submit opens a stream for reports
+func (c *resultClient) Submit(ctx context.Context) (ReportStream, error) {
+	stream, err := c.client.Submit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &reportStream{stream}, nil
+}
+
+// Send sends a report
+func (s *reportStream) Send(report *Report) error {
+	message, err := ToProto(report)
+	if err != nil {
+		return err
+	}
+	return s.stream.Send(message)
+}
+
+// Close closes the stream and waits for the response of the server
+func (s *reportStream) Close() (uint64, error) {
+	response, err := s.stream.CloseAndRecv()
+	if err != nil {
+		return 0, err
+	}
+	return response.GetAccepted(), nil
+}
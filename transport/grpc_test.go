@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport/icingapb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dial(t *testing.T, srv ResultServer) (ResultClient, func()) {
+	conn, stop := dialConn(t, srv)
+	return NewResultClient(conn), stop
+}
+
+func dialConn(t *testing.T, srv ResultServer) (*grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(srv)
+	go server.Serve(listener)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	var mutex sync.Mutex
+	received := []*Report{}
+	client, stop := dial(t, ResultServerFunc(func(ctx context.Context, report *Report) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, report)
+		return nil
+	}))
+	defer stop()
+
+	stream, err := client.Submit(context.Background())
+	if err != nil {
+		t.Fatalf("Submit() failed: %v", err)
+	}
+	results := icinga.NewResults()
+	results.Add(icinga.NewResult("queue", icinga.ServiceStatusWarning, "120 mails"))
+	sent := []*Report{
+		NewReport("mx1!queue", results, []icinga.Sample{{Name: "queue_length", Value: 120}}),
+		testReport(),
+	}
+	for _, report := range sent {
+		if err := stream.Send(report); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+	accepted, err := stream.Close()
+	if err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	t.Logf("accepted %d reports", accepted)
+	if accepted != 2 || len(received) != 2 {
+		t.Fatalf("all reports should be accepted")
+	}
+	if toResults, err := received[0].ToResults(); received[0].Status != icinga.ServiceStatusWarning || err != nil || fmt.Sprint(toResults) != fmt.Sprint(results) {
+		t.Errorf("received report should be %v but is %v", results, toResults)
+	}
+	if received[1].Source != "db1!disk" || len(received[1].Children) != 2 {
+		t.Errorf("received report should be %+v but is %+v", sent[1], received[1])
+	}
+}
+
+func TestSubmitRejected(t *testing.T) {
+	client, stop := dial(t, ResultServerFunc(func(ctx context.Context, report *Report) error {
+		return fmt.Errorf("unknown source %s", report.Source)
+	}))
+	defer stop()
+
+	stream, err := client.Submit(context.Background())
+	if err != nil {
+		t.Fatalf("Submit() failed: %v", err)
+	}
+	stream.Send(&Report{Source: "db9!disk"})
+	_, err = stream.Close()
+	t.Logf("Close() is %v", err)
+	if err == nil || !strings.Contains(err.Error(), "unknown source db9!disk") {
+		t.Errorf("Close() should return the error of the server")
+	}
+}
+
+func TestSubmitGenerated(t *testing.T) {
+	received := make(chan *Report, 2)
+	conn, stop := dialConn(t, ResultServerFunc(func(ctx context.Context, report *Report) error {
+		received <- report
+		return nil
+	}))
+	defer stop()
+
+	// clients generated from icinga.proto use the standard codec
+	stream, err := icingapb.NewResultServiceClient(conn).Submit(context.Background())
+	if err != nil {
+		t.Fatalf("Submit() failed: %v", err)
+	}
+	message, _ := ToProto(testReport())
+	if err := stream.Send(message); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	if err := stream.Send(&icingapb.Report{Source: "db1!disk", Status: icingapb.Status(7)}); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	_, err = stream.CloseAndRecv()
+	t.Logf("CloseAndRecv() is %v", err)
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "invalid status 7") {
+		t.Errorf("CloseAndRecv() should reject the invalid report")
+	}
+	if report := <-received; !reflect.DeepEqual(report, testReport()) {
+		t.Errorf("received report should be %+v but is %+v", testReport(), report)
+	}
+}
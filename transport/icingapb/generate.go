@@ -0,0 +1,6 @@
+// Package icingapb contains the code generated from icinga.proto. Use the
+// types of package transport, which convert these messages from and to
+// icinga.Result and icinga.Sample.
+package icingapb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative icinga.proto
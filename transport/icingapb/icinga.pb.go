@@ -0,0 +1,586 @@
+// Wire format of check results, see package transport. Field numbers must
+// never be changed or reused.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v7.35.1
+// source: icinga.proto
+
+package icingapb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Status int32
+
+const (
+	Status_OK       Status = 0
+	Status_WARNING  Status = 1
+	Status_CRITICAL Status = 2
+	Status_UNKNOWN  Status = 3
+)
+
+// Enum value maps for Status.
+var (
+	Status_name = map[int32]string{
+		0: "OK",
+		1: "WARNING",
+		2: "CRITICAL",
+		3: "UNKNOWN",
+	}
+	Status_value = map[string]int32{
+		"OK":       0,
+		"WARNING":  1,
+		"CRITICAL": 2,
+		"UNKNOWN":  3,
+	}
+)
+
+func (x Status) Enum() *Status {
+	p := new(Status)
+	*p = x
+	return p
+}
+
+func (x Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_icinga_proto_enumTypes[0].Descriptor()
+}
+
+func (Status) Type() protoreflect.EnumType {
+	return &file_icinga_proto_enumTypes[0]
+}
+
+func (x Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Status.Descriptor instead.
+func (Status) EnumDescriptor() ([]byte, []int) {
+	return file_icinga_proto_rawDescGZIP(), []int{0}
+}
+
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Status        Status                 `protobuf:"varint,2,opt,name=status,proto3,enum=icinga.v1.Status" json:"status,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Details       []string               `protobuf:"bytes,4,rep,name=details,proto3" json:"details,omitempty"`
+	Perfdata      []*Perfdata            `protobuf:"bytes,5,rep,name=perfdata,proto3" json:"perfdata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_icinga_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_icinga_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_icinga_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Result) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Result) GetStatus() Status {
+	if x != nil {
+		return x.Status
+	}
+	return Status_OK
+}
+
+func (x *Result) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Result) GetDetails() []string {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+func (x *Result) GetPerfdata() []*Perfdata {
+	if x != nil {
+		return x.Perfdata
+	}
+	return nil
+}
+
+// Perfdata is a performance data value of a result, warning and critical
+// are thresholds in range syntax
+type Perfdata struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Label         string                 `protobuf:"bytes,1,opt,name=label,proto3" json:"label,omitempty"`
+	Value         float64                `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Warning       string                 `protobuf:"bytes,4,opt,name=warning,proto3" json:"warning,omitempty"`
+	Critical      string                 `protobuf:"bytes,5,opt,name=critical,proto3" json:"critical,omitempty"`
+	Min           *float64               `protobuf:"fixed64,6,opt,name=min,proto3,oneof" json:"min,omitempty"`
+	Max           *float64               `protobuf:"fixed64,7,opt,name=max,proto3,oneof" json:"max,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Perfdata) Reset() {
+	*x = Perfdata{}
+	mi := &file_icinga_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Perfdata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Perfdata) ProtoMessage() {}
+
+func (x *Perfdata) ProtoReflect() protoreflect.Message {
+	mi := &file_icinga_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Perfdata.ProtoReflect.Descriptor instead.
+func (*Perfdata) Descriptor() ([]byte, []int) {
+	return file_icinga_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Perfdata) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Perfdata) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Perfdata) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Perfdata) GetWarning() string {
+	if x != nil {
+		return x.Warning
+	}
+	return ""
+}
+
+func (x *Perfdata) GetCritical() string {
+	if x != nil {
+		return x.Critical
+	}
+	return ""
+}
+
+func (x *Perfdata) GetMin() float64 {
+	if x != nil && x.Min != nil {
+		return *x.Min
+	}
+	return 0
+}
+
+func (x *Perfdata) GetMax() float64 {
+	if x != nil && x.Max != nil {
+		return *x.Max
+	}
+	return 0
+}
+
+// Sample is a metric value, the perfdata of a check
+type Sample struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Value         float64                `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,4,opt,name=unit,proto3" json:"unit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sample) Reset() {
+	*x = Sample{}
+	mi := &file_icinga_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sample) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sample) ProtoMessage() {}
+
+func (x *Sample) ProtoReflect() protoreflect.Message {
+	mi := &file_icinga_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sample.ProtoReflect.Descriptor instead.
+func (*Sample) Descriptor() ([]byte, []int) {
+	return file_icinga_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Sample) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Sample) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Sample) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Sample) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+// Report is a check run with its results and samples
+type Report struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// source identifies the check, e.g. host!service
+	Source string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Time   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Labels map[string]string      `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// status and message are the overall status and message of the results
+	Status  Status    `protobuf:"varint,4,opt,name=status,proto3,enum=icinga.v1.Status" json:"status,omitempty"`
+	Message string    `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	Results []*Result `protobuf:"bytes,6,rep,name=results,proto3" json:"results,omitempty"`
+	Samples []*Sample `protobuf:"bytes,7,rep,name=samples,proto3" json:"samples,omitempty"`
+	// children are nested reports, e.g. of the checks of an aggregator
+	Children      []*Report `protobuf:"bytes,8,rep,name=children,proto3" json:"children,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Report) Reset() {
+	*x = Report{}
+	mi := &file_icinga_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Report) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Report) ProtoMessage() {}
+
+func (x *Report) ProtoReflect() protoreflect.Message {
+	mi := &file_icinga_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Report.ProtoReflect.Descriptor instead.
+func (*Report) Descriptor() ([]byte, []int) {
+	return file_icinga_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Report) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Report) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Report) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Report) GetStatus() Status {
+	if x != nil {
+		return x.Status
+	}
+	return Status_OK
+}
+
+func (x *Report) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Report) GetResults() []*Result {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *Report) GetSamples() []*Sample {
+	if x != nil {
+		return x.Samples
+	}
+	return nil
+}
+
+func (x *Report) GetChildren() []*Report {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+type SubmitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      uint64                 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitResponse) Reset() {
+	*x = SubmitResponse{}
+	mi := &file_icinga_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitResponse) ProtoMessage() {}
+
+func (x *SubmitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_icinga_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitResponse.ProtoReflect.Descriptor instead.
+func (*SubmitResponse) Descriptor() ([]byte, []int) {
+	return file_icinga_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubmitResponse) GetAccepted() uint64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+var File_icinga_proto protoreflect.FileDescriptor
+
+const file_icinga_proto_rawDesc = "" +
+	"\n" +
+	"\ficinga.proto\x12\ticinga.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xac\x01\n" +
+	"\x06Result\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12)\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x11.icinga.v1.StatusR\x06status\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x18\n" +
+	"\adetails\x18\x04 \x03(\tR\adetails\x12/\n" +
+	"\bperfdata\x18\x05 \x03(\v2\x13.icinga.v1.PerfdataR\bperfdata\"\xbe\x01\n" +
+	"\bPerfdata\x12\x14\n" +
+	"\x05label\x18\x01 \x01(\tR\x05label\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12\x18\n" +
+	"\awarning\x18\x04 \x01(\tR\awarning\x12\x1a\n" +
+	"\bcritical\x18\x05 \x01(\tR\bcritical\x12\x15\n" +
+	"\x03min\x18\x06 \x01(\x01H\x00R\x03min\x88\x01\x01\x12\x15\n" +
+	"\x03max\x18\a \x01(\x01H\x01R\x03max\x88\x01\x01B\x06\n" +
+	"\x04_minB\x06\n" +
+	"\x04_max\"\xb8\x01\n" +
+	"\x06Sample\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x125\n" +
+	"\x06labels\x18\x02 \x03(\v2\x1d.icinga.v1.Sample.LabelsEntryR\x06labels\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x04 \x01(\tR\x04unit\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x90\x03\n" +
+	"\x06Report\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x125\n" +
+	"\x06labels\x18\x03 \x03(\v2\x1d.icinga.v1.Report.LabelsEntryR\x06labels\x12)\n" +
+	"\x06status\x18\x04 \x01(\x0e2\x11.icinga.v1.StatusR\x06status\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\x12+\n" +
+	"\aresults\x18\x06 \x03(\v2\x11.icinga.v1.ResultR\aresults\x12+\n" +
+	"\asamples\x18\a \x03(\v2\x11.icinga.v1.SampleR\asamples\x12-\n" +
+	"\bchildren\x18\b \x03(\v2\x11.icinga.v1.ReportR\bchildren\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\",\n" +
+	"\x0eSubmitResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x04R\baccepted*8\n" +
+	"\x06Status\x12\x06\n" +
+	"\x02OK\x10\x00\x12\v\n" +
+	"\aWARNING\x10\x01\x12\f\n" +
+	"\bCRITICAL\x10\x02\x12\v\n" +
+	"\aUNKNOWN\x10\x032I\n" +
+	"\rResultService\x128\n" +
+	"\x06Submit\x12\x11.icinga.v1.Report\x1a\x19.icinga.v1.SubmitResponse(\x01B?Z=github.com/djaenecke/icinga-checks-library/transport/icingapbb\x06proto3"
+
+var (
+	file_icinga_proto_rawDescOnce sync.Once
+	file_icinga_proto_rawDescData []byte
+)
+
+func file_icinga_proto_rawDescGZIP() []byte {
+	file_icinga_proto_rawDescOnce.Do(func() {
+		file_icinga_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_icinga_proto_rawDesc), len(file_icinga_proto_rawDesc)))
+	})
+	return file_icinga_proto_rawDescData
+}
+
+var file_icinga_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_icinga_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_icinga_proto_goTypes = []any{
+	(Status)(0),                   // 0: icinga.v1.Status
+	(*Result)(nil),                // 1: icinga.v1.Result
+	(*Perfdata)(nil),              // 2: icinga.v1.Perfdata
+	(*Sample)(nil),                // 3: icinga.v1.Sample
+	(*Report)(nil),                // 4: icinga.v1.Report
+	(*SubmitResponse)(nil),        // 5: icinga.v1.SubmitResponse
+	nil,                           // 6: icinga.v1.Sample.LabelsEntry
+	nil,                           // 7: icinga.v1.Report.LabelsEntry
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+}
+var file_icinga_proto_depIdxs = []int32{
+	0,  // 0: icinga.v1.Result.status:type_name -> icinga.v1.Status
+	2,  // 1: icinga.v1.Result.perfdata:type_name -> icinga.v1.Perfdata
+	6,  // 2: icinga.v1.Sample.labels:type_name -> icinga.v1.Sample.LabelsEntry
+	8,  // 3: icinga.v1.Report.time:type_name -> google.protobuf.Timestamp
+	7,  // 4: icinga.v1.Report.labels:type_name -> icinga.v1.Report.LabelsEntry
+	0,  // 5: icinga.v1.Report.status:type_name -> icinga.v1.Status
+	1,  // 6: icinga.v1.Report.results:type_name -> icinga.v1.Result
+	3,  // 7: icinga.v1.Report.samples:type_name -> icinga.v1.Sample
+	4,  // 8: icinga.v1.Report.children:type_name -> icinga.v1.Report
+	4,  // 9: icinga.v1.ResultService.Submit:input_type -> icinga.v1.Report
+	5,  // 10: icinga.v1.ResultService.Submit:output_type -> icinga.v1.SubmitResponse
+	10, // [10:11] is the sub-list for method output_type
+	9,  // [9:10] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_icinga_proto_init() }
+func file_icinga_proto_init() {
+	if File_icinga_proto != nil {
+		return
+	}
+	file_icinga_proto_msgTypes[1].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_icinga_proto_rawDesc), len(file_icinga_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_icinga_proto_goTypes,
+		DependencyIndexes: file_icinga_proto_depIdxs,
+		EnumInfos:         file_icinga_proto_enumTypes,
+		MessageInfos:      file_icinga_proto_msgTypes,
+	}.Build()
+	File_icinga_proto = out.File
+	file_icinga_proto_goTypes = nil
+	file_icinga_proto_depIdxs = nil
+}
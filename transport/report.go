@@ -0,0 +1,308 @@
+// Package transport ships check results between plugins, aggregators and
+// other tools as protocol buffers, see icingapb/icinga.proto for the schema.
+// Reports are encoded with Marshal and Unmarshal and can be streamed to a
+// collector with the ResultService gRPC service.
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport/icingapb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Report is a check run with its results and samples, it is transported as
+// the Report message
+type Report struct {
+	// Source identifies the check, e.g. host!service
+	Source string
+	Time   time.Time
+	Labels map[string]string
+	// Status and Message are the overall status and message of the results
+	Status  icinga.Status
+	Message string
+	Results []icinga.Result
+	Samples []icinga.Sample
+	// Children are nested reports, e.g. of the checks of an aggregator
+	Children []*Report
+}
+
+type (
+	// reportJSON is the JSON mapping of the Report message
+	reportJSON struct {
+		Source   string            `json:"source,omitempty"`
+		Time     *time.Time        `json:"time,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Status   icinga.Status     `json:"status"`
+		Message  string            `json:"message,omitempty"`
+		Results  []resultJSON      `json:"results,omitempty"`
+		Samples  []icinga.Sample   `json:"samples,omitempty"`
+		Children []*Report         `json:"children,omitempty"`
+	}
+
+	// resultJSON is the JSON mapping of the Result message
+	resultJSON struct {
+		Name     string            `json:"name"`
+		Status   icinga.Status     `json:"status"`
+		Message  string            `json:"message,omitempty"`
+		Details  []string          `json:"details,omitempty"`
+		Perfdata []icinga.Perfdata `json:"perfdata,omitempty"`
+	}
+)
+
+// MaxDepth limits the nesting of reports accepted by Unmarshal
+const MaxDepth = 100
+
+// NewReport creates a Report of the current time from results and the
+// samples collected with them
+func NewReport(source string, results icinga.Results, samples []icinga.Sample) *Report {
+	return &Report{
+		Source:  source,
+		Time:    time.Now(),
+		Status:  results.CalculateStatus(),
+		Message: results.GenerateMessage(),
+		Results: results.All(),
+		Samples: samples,
+	}
+}
+
+// ToResults returns the results of the report, the results of children are
+// not included. Results with the same name would replace each other, so they
+// are an error.
+func (r *Report) ToResults() (icinga.Results, error) {
+	results := icinga.NewResults()
+	names := make(map[string]bool)
+	for _, result := range r.Results {
+		if names[result.Name()] {
+			return nil, fmt.Errorf("report %s contains result %s more than once", r.Source, result.Name())
+		}
+		names[result.Name()] = true
+		results.Add(result)
+	}
+	return results, nil
+}
+
+// Marshal encodes the report as Report message, maps are sorted so the
+// encoding is stable
+func Marshal(report *Report) ([]byte, error) {
+	message, err := ToProto(report)
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(message)
+}
+
+// Unmarshal decodes a Report message, unknown fields are skipped
+func Unmarshal(data []byte) (*Report, error) {
+	message := &icingapb.Report{}
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %v", err)
+	}
+	report, err := FromProto(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse report: %v", err)
+	}
+	return report, nil
+}
+
+// ToProto converts the report to the generated Report message
+func ToProto(r *Report) (*icingapb.Report, error) {
+	message := &icingapb.Report{
+		Source:  r.Source,
+		Labels:  r.Labels,
+		Message: r.Message,
+	}
+	if !r.Time.IsZero() {
+		message.Time = timestamppb.New(r.Time)
+	}
+	var err error
+	if message.Status, err = toStatus(r.Status); err != nil {
+		return nil, err
+	}
+	for _, result := range r.Results {
+		m := &icingapb.Result{Name: result.Name(), Message: result.Message()}
+		if m.Status, err = toStatus(result.Status()); err != nil {
+			return nil, fmt.Errorf("invalid result %s: %v", result.Name(), err)
+		}
+		// all details are transported, they are only truncated for output
+		if detailed, ok := result.(icinga.DetailedResult); ok {
+			m.Details = detailed.Details()
+		}
+		for _, perfdata := range icinga.ResultPerfdata(result) {
+			m.Perfdata = append(m.Perfdata, &icingapb.Perfdata{
+				Label:    perfdata.Label,
+				Value:    perfdata.Value,
+				Unit:     perfdata.Unit,
+				Warning:  perfdata.Warning,
+				Critical: perfdata.Critical,
+				Min:      perfdata.Min,
+				Max:      perfdata.Max,
+			})
+		}
+		message.Results = append(message.Results, m)
+	}
+	for _, sample := range r.Samples {
+		message.Samples = append(message.Samples, &icingapb.Sample{
+			Name:   sample.Name,
+			Labels: sample.Labels,
+			Value:  sample.Value,
+			Unit:   sample.Unit,
+		})
+	}
+	for _, child := range r.Children {
+		m, err := ToProto(child)
+		if err != nil {
+			return nil, err
+		}
+		message.Children = append(message.Children, m)
+	}
+	return message, nil
+}
+
+// FromProto converts a generated Report message, children nested deeper than
+// MaxDepth are an error
+func FromProto(message *icingapb.Report) (*Report, error) {
+	return fromProto(message, 0)
+}
+
+func fromProto(message *icingapb.Report, depth int) (*Report, error) {
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("reports nested deeper than %d", MaxDepth)
+	}
+	r := &Report{
+		Source:  message.GetSource(),
+		Labels:  labels(message.GetLabels()),
+		Message: message.GetMessage(),
+	}
+	if message.Time != nil {
+		if err := message.Time.CheckValid(); err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %v", err)
+		}
+		r.Time = message.Time.AsTime()
+	}
+	var err error
+	if r.Status, err = fromStatus(message.GetStatus()); err != nil {
+		return nil, err
+	}
+	for _, m := range message.GetResults() {
+		status, err := fromStatus(m.GetStatus())
+		if err != nil {
+			return nil, err
+		}
+		var perfdata []icinga.Perfdata
+		for _, p := range m.GetPerfdata() {
+			perfdata = append(perfdata, icinga.Perfdata{
+				Label:    p.GetLabel(),
+				Value:    p.GetValue(),
+				Unit:     p.GetUnit(),
+				Warning:  p.GetWarning(),
+				Critical: p.GetCritical(),
+				Min:      p.Min,
+				Max:      p.Max,
+			})
+		}
+		r.Results = append(r.Results, newResult(m.GetName(), status, m.GetMessage(), m.GetDetails(), perfdata))
+	}
+	for _, m := range message.GetSamples() {
+		r.Samples = append(r.Samples, icinga.Sample{
+			Name:   m.GetName(),
+			Labels: labels(m.GetLabels()),
+			Value:  m.GetValue(),
+			Unit:   m.GetUnit(),
+		})
+	}
+	for _, m := range message.GetChildren() {
+		child, err := fromProto(m, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		r.Children = append(r.Children, child)
+	}
+	return r, nil
+}
+
+// MarshalJSON encodes the report like the JSON mapping of the Report message
+func (r *Report) MarshalJSON() ([]byte, error) {
+	v := reportJSON{
+		Source:   r.Source,
+		Labels:   r.Labels,
+		Status:   r.Status,
+		Message:  r.Message,
+		Samples:  r.Samples,
+		Children: r.Children,
+	}
+	if !r.Time.IsZero() {
+		v.Time = &r.Time
+	}
+	for _, result := range r.Results {
+		var details []string
+		if detailed, ok := result.(icinga.DetailedResult); ok {
+			details = detailed.Details()
+		}
+		v.Results = append(v.Results, resultJSON{result.Name(), result.Status(), result.Message(), details, icinga.ResultPerfdata(result)})
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the JSON mapping of the Report message
+func (r *Report) UnmarshalJSON(data []byte) error {
+	var v reportJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = Report{
+		Source:   v.Source,
+		Labels:   v.Labels,
+		Status:   v.Status,
+		Message:  v.Message,
+		Samples:  v.Samples,
+		Children: v.Children,
+	}
+	if v.Time != nil {
+		r.Time = *v.Time
+	}
+	for _, result := range v.Results {
+		r.Results = append(r.Results, newResult(result.Name, result.Status, result.Message, result.Details, result.Perfdata))
+	}
+	return nil
+}
+
+// newResult creates a Result with the interfaces of its details and perfdata
+func newResult(name string, status icinga.Status, message string, details []string, perfdata []icinga.Perfdata) icinga.Result {
+	switch {
+	case len(perfdata) > 0 && len(details) > 0:
+		return icinga.NewResultWithDetailsAndPerfdata(name, status, message, details, perfdata)
+	case len(perfdata) > 0:
+		return icinga.NewResultWithPerfdata(name, status, message, perfdata)
+	case len(details) > 0:
+		return icinga.NewResultWithDetails(name, status, message, details)
+	}
+	return icinga.NewResult(name, status, message)
+}
+
+func toStatus(status icinga.Status) (icingapb.Status, error) {
+	if status < icinga.ServiceStatusOk || status > icinga.ServiceStatusUnknown {
+		return 0, fmt.Errorf("invalid status %d", int(status))
+	}
+	return icingapb.Status(status), nil
+}
+
+// fromStatus rejects the unknown values of the open enum
+func fromStatus(status icingapb.Status) (icinga.Status, error) {
+	if status < icingapb.Status_OK || status > icingapb.Status_UNKNOWN {
+		return 0, fmt.Errorf("invalid status %d", int32(status))
+	}
+	return icinga.Status(status), nil
+}
+
+// labels returns nil for empty maps, like a report without labels
+func labels(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/transport/icingapb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func testReport() *Report {
+	details := []string{}
+	for i := 0; i < icinga.MaxDetailLines+5; i++ {
+		details = append(details, fmt.Sprintf("/var/log/file%d", i))
+	}
+	max := 100.0
+	perfdata := []icinga.Perfdata{{Label: "/var", Value: 98.5, Unit: "%", Warning: "80", Critical: "90", Min: new(float64), Max: &max}}
+	return &Report{
+		Source:  "db1!disk",
+		Time:    time.Date(2026, 10, 17, 12, 0, 0, 123456789, time.UTC),
+		Labels:  map[string]string{"env": "prod", "team": ""},
+		Status:  icinga.ServiceStatusCritical,
+		Message: "critical: [/var]",
+		Results: []icinga.Result{
+			icinga.NewResult("/", icinga.ServiceStatusOk, "10% used"),
+			icinga.NewResultWithDetailsAndPerfdata("/var", icinga.ServiceStatusCritical, "98% used", details, perfdata),
+			icinga.NewResultWithPerfdata("/home", icinga.ServiceStatusOk, "5% used", []icinga.Perfdata{{Label: "/home", Value: 5}}),
+		},
+		Samples: []icinga.Sample{
+			{Name: "disk_used", Labels: map[string]string{"mount": "/"}, Value: 10, Unit: "%"},
+			{Name: "disk_used", Labels: map[string]string{"mount": "/var"}, Value: 98.5, Unit: "%"},
+			{Name: "offset", Value: math.Copysign(0, -1)},
+			{Name: "idle"},
+		},
+		Children: []*Report{
+			{Source: "db1!disk-old", Time: time.Unix(0, 0).UTC(), Status: icinga.ServiceStatusUnknown, Results: []icinga.Result{
+				icinga.NewResultWithPerfdata("/tmp", icinga.ServiceStatusUnknown, "stale", []icinga.Perfdata{{Label: "/tmp", Value: 1, Unit: "B", Max: &max}}),
+			}},
+			{Source: "db1!disk-before-epoch", Time: time.Date(1969, 12, 31, 23, 59, 59, 5, time.UTC)},
+		},
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	report := testReport()
+	data, err := Marshal(report)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	parsed, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	t.Logf("Unmarshal() is %+v", parsed)
+	if !reflect.DeepEqual(parsed, report) {
+		t.Errorf("Unmarshal() should be %+v", report)
+	}
+	if math.Signbit(parsed.Samples[2].Value) != true {
+		t.Errorf("Unmarshal() should keep -0")
+	}
+	if len(parsed.Results[1].(icinga.DetailedResult).Details()) != icinga.MaxDetailLines+5 {
+		t.Errorf("Unmarshal() should keep all details")
+	}
+	for _, result := range []icinga.Result{parsed.Results[1], parsed.Results[2], parsed.Children[0].Results[0]} {
+		original := icinga.ResultPerfdata(result)
+		t.Logf("perfdata of %s is %v", result.Name(), original)
+		if len(original) != 1 || original[0].Label != result.Name() {
+			t.Errorf("Unmarshal() should keep the perfdata of %s", result.Name())
+		}
+	}
+	if p := icinga.ResultPerfdata(parsed.Results[1])[0]; p.String() != "/var=98.5%;80;90;0;100" {
+		t.Errorf("Unmarshal() should keep the thresholds, min and max but is %v", p)
+	}
+	results, err := parsed.ToResults()
+	if err != nil || len(results.All()) != 3 || results.CalculateStatus() != icinga.ServiceStatusCritical {
+		t.Errorf("ToResults() should return the results but is %v, %v", results, err)
+	}
+	report.Results = append(report.Results, icinga.NewResultOk("/"))
+	if _, err := report.ToResults(); err == nil || err.Error() != "report db1!disk contains result / more than once" {
+		t.Errorf("ToResults() should fail for duplicate names but is %v", err)
+	}
+
+	again, _ := Marshal(parsed)
+	if string(again) != string(data) {
+		t.Errorf("Marshal() should be stable")
+	}
+	if data, err := Marshal(&Report{}); err != nil || len(data) != 0 {
+		t.Errorf("Marshal() of an empty report should be empty but is %v, %v", data, err)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	report := testReport()
+	report.Samples = report.Samples[:2]
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	t.Logf("json.Marshal() is %s", data)
+	if !strings.Contains(string(data), `{"name":"/","status":"OK","message":"10% used"}`) {
+		t.Errorf("json.Marshal() should contain the results")
+	}
+	if !strings.Contains(string(data), `"perfdata":[{"label":"/var","value":98.5,"unit":"%","warning":"80","critical":"90","min":0,"max":100}]`) {
+		t.Errorf("json.Marshal() should contain the perfdata")
+	}
+
+	parsed := &Report{}
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, report) {
+		t.Errorf("json.Unmarshal() should be %+v but is %+v", report, parsed)
+	}
+	if err := json.Unmarshal([]byte(`{"status":"BROKEN"}`), parsed); err == nil {
+		t.Errorf("json.Unmarshal() should fail for invalid status")
+	}
+}
+
+func TestMarshalCompatible(t *testing.T) {
+	data, err := Marshal(testReport())
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	message := &icingapb.Report{}
+	if err := proto.Unmarshal(data, message); err != nil {
+		t.Fatalf("proto.Unmarshal() failed: %v", err)
+	}
+	text, _ := protojson.Marshal(message)
+	t.Logf("message is %s", text)
+	for _, expected := range []string{`"status":"CRITICAL"`, `"time":"2026-10-17T12:00:00.123456789Z"`, `"labels":{"mount":"/var"}`} {
+		if !strings.Contains(string(text), expected) {
+			t.Errorf("message should contain %s", expected)
+		}
+	}
+
+	// unknown fields of a newer schema are skipped
+	data = protowire.AppendTag(data, 99, protowire.BytesType)
+	data = protowire.AppendString(data, "future")
+	if _, err := Unmarshal(data); err != nil {
+		t.Errorf("Unmarshal() should skip unknown fields: %v", err)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	valid, _ := Marshal(testReport())
+	nested := &icingapb.Report{}
+	for i := 0; i <= MaxDepth; i++ {
+		nested = &icingapb.Report{Children: []*icingapb.Report{nested}}
+	}
+	tests := []struct {
+		message  proto.Message
+		data     []byte
+		errorMsg string
+	}{
+		{nil, valid[:len(valid)-3], "failed to parse report"},
+		{&icingapb.Report{Status: 4}, nil, "invalid status 4"},
+		{&icingapb.Report{Results: []*icingapb.Result{{Status: -1}}}, nil, "invalid status -1"},
+		{&icingapb.Report{Time: &timestamppb.Timestamp{Nanos: int32(time.Second)}}, nil, "invalid timestamp"},
+		{nested, nil, fmt.Sprintf("nested deeper than %d", MaxDepth)},
+	}
+	for _, test := range tests {
+		if test.message != nil {
+			test.data, _ = proto.Marshal(test.message)
+		}
+		_, err := Unmarshal(test.data)
+		t.Logf("Unmarshal() is %v", err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Unmarshal() should fail with: %v", test.errorMsg)
+		}
+	}
+
+	if _, err := Marshal(&Report{Results: []icinga.Result{icinga.NewResult("x", icinga.Status(5), "")}}); err == nil {
+		t.Errorf("Marshal() should fail for invalid status")
+	}
+}
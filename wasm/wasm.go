@@ -0,0 +1,318 @@
+// Package wasm runs check modules compiled to WebAssembly in a pure Go
+// runtime. Modules are sandboxed: they only see the WASI clocks, their
+// arguments and the host functions of the "icinga" module, all of them
+// working on the linear memory of the module:
+//
+//	result(name_ptr, name_len, status, message_ptr, message_len)
+//	perfdata(label_ptr, label_len, value f64, unit_ptr, unit_len,
+//		warning_ptr, warning_len, critical_ptr, critical_len, min f64, max f64)
+//	metric(name_ptr, name_len, value f64, unit_ptr, unit_len)
+//	log(message_ptr, message_len)
+//	now() i64
+//	read_file(path_ptr, path_len, buf_ptr, buf_len) i32
+//	http_get(url_ptr, url_len, buf_ptr, buf_len, status_ptr) i32
+//
+// status is the ordinal of an icinga.Status. perfdata is attached to the
+// next result, min and max are NaN if unset. read_file and http_get copy up
+// to buf_len bytes and return the full size, so a module can retry with a
+// larger buffer, or a negative error code: ErrNotAllowed or ErrFailed. Files
+// and URLs are allowed as described in package allow, files and response
+// bodies larger than the memory limit of the module fail with ErrFailed.
+// http_get writes the HTTP status code as uint32 to status_ptr. now returns
+// the Unix time in nanoseconds.
+//
+// The module runs its _start function (WASI command) or an exported check
+// function.
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+	"github.com/djaenecke/icinga-checks-library/allow"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+type (
+	// Options options to run a module
+	Options struct {
+		// Timeout defaults to icinga.DefaultTimeout, the deadline of the
+		// context applies as well
+		Timeout time.Duration
+		// MemoryPages limits the memory of the module in 64 KiB pages,
+		// defaults to DefaultMemoryPages
+		MemoryPages uint32
+		// Files are the paths read_file may read, shell patterns are allowed,
+		// see allow.NewFiles
+		Files []string
+		// URLPrefixes are the prefixes of URLs http_get may fetch, see
+		// allow.NewURLs
+		URLPrefixes []string
+		// HTTPClient is used by http_get, defaults to http.DefaultClient. It
+		// only follows redirects to allowed URLs.
+		HTTPClient *http.Client
+		// Evaluator evaluates the samples added with metric, they are only
+		// returned by Run and added as perfdata by Checks if nil
+		Evaluator icinga.Evaluator
+		// Args are passed as WASI arguments after the module name
+		Args []string
+		// Log receives the messages of log and stderr, they are discarded if
+		// nil
+		Log io.Writer
+	}
+
+	// host implements the host functions for a single run
+	host struct {
+		options Options
+		results icinga.Results
+		samples []icinga.Sample
+		// pending is the perfdata attached to the next result
+		pending []icinga.Perfdata
+		files   allow.Files
+		urls    allow.URLs
+		client  *http.Client
+	}
+)
+
+const (
+	// DefaultMemoryPages limits the memory of modules to 16 MiB
+	DefaultMemoryPages = 256
+	// MetricsResultName is the name of the OK Result with the samples as
+	// perfdata added by Checks without Evaluator
+	MetricsResultName = "metrics"
+	// HostModule is the import module name of the host functions
+	HostModule = "icinga"
+
+	// ErrNotAllowed is returned by read_file and http_get for paths and URLs
+	// which are not allowed
+	ErrNotAllowed = -1
+	// ErrFailed is returned by read_file and http_get if the file can't be
+	// read or the request failed
+	ErrFailed = -2
+)
+
+// Run runs a module and adds its results to results. The samples added with
+// metric are evaluated by the Evaluator of the options and returned.
+func Run(ctx context.Context, module []byte, options Options, results icinga.Results) ([]icinga.Sample, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = icinga.DefaultTimeout
+	}
+	if options.MemoryPages == 0 {
+		options.MemoryPages = DefaultMemoryPages
+	}
+	files, err := allow.NewFiles(options.Files)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := allow.NewURLs(options.URLPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	if options.Log == nil {
+		options.Log = ioutil.Discard
+	}
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	config := wazero.NewRuntimeConfig().WithMemoryLimitPages(options.MemoryPages).WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	defer runtime.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, fmt.Errorf("failed to instantiate WASI: %v", err)
+	}
+	h := &host{options: options, results: results, files: files, urls: urls, client: urls.Client(options.HTTPClient)}
+	if err := h.instantiate(ctx, runtime); err != nil {
+		return nil, fmt.Errorf("failed to instantiate host module: %v", err)
+	}
+
+	compiled, err := runtime.CompileModule(ctx, module)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module: %v", err)
+	}
+	moduleConfig := wazero.NewModuleConfig().
+		WithName("check").
+		WithArgs(append([]string{"check"}, options.Args...)...).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithStderr(options.Log).
+		WithStartFunctions()
+	instance, err := runtime.InstantiateModule(ctx, compiled, moduleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate module: %v", err)
+	}
+
+	entry := instance.ExportedFunction("_start")
+	if entry == nil {
+		entry = instance.ExportedFunction("check")
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("module exports neither _start nor check")
+	}
+	if _, err := entry.Call(ctx); err != nil {
+		exitErr, ok := err.(*sys.ExitError)
+		switch {
+		case !ok:
+			return h.samples, fmt.Errorf("module failed: %v", err)
+		case exitErr.ExitCode() == sys.ExitCodeDeadlineExceeded:
+			return h.samples, fmt.Errorf("module timed out after %v", options.Timeout)
+		case exitErr.ExitCode() != 0:
+			return h.samples, fmt.Errorf("module exited with code %d", exitErr.ExitCode())
+		}
+	}
+	if len(h.pending) > 0 {
+		return h.samples, fmt.Errorf("module added perfdata %s without result", h.pending[0].Label)
+	}
+	if options.Evaluator != nil {
+		options.Evaluator.Evaluate(h.samples, results)
+	}
+	return h.samples, nil
+}
+
+// Checks returns a ChecksFunc which runs the module file, e.g. for
+// icinga.PluginOptions.RunContext. Set an Evaluator in the options to turn the
+// metrics of the module into results, otherwise they are added as perfdata of
+// a Result named MetricsResultName.
+func Checks(path string, options Options) icinga.ChecksFunc {
+	return func(ctx context.Context, results icinga.Results) error {
+		module, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read module: %v", err)
+		}
+		samples, err := Run(ctx, module, options, results)
+		if err == nil && options.Evaluator == nil && len(samples) > 0 {
+			results.Add(icinga.NewSamplesResult(MetricsResultName, samples))
+		}
+		return err
+	}
+}
+
+func (h *host) instantiate(ctx context.Context, runtime wazero.Runtime) error {
+	_, err := runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(h.result).Export("result").
+		NewFunctionBuilder().WithFunc(h.perfdata).Export("perfdata").
+		NewFunctionBuilder().WithFunc(h.metric).Export("metric").
+		NewFunctionBuilder().WithFunc(h.log).Export("log").
+		NewFunctionBuilder().WithFunc(h.now).Export("now").
+		NewFunctionBuilder().WithFunc(h.readFile).Export("read_file").
+		NewFunctionBuilder().WithFunc(h.httpGet).Export("http_get").
+		Instantiate(ctx)
+	return err
+}
+
+// read returns a string from the memory of the module, it panics for invalid
+// ranges which aborts the module
+func read(m api.Module, ptr uint32, length uint32) string {
+	data, ok := m.Memory().Read(ptr, length)
+	if !ok {
+		panic(fmt.Sprintf("memory range %d+%d out of bounds", ptr, length))
+	}
+	return string(data)
+}
+
+// copyTo copies data into the buffer of the module and returns the full size
+func copyTo(m api.Module, data []byte, ptr uint32, length uint32) int32 {
+	n := uint32(len(data))
+	if n > length {
+		n = length
+	}
+	if !m.Memory().Write(ptr, data[:n]) {
+		panic(fmt.Sprintf("memory range %d+%d out of bounds", ptr, length))
+	}
+	return int32(len(data))
+}
+
+func (h *host) result(ctx context.Context, m api.Module, namePtr, nameLen, status, messagePtr, messageLen uint32) {
+	if status > uint32(icinga.ServiceStatusUnknown) {
+		panic(fmt.Sprintf("invalid status %d", status))
+	}
+	name, message := read(m, namePtr, nameLen), read(m, messagePtr, messageLen)
+	if len(h.pending) > 0 {
+		h.results.Add(icinga.NewResultWithPerfdata(name, icinga.Status(status), message, h.pending))
+		h.pending = nil
+		return
+	}
+	h.results.Add(icinga.NewResult(name, icinga.Status(status), message))
+}
+
+func (h *host) perfdata(ctx context.Context, m api.Module, labelPtr, labelLen uint32, value float64, unitPtr, unitLen, warningPtr, warningLen, criticalPtr, criticalLen uint32, min, max float64) {
+	perfdata := icinga.Perfdata{
+		Label:    read(m, labelPtr, labelLen),
+		Value:    value,
+		Unit:     read(m, unitPtr, unitLen),
+		Warning:  read(m, warningPtr, warningLen),
+		Critical: read(m, criticalPtr, criticalLen),
+	}
+	if !math.IsNaN(min) {
+		perfdata.Min = &min
+	}
+	if !math.IsNaN(max) {
+		perfdata.Max = &max
+	}
+	h.pending = append(h.pending, perfdata)
+}
+
+func (h *host) metric(ctx context.Context, m api.Module, namePtr, nameLen uint32, value float64, unitPtr, unitLen uint32) {
+	h.samples = append(h.samples, icinga.Sample{Name: read(m, namePtr, nameLen), Value: value, Unit: read(m, unitPtr, unitLen)})
+}
+
+func (h *host) log(ctx context.Context, m api.Module, messagePtr, messageLen uint32) {
+	fmt.Fprintln(h.options.Log, read(m, messagePtr, messageLen))
+}
+
+func (h *host) now(ctx context.Context) int64 {
+	return time.Now().UnixNano()
+}
+
+// memorySize returns the maximum memory of the module in bytes
+func (h *host) memorySize() int64 {
+	return int64(h.options.MemoryPages) * 65536
+}
+
+func (h *host) readFile(ctx context.Context, m api.Module, pathPtr, pathLen, bufPtr, bufLen uint32) int32 {
+	// files which can't fit into the memory of the module are never read
+	content, err := h.files.ReadFile(read(m, pathPtr, pathLen), h.memorySize())
+	if _, ok := err.(*allow.NotAllowedError); ok {
+		return ErrNotAllowed
+	}
+	if err != nil {
+		return ErrFailed
+	}
+	return copyTo(m, content, bufPtr, bufLen)
+}
+
+func (h *host) httpGet(ctx context.Context, m api.Module, urlPtr, urlLen, bufPtr, bufLen, statusPtr uint32) int32 {
+	url := read(m, urlPtr, urlLen)
+	if err := h.urls.Check(url); err != nil {
+		return ErrNotAllowed
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return ErrFailed
+	}
+	response, err := h.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return ErrFailed
+	}
+	defer response.Body.Close()
+	// bodies which can't fit into the memory of the module fail instead of
+	// being truncated
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, h.memorySize()+1))
+	if err != nil || int64(len(body)) > h.memorySize() {
+		return ErrFailed
+	}
+	if !m.Memory().WriteUint32Le(statusPtr, uint32(response.StatusCode)) {
+		panic(fmt.Sprintf("memory offset %d out of bounds", statusPtr))
+	}
+	return copyTo(m, body, bufPtr, bufLen)
+}
@@ -0,0 +1,367 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	icinga "github.com/djaenecke/icinga-checks-library"
+)
+
+const (
+	i32 = 0x7f
+	i64 = 0x7e
+	f64 = 0x7c
+)
+
+// module assembles a minimal WebAssembly module importing host functions,
+// exporting its memory and a single function
+type module struct {
+	types   [][2][]byte
+	imports []string
+	memory  uint32
+	export  string
+	code    []byte
+	data    map[uint32]string
+}
+
+func uleb(v uint64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func sleb(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func name(s string) []byte {
+	return append(uleb(uint64(len(s))), s...)
+}
+
+func vec(items ...[]byte) []byte {
+	b := uleb(uint64(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func section(id byte, content []byte) []byte {
+	return append(append([]byte{id}, uleb(uint64(len(content)))...), content...)
+}
+
+// i32Const, f64Const and call return instructions
+func i32Const(v int64) []byte { return append([]byte{0x41}, sleb(v)...) }
+func call(f int) []byte       { return append([]byte{0x10}, uleb(uint64(f))...) }
+func f64Const(v float64) []byte {
+	b := make([]byte, 9)
+	b[0] = 0x44
+	binary.LittleEndian.PutUint64(b[1:], math.Float64bits(v))
+	return b
+}
+
+// hostTypes are the signatures of the host functions
+var hostTypes = map[string][2][]byte{
+	"result":    {{i32, i32, i32, i32, i32}, {}},
+	"perfdata":  {{i32, i32, f64, i32, i32, i32, i32, i32, i32, f64, f64}, {}},
+	"metric":    {{i32, i32, f64, i32, i32}, {}},
+	"log":       {{i32, i32}, {}},
+	"now":       {{}, {i64}},
+	"read_file": {{i32, i32, i32, i32}, {i32}},
+	"http_get":  {{i32, i32, i32, i32, i32}, {i32}},
+}
+
+// bytes encodes the module, the imported functions have the indexes of
+// m.imports followed by the exported function
+func (m module) bytes() []byte {
+	types := [][]byte{}
+	imports := [][]byte{}
+	for i, function := range m.imports {
+		t := hostTypes[function]
+		types = append(types, append(append([]byte{0x60}, vec(split(t[0])...)...), vec(split(t[1])...)...))
+		imports = append(imports, append(append(name(HostModule), name(function)...), 0x00, byte(i)))
+	}
+	types = append(types, []byte{0x60, 0x00, 0x00})
+
+	body := append(vec(), m.code...)
+	body = append(body, 0x0b)
+	data := [][]byte{}
+	for offset, content := range m.data {
+		segment := append([]byte{0x00}, i32Const(int64(offset))...)
+		segment = append(segment, 0x0b)
+		data = append(data, append(segment, name(content)...))
+	}
+
+	b := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	b = append(b, section(1, vec(types...))...)
+	b = append(b, section(2, vec(imports...))...)
+	b = append(b, section(3, vec(uleb(uint64(len(m.imports)))))...)
+	b = append(b, section(5, vec(append([]byte{0x00}, uleb(uint64(m.memory))...)))...)
+	b = append(b, section(7, vec(
+		append(name("memory"), 0x02, 0x00),
+		append(name(m.export), 0x00, byte(len(m.imports))),
+	))...)
+	b = append(b, section(10, vec(append(uleb(uint64(len(body))), body...)))...)
+	b = append(b, section(11, vec(data...))...)
+	return b
+}
+
+func split(types []byte) [][]byte {
+	items := [][]byte{}
+	for _, t := range types {
+		items = append(items, []byte{t})
+	}
+	return items
+}
+
+func concat(instructions ...[]byte) []byte {
+	return bytes.Join(instructions, nil)
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-wasm")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+	if err := ioutil.WriteFile(path, []byte("degraded"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "queued")
+	}))
+	defer server.Close()
+
+	// result("file", WARNING, read_file(path))
+	// perfdata("queue", 12, "", "10", "20", 0, NaN)
+	// result("http", OK, http_get(url))
+	// metric("load", 2.5, "")
+	// log("done")
+	url := server.URL + "/status"
+	m := module{
+		imports: []string{"result", "read_file", "http_get", "metric", "log", "perfdata"},
+		memory:  1,
+		export:  "check",
+		code: concat(
+			i32Const(1024), i32Const(4), i32Const(1), i32Const(2048),
+			i32Const(0), i32Const(int64(len(path))), i32Const(2048), i32Const(64), call(1),
+			call(0),
+			i32Const(1088), i32Const(5), f64Const(12), i32Const(0), i32Const(0),
+			i32Const(1096), i32Const(2), i32Const(1098), i32Const(2), f64Const(0), f64Const(math.NaN()), call(5),
+			i32Const(1040), i32Const(4), i32Const(0), i32Const(3072),
+			i32Const(512), i32Const(int64(len(url))), i32Const(3072), i32Const(64), i32Const(4000), call(2),
+			call(0),
+			i32Const(1056), i32Const(4), f64Const(2.5), i32Const(0), i32Const(0), call(3),
+			i32Const(1072), i32Const(4), call(4),
+		),
+		data: map[uint32]string{0: path, 512: url, 1024: "file", 1040: "http", 1056: "load", 1072: "done", 1088: "queue", 1096: "1020"},
+	}
+
+	var log bytes.Buffer
+	results := icinga.NewResults()
+	options := Options{Files: []string{filepath.Join(dir, "*")}, URLPrefixes: []string{server.URL + "/"}, Log: &log}
+	samples, err := Run(context.Background(), m.bytes(), options, results)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	t.Logf("Run() is %v", results)
+
+	shouldBe := `WARNING: warning: [file] ok: [http] | queue=12;10;20;0
+WARNING: file: degraded
+OK: http: queued
+`
+	if fmt.Sprint(results) != shouldBe {
+		t.Errorf("Run() should be:\n%v", shouldBe)
+	}
+	if len(samples) != 1 || samples[0].Name != "load" || samples[0].Value != 2.5 {
+		t.Errorf("Run() should return the metric but is %v", samples)
+	}
+	if log.String() != "done\n" {
+		t.Errorf("log should write to Log but is %q", log.String())
+	}
+
+	// the files and URLs are not allowed, the error codes are used as length
+	// and fail the module
+	_, err = Run(context.Background(), m.bytes(), Options{}, icinga.NewResults())
+	t.Logf("Run() without allowed files is %v", err)
+	if err == nil || !strings.Contains(err.Error(), "out of bounds") {
+		t.Errorf("Run() should fail for the negative length")
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	loop := []byte{0x03, 0x40, 0x0c, 0x00, 0x0b}
+	tests := []struct {
+		module   module
+		options  Options
+		errorMsg string
+	}{
+		{module{memory: 1, export: "_start", code: loop}, Options{Timeout: 50 * time.Millisecond}, "module timed out after 50ms"},
+		{module{memory: 100, export: "_start"}, Options{MemoryPages: 10}, "invalid module"},
+		{module{memory: 1, export: "main"}, Options{}, "module exports neither _start nor check"},
+		{module{memory: 1, export: "_start", imports: []string{"result"},
+			code: concat(i32Const(0), i32Const(1), i32Const(7), i32Const(0), i32Const(1), call(0))}, Options{}, "invalid status 7"},
+		{module{memory: 1, export: "_start", imports: []string{"perfdata"}, data: map[uint32]string{0: "queue"},
+			code: concat(i32Const(0), i32Const(5), f64Const(1), i32Const(0), i32Const(0), i32Const(0), i32Const(0), i32Const(0), i32Const(0),
+				f64Const(math.NaN()), f64Const(math.NaN()), call(0))}, Options{}, "module added perfdata queue without result"},
+	}
+	for _, test := range tests {
+		_, err := Run(context.Background(), test.module.bytes(), test.options, icinga.NewResults())
+		t.Logf("Run() is %v", err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Run() should fail with: %v", test.errorMsg)
+		}
+	}
+	if _, err := Run(context.Background(), []byte("not wasm"), Options{}, icinga.NewResults()); err == nil {
+		t.Errorf("Run() should fail for invalid modules")
+	}
+}
+
+func TestRunReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-wasm")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	large := filepath.Join(dir, "large")
+	if err := ioutil.WriteFile(large, make([]byte, 70000), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// result("file", read_file(path), "file"), the error code is an invalid
+	// status
+	options := Options{MemoryPages: 1, Files: []string{large, filepath.Join(dir, "link")}}
+	tests := []struct {
+		path     string
+		errorMsg string
+	}{
+		{large, "invalid status 4294967294"},
+		{filepath.Join(dir, "link"), "invalid status 4294967295"},
+	}
+	for _, test := range tests {
+		m := module{
+			imports: []string{"result", "read_file"},
+			memory:  1,
+			export:  "check",
+			code: concat(
+				i32Const(1024), i32Const(4),
+				i32Const(0), i32Const(int64(len(test.path))), i32Const(2048), i32Const(64), call(1),
+				i32Const(1024), i32Const(4), call(0),
+			),
+			data: map[uint32]string{0: test.path, 1024: "file"},
+		}
+		_, err := Run(context.Background(), m.bytes(), options, icinga.NewResults())
+		t.Logf("Run() reading %v is %v", test.path, err)
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("Run() reading %v should fail with: %v", test.path, test.errorMsg)
+		}
+	}
+}
+
+func TestRunHTTPGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 70000))
+	}))
+	defer server.Close()
+
+	// result("http", http_get(url), "http"), bodies larger than the memory
+	// fail instead of being truncated, the error code is an invalid status
+	url := server.URL + "/large"
+	m := module{
+		imports: []string{"result", "http_get"},
+		memory:  1,
+		export:  "check",
+		code: concat(
+			i32Const(1024), i32Const(4),
+			i32Const(0), i32Const(int64(len(url))), i32Const(2048), i32Const(64), i32Const(4000), call(1),
+			i32Const(1024), i32Const(4), call(0),
+		),
+		data: map[uint32]string{0: url, 1024: "http"},
+	}
+	_, err := Run(context.Background(), m.bytes(), Options{MemoryPages: 1, URLPrefixes: []string{server.URL + "/"}}, icinga.NewResults())
+	t.Logf("Run() fetching a large body is %v", err)
+	if err == nil || !strings.Contains(err.Error(), "invalid status 4294967294") {
+		t.Errorf("Run() fetching a large body should fail with ErrFailed")
+	}
+}
+
+func TestChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-wasm")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// result("queue", CRITICAL, "queue")
+	// metric("load", 2.5, "")
+	m := module{
+		imports: []string{"result", "metric"},
+		memory:  1,
+		export:  "_start",
+		code: concat(
+			i32Const(0), i32Const(5), i32Const(2), i32Const(0), i32Const(5), call(0),
+			i32Const(16), i32Const(4), f64Const(2.5), i32Const(0), i32Const(0), call(1),
+		),
+		data: map[uint32]string{0: "queue", 16: "load"},
+	}
+	path := filepath.Join(dir, "check.wasm")
+	if err := ioutil.WriteFile(path, m.bytes(), 0644); err != nil {
+		t.Fatalf("failed to write module: %v", err)
+	}
+	evaluator, err := icinga.NewEvaluator([]icinga.EvaluationRule{{Metric: "load", Warning: "2"}})
+	if err != nil {
+		t.Fatalf("NewEvaluator() failed: %v", err)
+	}
+	results := icinga.RunChecks(context.Background(), time.Second, icinga.NewResults(), Checks(path, Options{Evaluator: evaluator}))
+	t.Logf("Checks() is %v", results)
+	if results.CalculateStatus() != icinga.ServiceStatusCritical {
+		t.Errorf("Checks() should add the results of the module")
+	}
+	if all := results.All(); len(all) != 2 || all[1].Name() != "load" || all[1].Status() != icinga.ServiceStatusWarning {
+		t.Errorf("Checks() should evaluate the metrics")
+	}
+
+	// without rules the samples are added as perfdata
+	results = icinga.RunChecks(context.Background(), time.Second, icinga.NewResults(), Checks(path, Options{}))
+	t.Logf("Checks() is %v", results)
+	if shouldBe := "CRITICAL: critical: [queue] ok: [metrics] | load=2.5\nCRITICAL: queue: queue\nOK: metrics: collected samples: 1\n"; fmt.Sprint(results) != shouldBe {
+		t.Errorf("Checks() should be:\n%v", shouldBe)
+	}
+}
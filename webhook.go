@@ -0,0 +1,292 @@
+package icinga
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+)
+
+type (
+	// WebhookOptions options to generate a new webhook Sink
+	WebhookOptions struct {
+		URL string
+		// Method defaults to POST
+		Method string
+		// Template renders the request body from WebhookData, defaults to
+		// DefaultWebhookTemplate. The function macros expands Icinga macros,
+		// e.g. {{macros "$HOSTNAME$"}}, see ExpandMacros.
+		Template string
+		Headers  map[string]string
+		// Username and Password enable basic authentication
+		Username string
+		Password string
+		// BearerToken enables token authentication
+		BearerToken string
+		// HMACKey signs the body with HMAC-SHA256, the hex encoded signature is
+		// sent as "sha256=<signature>" in HMACHeader
+		HMACKey    []byte
+		HMACHeader string
+		// Retries is the number of additional attempts for requests which
+		// failed with a network error or a 5xx status. RetryDelay before the
+		// first retry defaults to 1s and doubles with every further retry.
+		Retries    int
+		RetryDelay time.Duration
+		// DeadLetterFile receives requests which failed after all retries
+		DeadLetterFile string
+		// History enables OnlyChanges, every run is recorded into it once it
+		// was sent successfully
+		History     History
+		OnlyChanges bool
+		Plugin      string
+		Client      *http.Client
+		// Signer signs the results as passive check results of Host and the
+		// service Plugin, the template defaults to SignedWebhookTemplate
+		Signer Signer
+		// Host defaults to os.Hostname()
+		Host string
+	}
+
+	// WebhookData is passed to the webhook template
+	WebhookData struct {
+		Plugin  string
+		Status  Status
+		Message string
+		Results []HistoryEntry
+		// Perfdata contains the perfdata of all results formatted like
+		// 'label'=value[unit];[warning];[critical];[min];[max]
+		Perfdata []string
+		// Changed contains the names of results which changed their status
+		// since the last recorded run
+		Changed []string
+		// Signed contains the signed results if a Signer is used
+		Signed *SignedResults
+	}
+
+	webhookSink struct {
+		options  WebhookOptions
+		template *template.Template
+	}
+
+	webhookDeadLetter struct {
+		Time   time.Time         `json:"time"`
+		Method string            `json:"method"`
+		URL    string            `json:"url"`
+		Header map[string]string `json:"header"`
+		Body   string            `json:"body"`
+		Error  string            `json:"error"`
+	}
+)
+
+const (
+	// DefaultWebhookTemplate renders the Results as JSON object
+	DefaultWebhookTemplate = `{"plugin":{{json .Plugin}},"status":{{json .Status}},"message":{{json .Message}},"results":{{json .Results}}}`
+	// SignedWebhookTemplate renders the SignedResults as JSON object
+	SignedWebhookTemplate = `{{json .Signed}}`
+)
+
+// NewWebhookSink creates a Sink which sends the Results rendered through a
+// template to an HTTP endpoint
+func NewWebhookSink(options WebhookOptions) (Sink, error) {
+	if options.Method == "" {
+		options.Method = http.MethodPost
+	}
+	if options.Template == "" && options.Signer != nil {
+		options.Template = SignedWebhookTemplate
+	} else if options.Template == "" {
+		options.Template = DefaultWebhookTemplate
+	}
+	if options.Signer != nil && options.Host == "" {
+		options.Host, _ = os.Hostname()
+	}
+	if options.HMACHeader == "" {
+		options.HMACHeader = "X-Icinga-Signature"
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = time.Second
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.OnlyChanges && options.History == nil {
+		return nil, fmt.Errorf("webhook option OnlyChanges requires a History")
+	}
+
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		"macros": ExpandMacros,
+	}).Parse(options.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook template: %v", err)
+	}
+	return &webhookSink{options, tmpl}, nil
+}
+
+// Write renders and sends the Results, if OnlyChanges is set nothing is sent
+// unless a result changed its status. The run is only recorded in the History
+// if it was sent, so failed changes are sent again with the next run.
+func (s *webhookSink) Write(results Results) error {
+	data := WebhookData{
+		Plugin:  s.options.Plugin,
+		Status:  results.CalculateStatus(),
+		Message: results.GenerateMessage(),
+		Results: historyEntries(results),
+	}
+	data.Perfdata = []string{}
+	for _, perfdata := range ResultsPerfdata(results) {
+		data.Perfdata = append(data.Perfdata, perfdata.String())
+	}
+	if s.options.Signer != nil {
+		signed, err := SignResults(s.options.Signer, s.options.Host, s.options.Plugin, results)
+		if err != nil {
+			return err
+		}
+		data.Signed = signed
+	}
+
+	if s.options.History != nil {
+		changed, err := s.changes(data.Results)
+		if err != nil {
+			return err
+		}
+		data.Changed = changed
+	}
+
+	if !s.options.OnlyChanges || len(data.Changed) > 0 {
+		var body bytes.Buffer
+		if err := s.template.Execute(&body, data); err != nil {
+			return fmt.Errorf("failed to render webhook template: %v", err)
+		}
+		if err := s.send(body.Bytes()); err != nil {
+			return err
+		}
+	}
+	if s.options.History != nil {
+		return s.options.History.Write(results)
+	}
+	return nil
+}
+
+// changes returns the names of results with a different status than in the
+// last recorded run
+func (s *webhookSink) changes(entries []HistoryEntry) ([]string, error) {
+	runs, err := s.options.History.Runs()
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[string]Status)
+	if len(runs) > 0 {
+		for _, entry := range runs[len(runs)-1].Results {
+			last[entry.Name] = entry.Status
+		}
+	}
+
+	changed := []string{}
+	for _, entry := range entries {
+		if status, found := last[entry.Name]; !found || status != entry.Status {
+			changed = append(changed, entry.Name)
+		}
+	}
+	return changed, nil
+}
+
+// webhookCredentials are the headers which are not written to the dead
+// letter file
+var webhookCredentials = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+func (s *webhookSink) send(body []byte) error {
+	header := make(http.Header)
+	for name, value := range s.options.Headers {
+		header.Set(name, value)
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	if s.options.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+s.options.BearerToken)
+	}
+	if len(s.options.HMACKey) > 0 {
+		mac := hmac.New(sha256.New, s.options.HMACKey)
+		mac.Write(body)
+		header.Set(s.options.HMACHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	var err error
+	delay := s.options.RetryDelay
+	for attempt := 0; attempt <= s.options.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var retry bool
+		if retry, err = s.do(header, body); err == nil || !retry {
+			break
+		}
+	}
+	if err != nil && s.options.DeadLetterFile != "" {
+		if dlErr := s.deadLetter(header, body, err); dlErr != nil {
+			return fmt.Errorf("%v (%v)", err, dlErr)
+		}
+	}
+	return err
+}
+
+// do sends the request, retry is true for network errors and 5xx statuses
+func (s *webhookSink) do(header http.Header, body []byte) (retry bool, err error) {
+	request, err := http.NewRequest(s.options.Method, s.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	request.Header = header.Clone()
+	if s.options.Username != "" {
+		request.SetBasicAuth(s.options.Username, s.options.Password)
+	}
+
+	response, err := s.options.Client.Do(request)
+	if err != nil {
+		return true, fmt.Errorf("failed to send webhook: %v", err)
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode >= 500, fmt.Errorf("failed to send webhook: %s", response.Status)
+	}
+	return false, nil
+}
+
+// deadLetter appends a failed request as JSON line to the dead letter file,
+// credentials are not written
+func (s *webhookSink) deadLetter(header http.Header, body []byte, cause error) error {
+	stripped := header.Clone()
+	for _, name := range webhookCredentials {
+		stripped.Del(name)
+	}
+	headers := make(map[string]string)
+	for name := range stripped {
+		headers[name] = stripped.Get(name)
+	}
+	line, err := json.Marshal(webhookDeadLetter{time.Now(), s.options.Method, s.options.URL, headers, string(body), cause.Error()})
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %v", err)
+	}
+	f, err := os.OpenFile(s.options.DeadLetterFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter file: %v", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write dead letter file: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,232 @@
+package icinga
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	key := []byte("secret")
+	sink, err := NewWebhookSink(WebhookOptions{
+		URL:        server.URL,
+		Headers:    map[string]string{"X-Custom": "value"},
+		Username:   "user",
+		Password:   "pass",
+		HMACKey:    key,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+		Plugin:     "check_foo",
+	})
+	if err != nil {
+		t.Fatalf("failed to create webhook sink: %v", err)
+	}
+
+	results := NewResults()
+	results.Add(NewResult("check 1", ServiceStatusCritical, "some critical"))
+	if err := sink.Write(results); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Write() should retry once but sent %d requests", len(requests))
+	}
+	shouldBe := `{"plugin":"check_foo","status":"CRITICAL","message":"CRITICAL: critical: [check 1]","results":[{"name":"check 1","status":"CRITICAL","message":"some critical"}]}`
+	t.Logf("body is: %v", bodies[1])
+	if bodies[1] != shouldBe {
+		t.Errorf("body should be: %v", shouldBe)
+	}
+
+	request := requests[1]
+	if user, pass, ok := request.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("request should use basic auth")
+	}
+	if request.Header.Get("X-Custom") != "value" {
+		t.Errorf("request should contain custom header")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(shouldBe))
+	if request.Header.Get("X-Icinga-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("request signature %v is invalid", request.Header.Get("X-Icinga-Signature"))
+	}
+}
+
+func TestWebhookSinkSigned(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	key := []byte("0123456789abcdef")
+	signer, _ := NewHMACSigner("current", key)
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, Signer: signer, Host: "db1", Plugin: "check_foo"})
+	if err != nil {
+		t.Fatalf("failed to create webhook sink: %v", err)
+	}
+	results := NewResults()
+	results.Add(NewResult("check 1", ServiceStatusCritical, "some critical"))
+	if err := sink.Write(results); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	t.Logf("body is: %s", body)
+	signed := &SignedResults{}
+	if err := json.Unmarshal(body, signed); err != nil {
+		t.Fatalf("body should be signed results: %v", err)
+	}
+	verifier, _ := NewVerifier(VerifierOptions{HMACKeys: map[string][]byte{"current": key}})
+	if err := verifier.Verify(signed); err != nil || signed.Host != "db1" || signed.Service != "check_foo" {
+		t.Errorf("body should be valid signed results of db1 and check_foo: %v", err)
+	}
+}
+
+func TestWebhookSinkOnlyChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-webhook")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var bodies []string
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{
+		URL:         server.URL,
+		Template:    `{{range .Changed}}{{.}};{{end}}`,
+		History:     NewFileHistory(filepath.Join(dir, "history.jsonl"), 0),
+		OnlyChanges: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create webhook sink: %v", err)
+	}
+
+	// the failed change to CRITICAL is not recorded and sent again
+	tests := []struct {
+		status Status
+		fail   bool
+	}{
+		{ServiceStatusOk, false},
+		{ServiceStatusOk, false},
+		{ServiceStatusWarning, false},
+		{ServiceStatusWarning, false},
+		{ServiceStatusCritical, true},
+		{ServiceStatusCritical, false},
+	}
+	for _, test := range tests {
+		results := NewResults()
+		results.Add(NewResult("check 1", test.status, "some message"))
+		results.Add(NewResultOk("check 2"))
+		fail = test.fail
+		if err := sink.Write(results); (err != nil) != test.fail {
+			t.Fatalf("Write() of %v should fail: %v, but is %v", test.status, test.fail, err)
+		}
+	}
+
+	shouldBe := []string{"check 1;check 2;", "check 1;", "check 1;"}
+	t.Logf("bodies are: %v", bodies)
+	if strings.Join(bodies, "|") != strings.Join(shouldBe, "|") {
+		t.Errorf("bodies should be: %v", shouldBe)
+	}
+}
+
+func TestWebhookSinkDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icinga-webhook")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	deadLetterFile := filepath.Join(dir, "dead.jsonl")
+	sink, err := NewWebhookSink(WebhookOptions{
+		URL:            server.URL,
+		Headers:        map[string]string{"authorization": "Bearer token", "content-type": "text/plain"},
+		Retries:        2,
+		RetryDelay:     time.Millisecond,
+		DeadLetterFile: deadLetterFile,
+	})
+	if err != nil {
+		t.Fatalf("failed to create webhook sink: %v", err)
+	}
+	results := NewResults()
+	results.Add(NewResultOk("check 1"))
+	if err := sink.Write(results); err == nil {
+		t.Errorf("Write() should fail")
+	}
+
+	data, err := ioutil.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatalf("failed to read dead letter file: %v", err)
+	}
+	t.Logf("dead letter is: %s", data)
+	if !strings.Contains(string(data), `"error":"failed to send webhook: 500 Internal Server Error"`) {
+		t.Errorf("dead letter should contain the error")
+	}
+	if strings.Contains(string(data), "token") {
+		t.Errorf("dead letter should not contain credentials")
+	}
+	if !strings.Contains(string(data), `"Content-Type":"text/plain"`) {
+		t.Errorf("dead letter should contain the custom content type")
+	}
+	if requests != 3 {
+		t.Errorf("Write() should retry 5xx statuses twice but sent %d requests", requests)
+	}
+}
+
+func TestWebhookSinkNoRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, Retries: 3, RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create webhook sink: %v", err)
+	}
+	results := NewResults()
+	results.Add(NewResultOk("check 1"))
+	err = sink.Write(results)
+	t.Logf("Write() is %v after %d requests", err, requests)
+	if err == nil || requests != 1 {
+		t.Errorf("Write() should fail without retrying 4xx statuses")
+	}
+}
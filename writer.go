@@ -0,0 +1,34 @@
+package icinga
+
+import "io"
+
+type (
+	// countingWriter writes strings to an io.Writer without converting them
+	// if possible, counts the written bytes and keeps the first error
+	countingWriter struct {
+		w   io.Writer
+		n   int64
+		err error
+	}
+)
+
+// stringWriterFor returns a countingWriter for w
+func stringWriterFor(w io.Writer) countingWriter {
+	return countingWriter{w: w}
+}
+
+// WriteString writes s unless a previous write failed
+func (c *countingWriter) WriteString(s string) {
+	if c.err != nil {
+		return
+	}
+	var n int
+	if sw, ok := c.w.(interface {
+		WriteString(string) (int, error)
+	}); ok {
+		n, c.err = sw.WriteString(s)
+	} else {
+		n, c.err = c.w.Write([]byte(s))
+	}
+	c.n += int64(n)
+}